@@ -0,0 +1,65 @@
+package pathgtfsrt
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type apiTrain struct {
+	Route       string `json:"route"`
+	RouteId     string `json:"route_id"`
+	Direction   string `json:"direction"`
+	Headsign    string `json:"headsign,omitempty"`
+	Arrival     string `json:"arrival"`
+	SecondsAway int64  `json:"seconds_away"`
+}
+
+type apiTrainsResponse struct {
+	Station string     `json:"station"`
+	StopId  string     `json:"stop_id"`
+	Trains  []apiTrain `json:"trains"`
+}
+
+// TrainsAPIHandler returns a handler that responds with the upcoming trains at a station as JSON,
+// for consumers that do not want to parse GTFS realtime. The handler should be mounted at
+// /api/stations/ and serves paths of the form /api/stations/{station}/trains, where the station is
+// either the source API station name, like hoboken, or the station's GTFS stop ID.
+//
+// Each train has its source API route, GTFS route ID, direction, headsign, projected arrival in
+// RFC 3339 format, and the number of seconds until it arrives. Trains that have already arrived
+// are omitted, and the rest are ordered by arrival.
+func (f *Feed) TrainsAPIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elements := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+		if len(elements) < 2 || elements[len(elements)-1] != "trains" {
+			http.NotFound(w, r)
+			return
+		}
+		station, ok := f.lookupStation(elements[len(elements)-2])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		now := f.clock.Now()
+		response := apiTrainsResponse{
+			Station: station.String(),
+			StopId:  f.staticData.stationToStopId[station],
+			Trains:  []apiTrain{},
+		}
+		for _, train := range upcomingTrains(f.get().trains[station], now) {
+			arrival := train.ProjectedArrival.AsTime()
+			response.Trains = append(response.Trains, apiTrain{
+				Route:       train.Route.String(),
+				RouteId:     f.staticData.routeToRouteId[train.Route],
+				Direction:   train.Direction.String(),
+				Headsign:    train.Headsign,
+				Arrival:     arrival.UTC().Format(time.RFC3339),
+				SecondsAway: int64(arrival.Sub(now) / time.Second),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
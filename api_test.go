@@ -0,0 +1,82 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedTrainsAPIHandler(t *testing.T) {
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	headsignTrain := sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5)
+	headsignTrain.Headsign = "33rd Street"
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			headsignTrain,
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 12, 5),
+			// This train has already arrived.
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 9, 5),
+		},
+	})
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	wantResponse := apiTrainsResponse{
+		Station: "HOBOKEN",
+		StopId:  stopIDHoboken,
+		Trains: []apiTrain{
+			{
+				Route:       "HOB_33",
+				RouteId:     routeID1,
+				Direction:   "TO_NJ",
+				Arrival:     "2023-02-26T10:12:00Z",
+				SecondsAway: 120,
+			},
+			{
+				Route:       "HOB_33",
+				RouteId:     routeID1,
+				Direction:   "TO_NY",
+				Headsign:    "33rd Street",
+				Arrival:     "2023-02-26T10:15:00Z",
+				SecondsAway: 300,
+			},
+		},
+	}
+	for _, tc := range []struct {
+		target   string
+		wantCode int
+	}{
+		{"/api/stations/hoboken/trains", http.StatusOK},
+		{"/api/stations/" + stopIDHoboken + "/trains", http.StatusOK},
+		{"/api/stations/newark/trains", http.StatusNotFound},
+		{"/api/stations/hoboken", http.StatusNotFound},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			f.TrainsAPIHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if w.Code != tc.wantCode {
+				t.Fatalf("status code got=%d, want=%d", w.Code, tc.wantCode)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var got apiTrainsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("json.Unmarshal() err got=%v, want=<nil>", err)
+			}
+			if diff := cmp.Diff(wantResponse, got); diff != "" {
+				t.Errorf("response got != want, diff=%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package pathgtfsrt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+const archiveTimeFormat = "20060102T150405.000Z"
+
+// Archiver is a publisher that writes every version of the feed to a gzip-compressed file in a
+// directory, for later replay and analysis. Files are placed in a subdirectory per day and named
+// after the time they were written; e.g., <dir>/2023-02-26/gtfsrt-20230226T101500.000Z.pb.gz.
+type Archiver struct {
+	clock   clock.Clock
+	dir     string
+	prefix  string
+	options archiverOptions
+
+	mutex sync.Mutex
+	// The archived files, oldest first, if rotation is enabled. The directory is listed once, on
+	// the first publish, and the files written afterwards are added as they are written.
+	files  []archivedFile
+	listed bool
+}
+
+// ArchiverOption configures optional behavior of the archiver.
+type ArchiverOption func(*archiverOptions)
+
+type archiverOptions struct {
+	retention time.Duration
+	maxFiles  int
+}
+
+// WithArchiveRetention deletes archived files older than the provided duration. By default files
+// are never deleted.
+func WithArchiveRetention(retention time.Duration) ArchiverOption {
+	return func(o *archiverOptions) {
+		o.retention = retention
+	}
+}
+
+// WithArchiveMaxFiles keeps at most the provided number of archived files, deleting the oldest. By
+// default there is no limit.
+func WithArchiveMaxFiles(maxFiles int) ArchiverOption {
+	return func(o *archiverOptions) {
+		o.maxFiles = maxFiles
+	}
+}
+
+// NewArchiver creates an archiver that writes files to the provided directory. The prefix
+// distinguishes multiple feeds archived to the same directory; e.g., gtfsrt and vehiclepositions.
+func NewArchiver(clock clock.Clock, dir, prefix string, opts ...ArchiverOption) *Archiver {
+	var options archiverOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Archiver{clock: clock, dir: dir, prefix: prefix, options: options}
+}
+
+// Publish archives the feed and then deletes files that are outside of the retention policy.
+func (a *Archiver) Publish(ctx context.Context, feed []byte) error {
+	now := a.clock.Now().UTC()
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.ModTime = now
+	if _, err := w.Write(feed); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	dayDir := filepath.Join(a.dir, now.Format("2006-01-02"))
+	if err := os.MkdirAll(dayDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dayDir, a.prefix+"-"+now.Format(archiveTimeFormat)+".pb.gz")
+	if err := writeFileAtomically(path, b.Bytes()); err != nil {
+		return err
+	}
+	return a.rotate(archivedFile{path: path, t: now})
+}
+
+// Records the archived file that was just written, and deletes archived files that are too old or
+// too many, and then any empty day directories.
+func (a *Archiver) rotate(written archivedFile) error {
+	if a.options.retention <= 0 && a.options.maxFiles <= 0 {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !a.listed {
+		// The listing includes the file that was just written.
+		files, err := listArchive(a.dir, a.prefix)
+		if err != nil {
+			return err
+		}
+		a.files, a.listed = files, true
+	} else {
+		a.files = append(a.files, written)
+		// The clock may have gone backwards.
+		sort.SliceStable(a.files, func(i, j int) bool {
+			return a.files[i].t.Before(a.files[j].t)
+		})
+	}
+	// The files to delete are the oldest ones.
+	n := 0
+	for ; n < len(a.files); n++ {
+		tooOld := a.options.retention > 0 && written.t.Sub(a.files[n].t) > a.options.retention
+		tooMany := a.options.maxFiles > 0 && len(a.files)-n > a.options.maxFiles
+		if !tooOld && !tooMany {
+			break
+		}
+	}
+	var kept []archivedFile
+	var errs []string
+	for _, file := range a.files[:n] {
+		if err := os.Remove(file.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			// Deleting the file is retried on the next rotation.
+			kept = append(kept, file)
+			errs = append(errs, err.Error())
+			continue
+		}
+		// Fails harmlessly if the directory still has files.
+		os.Remove(filepath.Dir(file.path))
+	}
+	a.files = append(kept, a.files[n:]...)
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete archived files: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ArchivedFeed is a version of a feed read from an archive written by an Archiver.
+type ArchivedFeed struct {
+	// The time the feed was archived.
+	Time time.Time
+	Feed []byte
+}
+
+// LoadArchive reads all of the feeds with the provided prefix in an archive directory written by
+// an Archiver, ordered by the time they were archived.
+func LoadArchive(dir, prefix string) ([]ArchivedFeed, error) {
+	files, err := listArchive(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var feeds []ArchivedFeed
+	for _, file := range files {
+		b, err := readGzipFile(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archived feed %s: %w", file.path, err)
+		}
+		feeds = append(feeds, ArchivedFeed{Time: file.t, Feed: b})
+	}
+	return feeds, nil
+}
+
+type archivedFile struct {
+	path string
+	t    time.Time
+}
+
+// Lists the archived files with the provided prefix, oldest first.
+func listArchive(dir, prefix string) ([]archivedFile, error) {
+	var files []archivedFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		if !strings.HasPrefix(name, prefix+"-") || !strings.HasSuffix(name, ".pb.gz") {
+			return nil
+		}
+		t, err := time.Parse(archiveTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix+"-"), ".pb.gz"))
+		if err != nil {
+			return nil
+		}
+		files = append(files, archivedFile{path: path, t: t})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].t.Before(files[j].t)
+	})
+	return files, nil
+}
+
+func readGzipFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
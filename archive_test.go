@@ -0,0 +1,101 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestArchiver(t *testing.T) {
+	dir := t.TempDir()
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	archiver := NewArchiver(c, dir, "gtfsrt", WithArchiveRetention(time.Hour), WithArchiveMaxFiles(2))
+
+	for _, feed := range []string{"feed1", "feed2", "feed3"} {
+		if err := archiver.Publish(context.Background(), []byte(feed)); err != nil {
+			t.Fatalf("Publish() err got=%v, want=<nil>", err)
+		}
+		c.Add(30 * time.Minute)
+	}
+
+	gotFeeds := readArchive(t, dir)
+	wantFeeds := map[string]string{
+		"2023-02-26/gtfsrt-20230226T104000.000Z.pb.gz": "feed2",
+		"2023-02-26/gtfsrt-20230226T111000.000Z.pb.gz": "feed3",
+	}
+	if diff := cmp.Diff(wantFeeds, gotFeeds); diff != "" {
+		t.Errorf("archive got != want, diff=%s", diff)
+	}
+
+	// Only feed3 is within the hour retention.
+	c.Add(30 * time.Minute)
+	if err := archiver.Publish(context.Background(), []byte("feed4")); err != nil {
+		t.Fatalf("Publish() err got=%v, want=<nil>", err)
+	}
+	var gotNames []string
+	for name := range readArchive(t, dir) {
+		gotNames = append(gotNames, name)
+	}
+	sort.Strings(gotNames)
+	wantNames := []string{
+		"2023-02-26/gtfsrt-20230226T111000.000Z.pb.gz",
+		"2023-02-26/gtfsrt-20230226T121000.000Z.pb.gz",
+	}
+	if diff := cmp.Diff(wantNames, gotNames); diff != "" {
+		t.Errorf("archive got != want, diff=%s", diff)
+	}
+}
+
+func TestArchiverRotatesExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	if err := NewArchiver(c, dir, "gtfsrt").Publish(context.Background(), []byte("feed1")); err != nil {
+		t.Fatalf("Publish() err got=%v, want=<nil>", err)
+	}
+
+	// After a restart, the files archived before are rotated too.
+	c.Add(time.Minute)
+	archiver := NewArchiver(c, dir, "gtfsrt", WithArchiveMaxFiles(1))
+	for _, feed := range []string{"feed2", "feed3"} {
+		if err := archiver.Publish(context.Background(), []byte(feed)); err != nil {
+			t.Fatalf("Publish() err got=%v, want=<nil>", err)
+		}
+		c.Add(time.Minute)
+	}
+
+	gotFeeds := readArchive(t, dir)
+	wantFeeds := map[string]string{
+		"2023-02-26/gtfsrt-20230226T101200.000Z.pb.gz": "feed3",
+	}
+	if diff := cmp.Diff(wantFeeds, gotFeeds); diff != "" {
+		t.Errorf("archive got != want, diff=%s", diff)
+	}
+}
+
+func readArchive(t *testing.T, dir string) map[string]string {
+	feeds := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := readGzipFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		feeds[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	return feeds
+}
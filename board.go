@@ -0,0 +1,171 @@
+package pathgtfsrt
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+var boardTemplate = template.Must(template.New("board").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.RefreshSeconds}}">
+<title>{{.StationName}} - PATH departures</title>
+</head>
+<body>
+<div style="width: 600px; margin: 10px auto;">
+	<h1>{{.StationName}}</h1>
+	{{if .Trains}}
+	<table style="width: 100%;">
+		<tr><th align="left">Route</th><th align="left">Direction</th><th align="right">Minutes</th></tr>
+		{{range .Trains}}
+		<tr><td>{{.Route}}</td><td>{{.Direction}}</td><td align="right">{{.MinutesAway}}</td></tr>
+		{{end}}
+	</table>
+	{{else}}
+	<p>No upcoming trains.</p>
+	{{end}}
+</div>
+</body>
+</html>
+`))
+
+var boardIndexTemplate = template.Must(template.New("boardIndex").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>PATH departures</title>
+</head>
+<body>
+<div style="width: 600px; margin: 10px auto;">
+	<h1>PATH departures</h1>
+	<ul>
+		{{range .}}
+		<li><a href="./{{.Path}}">{{.Name}}</a></li>
+		{{end}}
+	</ul>
+</div>
+</body>
+</html>
+`))
+
+type boardTrain struct {
+	Route       string
+	Direction   string
+	MinutesAway int64
+}
+
+type boardPage struct {
+	StationName    string
+	RefreshSeconds int
+	Trains         []boardTrain
+}
+
+type boardStation struct {
+	Path string
+	Name string
+}
+
+// BoardHandler returns a handler that renders a human-readable departure board for a station
+// from the most recent data. The handler should be mounted at a path ending in a slash, like
+// /board/; the station is the last element of the request path and is either the source API
+// station name, like hoboken, or the station's GTFS stop ID. Requesting the mount path itself
+// lists all stations.
+//
+// Each upcoming train is shown with its route, direction and the number of whole minutes until
+// it arrives. Trains that have already arrived are omitted. The page refreshes itself at the
+// feed's update period.
+func (f *Feed) BoardHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if name == "" {
+			var stations []boardStation
+			for _, station := range f.staticData.stations {
+				stations = append(stations, boardStation{
+					Path: strings.ToLower(station.String()),
+					Name: stationName(station),
+				})
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			boardIndexTemplate.Execute(w, stations)
+			return
+		}
+		station, ok := f.lookupStation(name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		page := boardPage{
+			StationName:    stationName(station),
+			RefreshSeconds: int(f.getUpdatePeriod().Seconds()),
+			Trains:         buildBoardTrains(f.get().trains[station], f.clock.Now()),
+		}
+		if page.RefreshSeconds < 1 {
+			page.RefreshSeconds = 1
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		boardTemplate.Execute(w, page)
+	})
+}
+
+// Finds the station with the given source API name (case insensitive) or GTFS stop ID.
+func (f *Feed) lookupStation(name string) (sourceapi.Station, bool) {
+	for _, station := range f.staticData.stations {
+		if strings.EqualFold(station.String(), name) || f.staticData.stationToStopId[station] == name {
+			return station, true
+		}
+	}
+	return sourceapi.Station_STATION_UNSPECIFIED, false
+}
+
+// Returns the display name of a station, falling back to the source API name if the station is
+// not in the built-in snapshot.
+func stationName(station sourceapi.Station) string {
+	if info, ok := sourceStationToStationInfo[station]; ok {
+		return info.name
+	}
+	return station.String()
+}
+
+func buildBoardTrains(trains []Train, now time.Time) []boardTrain {
+	var result []boardTrain
+	for _, train := range upcomingTrains(trains, now) {
+		route := train.Route.String()
+		if info, ok := sourceRouteToRouteInfo[train.Route]; ok {
+			route = info.name
+		}
+		direction := train.Direction.String()
+		switch train.Direction {
+		case sourceapi.Direction_TO_NY:
+			direction = "To New York"
+		case sourceapi.Direction_TO_NJ:
+			direction = "To New Jersey"
+		}
+		result = append(result, boardTrain{
+			Route:       route,
+			Direction:   direction,
+			MinutesAway: int64(train.ProjectedArrival.AsTime().Sub(now) / time.Minute),
+		})
+	}
+	return result
+}
+
+// Returns the trains that have not yet arrived, ordered by projected arrival.
+func upcomingTrains(trains []Train, now time.Time) []Train {
+	var result []Train
+	for _, train := range trains {
+		if train.ProjectedArrival == nil || train.ProjectedArrival.AsTime().Before(now) {
+			continue
+		}
+		result = append(result, train)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ProjectedArrival.AsTime().Before(result[j].ProjectedArrival.AsTime())
+	})
+	return result
+}
@@ -0,0 +1,69 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestBuildBoardTrains(t *testing.T) {
+	trains := []Train{
+		sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+		sourceTrain(sourceapi.Route_HOB_WTC, sourceapi.Direction_TO_NJ, 12, 5),
+		// This train has already arrived.
+		sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 5, 5),
+	}
+
+	got := buildBoardTrains(trains, makeTime(10).Add(30*time.Second))
+
+	want := []boardTrain{
+		{Route: "Hoboken - World Trade Center", Direction: "To New Jersey", MinutesAway: 1},
+		{Route: "Hoboken - 33rd Street", Direction: "To New York", MinutesAway: 4},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("buildBoardTrains() got != want, diff=%s", diff)
+	}
+}
+
+func TestFeedBoardHandler(t *testing.T) {
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+		},
+	})
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	for _, tc := range []struct {
+		target       string
+		wantCode     int
+		wantContains string
+	}{
+		{"/board/", http.StatusOK, `<a href="./hoboken">Hoboken</a>`},
+		{"/board/hoboken", http.StatusOK, "<td>Hoboken - 33rd Street</td><td>To New York</td><td align=\"right\">5</td>"},
+		{"/board/" + stopIDHoboken, http.StatusOK, "<h1>Hoboken</h1>"},
+		{"/board/newark", http.StatusNotFound, ""},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			f.BoardHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if w.Code != tc.wantCode {
+				t.Fatalf("status code got=%d, want=%d", w.Code, tc.wantCode)
+			}
+			if !strings.Contains(w.Body.String(), tc.wantContains) {
+				t.Errorf("body got=%s, want to contain %s", w.Body.String(), tc.wantContains)
+			}
+		})
+	}
+}
@@ -1,130 +1,1663 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/subtle"
 	_ "embed"
+	"encoding/json"
+	"expvar"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	pathgtfsrt "github.com/jamespfennell/path-train-gtfs-realtime"
 	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
 )
 
 //go:embed index.html
 var indexHTMLPage string
 
-var port = flag.Int("port", 8080, "the port to bind the HTTP server to")
-var updatePeriod = flag.Duration("update_period", 5*time.Second, "how often to update the feed")
-var timeoutPeriod = flag.Duration("timeout_period", 5*time.Second, "maximum duration to wait for a response from the source API")
-var useHTTPSourceAPI = flag.Bool("use_http_source_api", false, "use the HTTP source API instead of the default gRPC API")
-var usePanynjAPI = flag.Bool("use_panynj_api", false, "use the Panynj API instead of the default path-data API")
+// The config file, a flag of every subcommand; see loadConfigFile.
+var configFile string
+
+// The format of the HTTP access log, a flag of the serve and replica subcommands; see
+// newAccessLogger.
+var accessLog string
+
+// The address of the debug server, a flag of the serve and replica subcommands; see
+// startDebugServer.
+var debugAddress string
+
+// Flags of the serve subcommand.
+var serveFlags = flag.NewFlagSet("serve", flag.ExitOnError)
+var port = serveFlags.Int("port", 8080, "the port to bind the HTTP server to")
+var grpcPort = serveFlags.Int("grpc_port", 0, "the port to bind the gRPC feed server to; if 0, the gRPC server is disabled")
+var updatePeriod = serveFlags.Duration("update_period", 5*time.Second, "how often to update the feed")
+var logUpdatePhaseDurations = serveFlags.Bool("log_update_phase_durations", false, "log how long each phase of each update takes")
+var persistDir = serveFlags.String("persist_dir", "", "if set, persist the feeds in this directory after every update and serve them at start up until the first update completes")
+var persistMaxAge = serveFlags.Duration("persist_max_age", 10*time.Minute, "the maximum age of persisted feeds that are served at start up")
+var redisURL = serveFlags.String("redis_url", "", "if set, store the feeds in Redis after every update so that replicas can serve them; e.g., redis://localhost:6379")
+var redisKeyPrefix = serveFlags.String("redis_key_prefix", "pathgtfsrt:", "the prefix of the Redis keys the feeds are stored under")
+var redisTTL = serveFlags.Duration("redis_ttl", time.Minute, "how long feeds stored in Redis remain if they are not updated; 0 for no expiry")
+var leaderElection = serveFlags.Bool("leader_election", false, "only poll the source API if elected leader using --redis_url; until then, serve the feeds stored in Redis by the leader")
+var leaderLeaseDuration = serveFlags.Duration("leader_lease_duration", 15*time.Second, "how long the leader lease lasts if the leader stops renewing it")
+var staticDataMaxWait = serveFlags.Duration("static_data_max_wait", 5*time.Minute, "how long to keep retrying to get the static data from the source API at start up before exiting")
+var maxStaleness = serveFlags.Duration("max_staleness", 0, "if set, respond to feed requests with 503 Service Unavailable once the most recent fresh data from the source API is older than this")
+var snapshotHistory = serveFlags.Int("snapshot_history", 10, "the number of recent versions of the feed served at /gtfsrt/snapshots/")
+var differentialIncrementality = serveFlags.Bool("differential_incrementality", false, "serve the feed at /gtfsrt in DIFFERENTIAL mode")
+var outputFile = serveFlags.String("output_file", "", "if set, write the feed served at /gtfsrt to this path after every update")
+var uploadEndpoint = serveFlags.String("upload_endpoint", "https://s3.amazonaws.com", "the S3-compatible object store to upload feeds to; e.g., https://storage.googleapis.com for Google Cloud Storage")
+var uploadRegion = serveFlags.String("upload_region", "us-east-1", "the region of the object store bucket; use auto for Google Cloud Storage")
+var uploadBucket = serveFlags.String("upload_bucket", "", "if set, upload the feeds to this bucket after every update; credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+var uploadAccessKeyID = serveFlags.String("upload_access_key_id", "", "the access key ID used to upload feeds; if empty, it is read from AWS_ACCESS_KEY_ID")
+var uploadSecretAccessKey = serveFlags.String("upload_secret_access_key", "", "the secret access key used to upload feeds; if empty, it is read from AWS_SECRET_ACCESS_KEY")
+var uploadKey = serveFlags.String("upload_key", "gtfsrt", "the object key of the uploaded trip updates feed")
+var uploadVehiclePositionsKey = serveFlags.String("upload_vehicle_positions_key", "", "if set, also upload the vehicle positions feed with this object key")
+var uploadCacheControl = serveFlags.String("upload_cache_control", "", "the Cache-Control of uploaded feeds; e.g., max-age=5")
+var uploadContentType = serveFlags.String("upload_content_type", "", "the Content-Type of uploaded feeds; if empty, application/x-protobuf")
+var pushURL = serveFlags.String("push_url", "", "if set, POST the trip updates feed to this URL after every update")
+var pushRetries = serveFlags.Int("push_retries", 3, "how many times to retry a failed push")
+var pushHeaders []string
+var natsURL = serveFlags.String("nats_url", "", "if set, publish the trip updates feed to the NATS server at this URL after every update; e.g., nats://localhost:4222")
+var natsSubject = serveFlags.String("nats_subject", "path.gtfsrt", "the NATS subject to publish the full trip updates feed to; empty to disable")
+var natsDifferentialSubject = serveFlags.String("nats_differential_subject", "", "if set, also publish only the changed entities of each update, as a DIFFERENTIAL feed, to this NATS subject")
+var archiveDir = serveFlags.String("archive_dir", "", "if set, write every version of the feeds to gzip-compressed files in this directory")
+var archiveRetention = serveFlags.Duration("archive_retention", 0, "delete archived files older than this; 0 to keep them forever")
+var archiveMaxFiles = serveFlags.Int("archive_max_files", 0, "the maximum number of archived files to keep per feed; 0 for no limit")
+var livenessTimeout = serveFlags.Duration("liveness_timeout", time.Minute, "how long an update may take beyond the update period before /healthz reports the update loop as stuck")
+var readinessMaxAge = serveFlags.Duration("readiness_max_age", time.Minute, "how old the most recent fresh data from the source API may be before /readyz reports not ready")
+var adminToken = serveFlags.String("admin_token", "", "if set, serve the admin endpoints under /admin/, which require this token as an Authorization: Bearer header")
+var graphqlEndpoint = serveFlags.Bool("graphql", false, "serve GraphQL queries about upcoming trains at /graphql")
+
+// Flags of the fetch, validate, selftest, diff, replica and replay subcommands.
+var fetchFlags = flag.NewFlagSet("fetch", flag.ExitOnError)
+var fetchOut = fetchFlags.String("out", "", "the file to write the feed to; if empty, the feed is written to stdout")
+var validateFlags = flag.NewFlagSet("validate", flag.ExitOnError)
+var selftestFlags = flag.NewFlagSet("selftest", flag.ExitOnError)
+var diffFlags = flag.NewFlagSet("diff", flag.ExitOnError)
+var diffJSON = diffFlags.Bool("json", false, "print the differences as JSON")
+var replicaFlags = flag.NewFlagSet("replica", flag.ExitOnError)
+var replicaPort = replicaFlags.Int("port", 8080, "the port to serve the feeds on")
+var replicaGrpcAddress = replicaFlags.String("grpc_address", "", "if set, receive the feeds from the gRPC feed server at this address, e.g. poller:9090, instead of from Redis")
+var replicaRedisURL = replicaFlags.String("redis_url", "redis://localhost:6379", "the Redis server that the feeds are stored in")
+var replicaRedisKeyPrefix = replicaFlags.String("redis_key_prefix", "pathgtfsrt:", "the prefix of the Redis keys the feeds are stored under")
+var replicaUpdatePeriod = replicaFlags.Duration("update_period", 5*time.Second, "how often to read the feeds from Redis")
+var replicaTimeoutPeriod = replicaFlags.Duration("timeout_period", 5*time.Second, "maximum duration to wait for a response from Redis")
+var replayFlags = flag.NewFlagSet("replay", flag.ExitOnError)
+var replayPort = replayFlags.Int("port", 8080, "the port to serve the replayed feeds on")
+var replaySpeed = replayFlags.Float64("speed", 1, "how many times faster than real time to replay the feeds")
+var replayLoop = replayFlags.Bool("loop", false, "restart the replay from the beginning once it reaches the end")
+
+// Flags shared by the subcommands that build the feed; see registerFeedFlags.
+var timeoutPeriod time.Duration
+var useHTTPSourceAPI bool
+var usePanynjAPI bool
+var userAgent string
+var staticGtfs string
+var routePatterns string
+var deriveRoutePatterns bool
+var stitchTrips bool
+var departures bool
+var defaultDwell time.Duration
+var stopDwells string
+var platformStopIDs string
+var scheduleRelationship string
+var gtfsRealtimeVersion string
+var rawRouteCodesInTripIDs bool
+var recordDir string
+var sourceAPIURL string
+
+func registerFeedFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&timeoutPeriod, "timeout_period", 5*time.Second, "maximum duration to wait for a response from the source API")
+	fs.BoolVar(&useHTTPSourceAPI, "use_http_source_api", false, "use the HTTP source API instead of the default gRPC API")
+	fs.BoolVar(&usePanynjAPI, "use_panynj_api", false, "use the Panynj API instead of the default path-data API")
+	fs.StringVar(&userAgent, "user_agent", pathgtfsrt.DefaultUserAgent(), "the User-Agent header to send to the HTTP source APIs")
+	fs.StringVar(&staticGtfs, "static_gtfs", "", "path or URL of a static GTFS zip to match realtime arrivals against")
+	fs.StringVar(&routePatterns, "route_patterns", "", "path of a JSON file of route patterns used to predict arrivals at downstream stations")
+	fs.BoolVar(&deriveRoutePatterns, "derive_route_patterns", false, "derive route patterns from the static GTFS to predict arrivals at downstream stations")
+	fs.BoolVar(&stitchTrips, "stitch_trips", false, "merge arrivals of the same train at multiple stations into one trip; requires route patterns")
+	fs.BoolVar(&departures, "departures", false, "set departure times on stop time updates using dwell times")
+	fs.DurationVar(&defaultDwell, "default_dwell", 0, "the dwell time used for departure times at stops without a stop-specific dwell time")
+	fs.StringVar(&stopDwells, "stop_dwells", "", "comma-separated stop-specific dwell times used for departure times; e.g., 26730=30s,26734=1m")
+	fs.StringVar(&platformStopIDs, "platform_stop_ids", "", "comma-separated platform-level stop IDs used instead of the station's stop ID for trains of a route and direction; e.g., JOURNAL_SQUARE/JSQ_33/TO_NY=26731N")
+	fs.StringVar(&scheduleRelationship, "schedule_relationship", "", "if set, the schedule relationship of trips not matched to the static GTFS (UNSCHEDULED or ADDED); matched trips are SCHEDULED")
+	fs.StringVar(&gtfsRealtimeVersion, "gtfs_realtime_version", pathgtfsrt.DefaultGtfsRealtimeVersion, "the GTFS realtime version in feed headers: 2.0, 1.0 or 0.2; use 0.2 for consumers pinned to the old version")
+	fs.BoolVar(&rawRouteCodesInTripIDs, "raw_route_codes_in_trip_ids", false, "prefix trip IDs with the source API route code, for debugging")
+	fs.StringVar(&sourceAPIURL, "source_api_url", "", "if set, request the source API from this URL instead of the public API: the base URL of the HTTP API, the URL of the PANYNJ JSON file, or the host:port of the gRPC API")
+	fs.StringVar(&recordDir, "record_dir", "", "if set, write every raw response from the source API to a file in this directory")
+}
 
 const (
 	minPanynjUpdatePeriod = 15 * time.Second
 )
 
-var numUpdatesCounter = promauto.NewCounter(
-	prometheus.CounterOpts{
-		Name: "path_train_gtfsrt_num_updates",
-		Help: "Number of completed updates",
-	},
-)
-var numRequestErrs = promauto.NewCounter(
+var numRequestsCounter = promauto.NewCounterVec(
 	prometheus.CounterOpts{
-		Name: "path_train_gtfsrt_num_source_api_errors",
-		Help: "Number of errors when retrieving realtime data from the source API",
-	},
-)
-var lastUpdateGauge = promauto.NewGauge(
-	prometheus.GaugeOpts{
-		Name: "path_train_gtfsrt_last_update",
-		Help: "Time of the last completed update",
+		Name: "path_train_gtfsrt_num_requests",
+		Help: "Number of times the GTFS-RT feed has been requested",
 	},
+	[]string{"code"},
 )
-var numTripStopTimesGauge = promauto.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "path_train_gtfsrt_num_trip_stop_times",
-		Help: "Number of trip stop times per station and direction",
+
+var sourceRequestDurationHistogram = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "path_train_gtfsrt_source_request_duration_seconds",
+		Help: "Duration of requests for the upcoming trains at a station to the source API, by source API type and station",
 	},
-	[]string{"stop_id", "direction"},
+	[]string{"source", "station"},
 )
-var numRequestsCounter = promauto.NewCounterVec(
+
+var sourceRequestErrsCounter = promauto.NewCounterVec(
 	prometheus.CounterOpts{
-		Name: "path_train_gtfsrt_num_requests",
-		Help: "Number of times the GTFS-RT feed has been requested",
+		Name: "path_train_gtfsrt_source_request_errors",
+		Help: "Number of failed requests for the upcoming trains at a station to the source API, by source API type and station",
 	},
-	[]string{"code"},
+	[]string{"source", "station"},
 )
 
+// Counters of the trip updates feed published at /debug/vars on the debug server, for environments
+// that scrape expvar rather than Prometheus. The expvar package also publishes the memory
+// statistics as memstats.
+var numUpdatesVar = expvar.NewInt("updates")
+var numRequestErrsVar = expvar.NewInt("source_api_errors")
+var numEntitiesVar = expvar.NewInt("entities")
+var lastUpdateVar = expvar.NewInt("last_update_unix")
+
+// A subcommand of the binary.
+type subcommand struct {
+	flags       *flag.FlagSet
+	description string
+	run         func(ctx context.Context, args []string) error
+}
+
+// The shared feed flags are registered before main runs so that tests of the config file can set
+// them.
+func init() {
+	registerFeedFlags(serveFlags)
+	registerFeedFlags(fetchFlags)
+	registerFeedFlags(selftestFlags)
+}
+
 func main() {
-	flag.Parse()
-	if err := run(context.Background()); err != nil {
+	serveFlags.Func("push_header", "a header to send when pushing the feed, as Name: value; may be repeated, and $VARIABLES are expanded from the environment", func(s string) error {
+		if !strings.Contains(s, ":") {
+			return fmt.Errorf("header %q is not of the form Name: value", s)
+		}
+		pushHeaders = append(pushHeaders, s)
+		return nil
+	})
+	for _, fs := range []*flag.FlagSet{serveFlags, replicaFlags} {
+		fs.StringVar(&accessLog, "access_log", "", "if set, log every HTTP request to stdout in this format: common (the Common Log Format followed by the latency in seconds) or json")
+		fs.StringVar(&debugAddress, "debug_address", "", "if set, serve the net/http/pprof profiles at /debug/pprof/ and expvar statistics at /debug/vars on this address, separately from the feeds; e.g., localhost:6060")
+	}
+	subcommands := map[string]subcommand{
+		"serve":    {serveFlags, "run the HTTP server (the default if no subcommand is given)", serve},
+		"fetch":    {fetchFlags, "build the feed once, write it to stdout or a file and exit", fetch},
+		"validate": {validateFlags, "check a GTFS realtime protobuf file (or - for stdin) for common problems", validate},
+		"selftest": {selftestFlags, "build the feed once from the source API and check it for common problems", selftest},
+		"diff":     {diffFlags, "print the entities added, removed and changed between two GTFS realtime protobuf files", diff},
+		"replica":  {replicaFlags, "serve feeds built by another server, received using Redis or gRPC, without polling the source API", replica},
+		"replay":   {replayFlags, "serve feeds archived with --archive_dir as if they were being generated live", replay},
+	}
+	args := os.Args[1:]
+	name := "serve"
+	// For backwards compatibility, the binary runs the server if the first argument is a flag.
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	c, ok := subcommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown subcommand %q. Usage: pathgtfsrt <subcommand> [flags]\n\nSubcommands:\n", name)
+		for _, name := range []string{"serve", "fetch", "validate", "selftest", "diff", "replica", "replay"} {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, subcommands[name].description)
+		}
+		fmt.Fprintln(os.Stderr, "\nRun pathgtfsrt <subcommand> --help for the flags of each subcommand.")
+		os.Exit(2)
+	}
+	for _, c := range subcommands {
+		c.flags.StringVar(&configFile, "config", "", "a YAML file of flag values; flags on the command line take precedence. "+
+			"When serve receives SIGHUP the file is re-read and changes to "+strings.Join(reloadableFlagNames(), ", ")+
+			" are applied; changes to all other flags, such as the flags that enable feeds, take effect after a restart")
+	}
+	c.flags.Parse(args)
+	if configFile != "" {
+		if err := loadConfigFile(c.flags); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if err := c.run(context.Background(), c.flags.Args()); err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context) error {
-	var sourceClient pathgtfsrt.SourceClient
-	if *usePanynjAPI {
-		fmt.Println("Source API: PANYNJ")
-		httpClient := &http.Client{Timeout: *timeoutPeriod}
-		sourceClient = pathgtfsrt.NewPaNyNjSourceClient(httpClient, clock.New())
-		// Update duration should not exceed 15 seconds
-		if *updatePeriod < minPanynjUpdatePeriod {
-			fmt.Printf("Update period too short for Panynj API; setting to %f seconds\n", minPanynjUpdatePeriod.Seconds())
+func newSourceClient(log io.Writer) (pathgtfsrt.SourceClient, func(), error) {
+	var recorder *pathgtfsrt.Recorder
+	if recordDir != "" {
+		fmt.Fprintln(log, "Recording source API responses to", recordDir)
+		recorder = pathgtfsrt.NewRecorder(clock.New(), recordDir, pathgtfsrt.WithRecorderLogOutput(log))
+	}
+	sourceTimeoutPeriod.Store(int64(timeoutPeriod))
+	var httpClient pathgtfsrt.HttpClient = sourceHttpClient{}
+	if recorder != nil {
+		httpClient = recorder.HttpClient(httpClient)
+	}
+	sourceOpts := []pathgtfsrt.SourceClientOption{pathgtfsrt.WithUserAgent(userAgent)}
+	if sourceAPIURL != "" {
+		fmt.Fprintln(log, "Source API URL:", sourceAPIURL)
+		sourceOpts = append(sourceOpts, pathgtfsrt.WithSourceApiUrl(sourceAPIURL))
+	}
+	if usePanynjAPI {
+		fmt.Fprintln(log, "Source API: PANYNJ")
+		return instrumentedSourceClient{pathgtfsrt.NewPaNyNjSourceClient(httpClient, clock.New(), sourceOpts...), "panynj"}, func() {}, nil
+	}
+	if useHTTPSourceAPI {
+		fmt.Fprintln(log, "Source API: HTTP")
+		return instrumentedSourceClient{pathgtfsrt.NewHttpSourceClient(httpClient, sourceOpts...), "http"}, func() {}, nil
+	}
+	fmt.Fprintln(log, "Source API: gRPC")
+	var dialOpts []grpc.DialOption
+	if recorder != nil {
+		dialOpts = append(dialOpts, recorder.GrpcDialOption())
+	}
+	var grpcClient *pathgtfsrt.GrpcSourceClient
+	var err error
+	if sourceAPIURL != "" {
+		grpcClient, err = pathgtfsrt.NewGrpcSourceClientForAddress(sourceAPIURL, timeoutPeriod, dialOpts...)
+	} else {
+		grpcClient, err = pathgtfsrt.NewGrpcSourceClient(timeoutPeriod, dialOpts...)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return instrumentedSourceClient{grpcClient, "grpc"}, func() { grpcClient.Close() }, nil
+}
+
+// The timeout of requests to the source API, as a time.Duration; set from --timeout_period when the
+// source client is created and whenever the config file is reloaded.
+var sourceTimeoutPeriod atomic.Int64
+
+// An HTTP client for the source API whose timeout is the current sourceTimeoutPeriod.
+type sourceHttpClient struct{}
+
+func (sourceHttpClient) client() *http.Client {
+	return &http.Client{Timeout: time.Duration(sourceTimeoutPeriod.Load())}
+}
+
+func (c sourceHttpClient) Get(url string) (*http.Response, error) {
+	return c.client().Get(url)
+}
+
+func (c sourceHttpClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client().Do(req)
+}
+
+// Changes the timeout of requests to the source API made by a client returned by newSourceClient.
+func setSourceTimeoutPeriod(client pathgtfsrt.SourceClient, timeout time.Duration) {
+	sourceTimeoutPeriod.Store(int64(timeout))
+	if c, ok := client.(instrumentedSourceClient); ok {
+		client = c.SourceClient
+	}
+	if c, ok := client.(*pathgtfsrt.GrpcSourceClient); ok {
+		c.SetTimeoutPeriod(timeout)
+	}
+}
+
+// A source client that records the latency and errors of the requests for the upcoming trains at
+// each station in Prometheus metrics, labelled with the type of source API.
+type instrumentedSourceClient struct {
+	pathgtfsrt.SourceClient
+	source string
+}
+
+func (c instrumentedSourceClient) GetTrainsAtStation(ctx context.Context, station sourceapi.Station) ([]pathgtfsrt.Train, error) {
+	start := time.Now()
+	trains, err := c.SourceClient.GetTrainsAtStation(ctx, station)
+	sourceRequestDurationHistogram.WithLabelValues(c.source, station.String()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		sourceRequestErrsCounter.WithLabelValues(c.source, station.String()).Inc()
+	}
+	return trains, err
+}
+
+// Returns the feed options given by the shared feed flags.
+func feedOptions() ([]pathgtfsrt.FeedOption, error) {
+	if err := checkGtfsRealtimeVersion(gtfsRealtimeVersion); err != nil {
+		return nil, err
+	}
+	opts := []pathgtfsrt.FeedOption{
+		pathgtfsrt.WithGtfsRealtimeVersion(gtfsRealtimeVersion),
+	}
+	if rawRouteCodesInTripIDs {
+		opts = append(opts, pathgtfsrt.WithRawRouteCodesInTripIds())
+	}
+	var schedule *pathgtfsrt.StaticSchedule
+	if staticGtfs != "" {
+		var err error
+		schedule, err = loadStaticSchedule(staticGtfs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load static GTFS: %s", err)
+		}
+		opts = append(opts, pathgtfsrt.WithStaticSchedule(schedule))
+	}
+	if routePatterns != "" {
+		file, err := os.Open(routePatterns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open route patterns: %s", err)
+		}
+		patterns, err := pathgtfsrt.LoadRoutePatterns(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load route patterns: %s", err)
+		}
+		opts = append(opts, pathgtfsrt.WithRoutePatterns(patterns))
+	} else if deriveRoutePatterns {
+		if schedule == nil {
+			return nil, fmt.Errorf("--derive_route_patterns requires --static_gtfs")
+		}
+		opts = append(opts, pathgtfsrt.WithRoutePatterns(schedule.RoutePatterns()))
+	}
+	if stitchTrips {
+		if routePatterns == "" && !deriveRoutePatterns {
+			return nil, fmt.Errorf("--stitch_trips requires --route_patterns or --derive_route_patterns")
+		}
+		opts = append(opts, pathgtfsrt.WithTripStitching())
+	}
+	if departures {
+		stopIdToDwell, err := parseStopDwells(stopDwells)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse --stop_dwells: %s", err)
+		}
+		opts = append(opts, pathgtfsrt.WithDepartures(defaultDwell, stopIdToDwell))
+	}
+	if platformStopIDs != "" {
+		platformToStopId, err := parsePlatformStopIds(platformStopIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse --platform_stop_ids: %s", err)
+		}
+		opts = append(opts, pathgtfsrt.WithPlatformStopIds(platformToStopId))
+	}
+	if scheduleRelationship != "" {
+		relationship, err := parseScheduleRelationship(scheduleRelationship)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pathgtfsrt.WithScheduleRelationship(relationship))
+	}
+	return opts, nil
+}
+
+// Checks the value of --gtfs_realtime_version, so that a typo does not end up in the header of
+// every feed.
+func checkGtfsRealtimeVersion(version string) error {
+	switch version {
+	case "2.0", "1.0", "0.2":
+		return nil
+	}
+	return fmt.Errorf("invalid --gtfs_realtime_version %q: must be 2.0, 1.0 or 0.2", version)
+}
+
+// Parses the value of --schedule_relationship. Only the relationships that describe trips not in
+// the static schedule are accepted; matched trips are always SCHEDULED.
+func parseScheduleRelationship(s string) (gtfs.TripDescriptor_ScheduleRelationship, error) {
+	// Unknown values map to 0, which is SCHEDULED.
+	relationship := gtfs.TripDescriptor_ScheduleRelationship(gtfs.TripDescriptor_ScheduleRelationship_value[strings.ToUpper(s)])
+	if relationship != gtfs.TripDescriptor_UNSCHEDULED && relationship != gtfs.TripDescriptor_ADDED {
+		return 0, fmt.Errorf("invalid --schedule_relationship %q: must be UNSCHEDULED or ADDED", s)
+	}
+	return relationship, nil
+}
+
+func serve(ctx context.Context, args []string) error {
+	logPhaseDurations.Store(*logUpdatePhaseDurations)
+	withAccessLog, err := newAccessLogger()
+	if err != nil {
+		return err
+	}
+	if err := startDebugServer(); err != nil {
+		return err
+	}
+	var leader *leaderServer
+	if *leaderElection {
+		// The lease is released when the server is stopped, so that another instance becomes the
+		// leader without waiting for the lease to expire.
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		leader, err = followUntilLeader(ctx, withAccessLog)
+		if err != nil && ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer leader.resign()
+		// The feeds stop polling the source API if the lease is lost, since another instance may
+		// then be the leader.
+		ctx = leader.ctx
+	}
+	sourceClient, closeSourceClient, err := newSourceClient(os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer closeSourceClient()
+	// Update duration should not exceed 15 seconds
+	if usePanynjAPI && *updatePeriod < minPanynjUpdatePeriod {
+		fmt.Printf("Update period too short for Panynj API; setting to %f seconds\n", minPanynjUpdatePeriod.Seconds())
+		*updatePeriod = minPanynjUpdatePeriod
+	}
+	opts, err := feedOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, pathgtfsrt.WithStaticDataRetries(*staticDataMaxWait))
+	if *maxStaleness > 0 {
+		opts = append(opts, pathgtfsrt.WithMaxStaleness(*maxStaleness))
+	}
+	tripUpdateOpts := append(opts,
+		pathgtfsrt.WithUpdatePhaseDurationsCallback(printUpdatePhaseDurations),
+		pathgtfsrt.WithPrometheusMetrics(prometheus.DefaultRegisterer),
+		pathgtfsrt.WithSnapshotHistory(*snapshotHistory))
+	if *differentialIncrementality {
+		tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithDifferentialIncrementality())
+	}
+	if *outputFile != "" {
+		tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithFileOutput(*outputFile))
+	}
+	if *pushURL != "" {
+		var pushOpts []pathgtfsrt.HttpPublisherOption
+		for _, header := range pushHeaders {
+			name, value, _ := strings.Cut(header, ":")
+			pushOpts = append(pushOpts, pathgtfsrt.WithHttpPublisherHeader(strings.TrimSpace(name), strings.TrimSpace(os.ExpandEnv(value))))
+		}
+		pushOpts = append(pushOpts, pathgtfsrt.WithHttpPublisherRetries(*pushRetries, time.Second))
+		tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithPublisher(
+			pathgtfsrt.NewHttpPublisher(&http.Client{Timeout: timeoutPeriod}, clock.New(), *pushURL, pushOpts...)))
+	}
+	if *natsURL != "" {
+		for _, p := range []struct {
+			subject      string
+			differential bool
+		}{{*natsSubject, false}, {*natsDifferentialSubject, true}} {
+			if p.subject == "" {
+				continue
+			}
+			publisher, err := pathgtfsrt.NewNatsPublisher(*natsURL, p.subject, timeoutPeriod)
+			if err != nil {
+				return err
+			}
+			defer publisher.Close()
+			if p.differential {
+				tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithDifferentialPublisher(publisher))
+			} else {
+				tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithPublisher(publisher))
+			}
+		}
+	}
+	vehiclePositionOpts := append([]pathgtfsrt.FeedOption{}, opts...)
+	if *redisURL != "" {
+		for _, feed := range []struct {
+			opts *[]pathgtfsrt.FeedOption
+			key  string
+		}{{&tripUpdateOpts, "gtfsrt"}, {&vehiclePositionOpts, "vehicle_positions"}} {
+			publisher, err := pathgtfsrt.NewRedisPublisher(*redisURL, *redisKeyPrefix+feed.key, *redisTTL, timeoutPeriod)
+			if err != nil {
+				return err
+			}
+			defer publisher.Close()
+			*feed.opts = append(*feed.opts, pathgtfsrt.WithPublisher(publisher))
+		}
+	}
+	if *persistDir != "" {
+		if err := os.MkdirAll(*persistDir, 0755); err != nil {
+			return err
+		}
+		tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithPersistence(filepath.Join(*persistDir, "gtfsrt.pb"), *persistMaxAge))
+		vehiclePositionOpts = append(vehiclePositionOpts, pathgtfsrt.WithPersistence(filepath.Join(*persistDir, "vehicle_positions.pb"), *persistMaxAge))
+	}
+	if *uploadBucket != "" {
+		tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithPublisher(newS3Publisher(*uploadKey)))
+		if *uploadVehiclePositionsKey != "" {
+			vehiclePositionOpts = append(vehiclePositionOpts, pathgtfsrt.WithPublisher(newS3Publisher(*uploadVehiclePositionsKey)))
+		}
+	}
+	if *archiveDir != "" {
+		archiveOpts := []pathgtfsrt.ArchiverOption{
+			pathgtfsrt.WithArchiveRetention(*archiveRetention),
+			pathgtfsrt.WithArchiveMaxFiles(*archiveMaxFiles),
+		}
+		tripUpdateOpts = append(tripUpdateOpts, pathgtfsrt.WithPublisher(
+			pathgtfsrt.NewArchiver(clock.New(), *archiveDir, "gtfsrt", archiveOpts...)))
+		vehiclePositionOpts = append(vehiclePositionOpts, pathgtfsrt.WithPublisher(
+			pathgtfsrt.NewArchiver(clock.New(), *archiveDir, "vehiclepositions", archiveOpts...)))
+	}
+	f, err := pathgtfsrt.NewFeed(ctx, clock.New(), *updatePeriod, sourceClient, recordUpdate, tripUpdateOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize feed: %s", err)
+	}
+	vehiclePositionFeed, err := pathgtfsrt.NewVehiclePositionFeed(ctx, clock.New(), f, nil,
+		append(vehiclePositionOpts, pathgtfsrt.WithPrometheusMetrics(prometheus.DefaultRegisterer))...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize vehicle position feed: %s", err)
+	}
+
+	if *grpcPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+		if err != nil {
+			return fmt.Errorf("failed to bind gRPC server: %s", err)
+		}
+		grpcServer := grpc.NewServer()
+		pathgtfsrt.NewFeedServer(f, vehiclePositionFeed).Register(grpcServer)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				fmt.Printf("Warning: gRPC server stopped: %s\n", err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", rootHandler)
+	mux.Handle("/gtfsrt", promhttp.InstrumentHandlerCounter(numRequestsCounter, f))
+	mux.Handle("/gtfsrt.diff", f.DifferentialHandler())
+	mux.Handle("/gtfsrt/snapshots/", f.SnapshotsHandler())
+	mux.Handle("/gtfsrt/diff", f.DiffHandler())
+	mux.Handle("/vehicle_positions", vehiclePositionFeed)
+	mux.Handle("/events", f.EventsHandler())
+	mux.Handle("/gtfsrt.ws", f.WebSocketHandler())
+	mux.Handle("/siri/stop-monitoring", f.SiriStopMonitoringHandler())
+	mux.Handle("/board/", f.BoardHandler())
+	mux.Handle("/api/stations/", f.TrainsAPIHandler())
+	mux.Handle("/gtfs_static.zip", f.StaticGtfsHandler())
+	mux.Handle("/status.txt", f.StatusTextHandler())
+	feeds := []namedFeed{{"gtfsrt", f}, {"vehicle_positions", vehiclePositionFeed}}
+	statusHandler := serverStatusHandler(feeds)
+	mux.Handle("/status", statusHandler)
+	// The path of the status endpoint before the status of every feed was added to it.
+	mux.Handle("/status.json", statusHandler)
+	mux.Handle("/healthz", checkHandler(feeds, func(f *pathgtfsrt.Feed) error {
+		return f.CheckLive(*livenessTimeout)
+	}))
+	mux.Handle("/readyz", checkHandler(feeds, func(f *pathgtfsrt.Feed) error {
+		return f.CheckReady(*readinessMaxAge)
+	}))
+	mux.Handle("/metrics", promhttp.Handler())
+	if *graphqlEndpoint {
+		mux.Handle("/graphql", f.GraphQLHandler())
+	}
+	if *adminToken != "" {
+		mux.Handle("/admin/refresh", adminHandler(refreshHandler(feeds)))
+		mux.Handle("/admin/pause", adminHandler(pauseHandler(feeds, true)))
+		mux.Handle("/admin/resume", adminHandler(pauseHandler(feeds, false)))
+	}
+
+	if configFile != "" {
+		go reloadConfigOnSighup(ctx, sourceClient, f, vehiclePositionFeed)
+	}
+	if leader != nil {
+		// Feeds loaded from --persist_dir are likely older than the feeds the previous leader stored
+		// in Redis, so those keep being served until this instance has built its own.
+		for _, feed := range feeds {
+			select {
+			case <-feed.feed.Built():
+			case err := <-leader.serverErr:
+				return err
+			case <-ctx.Done():
+				return leader.err()
+			}
+		}
+		leader.handler.Store(mux)
+		leader.stopFollowing()
+		select {
+		case err := <-leader.serverErr:
+			return err
+		case <-ctx.Done():
+			return leader.err()
+		}
+	}
+	return http.ListenAndServe(fmt.Sprintf(":%d", *port), requestIdHandler(withAccessLog(mux)))
+}
+
+// The HTTP server of an instance running with --leader_election; see followUntilLeader.
+type leaderServer struct {
+	// Done when the server is stopped or the leader lease is lost.
+	ctx context.Context
+	// Closed if the leader lease is lost.
+	lost <-chan struct{}
+	// The handlers being served, which are replaced once this instance has built its own feeds.
+	handler *atomic.Pointer[http.ServeMux]
+	// Receives the error that stopped the server.
+	serverErr <-chan error
+	// Stops the follower from reading the feeds stored in Redis by the previous leader.
+	stopFollowing context.CancelFunc
+	// Stops renewing the leader lease and waits for it to be released.
+	resign func()
+}
+
+// Serves the feeds stored in Redis by the leader, like the replica subcommand, until this instance
+// becomes the leader. The HTTP server and the follower keep running after that: the caller
+// replaces the follower's handlers by storing its own handlers in the returned server, and then
+// stops the follower. The lease is held until the context is cancelled or the server resigns.
+func followUntilLeader(ctx context.Context, withAccessLog func(http.Handler) http.Handler) (*leaderServer, error) {
+	if *redisURL == "" {
+		return nil, fmt.Errorf("--leader_election requires --redis_url")
+	}
+	hostname, _ := os.Hostname()
+	id := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	elector, err := pathgtfsrt.NewRedisLeaderElector(clock.New(), *redisURL, *redisKeyPrefix+"leader", id, *leaderLeaseDuration, timeoutPeriod)
+	if err != nil {
+		return nil, err
+	}
+	followerCtx, stopFollowing := context.WithCancel(ctx)
+	followerMux := http.NewServeMux()
+	var redisFeeds []*pathgtfsrt.RedisFeed
+	for _, feed := range []struct {
+		key  string
+		path string
+	}{{"gtfsrt", "/gtfsrt"}, {"vehicle_positions", "/vehicle_positions"}} {
+		f, err := pathgtfsrt.NewRedisFeed(followerCtx, clock.New(), *redisURL, *redisKeyPrefix+feed.key, *updatePeriod, timeoutPeriod)
+		if err != nil {
+			stopFollowing()
+			return nil, err
+		}
+		followerMux.Handle(feed.path, f)
+		redisFeeds = append(redisFeeds, f)
+	}
+	followerMux.Handle("/metrics", promhttp.Handler())
+	// Followers do not run update loops, and are ready once the leader has stored the feeds.
+	followerMux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	followerMux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		for _, f := range redisFeeds {
+			if f.Get() == nil {
+				http.Error(w, "the leader has not stored the feeds in Redis yet", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		io.WriteString(w, "ok\n")
+	})
+	var handler atomic.Pointer[http.ServeMux]
+	handler.Store(followerMux)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- http.ListenAndServe(fmt.Sprintf(":%d", *port), requestIdHandler(withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.Load().ServeHTTP(w, r)
+		}))))
+	}()
+	fmt.Printf("Serving feeds from Redis as %s until elected leader\n", id)
+	leaderCtx, stopLeading := context.WithCancel(ctx)
+	if err := elector.Campaign(leaderCtx); err != nil {
+		stopLeading()
+		stopFollowing()
+		return nil, err
+	}
+	fmt.Println("Elected leader; polling the source API")
+	go func() {
+		select {
+		case <-elector.Lost():
+			stopLeading()
+		case <-leaderCtx.Done():
+		}
+	}()
+	return &leaderServer{
+		ctx:           leaderCtx,
+		lost:          elector.Lost(),
+		handler:       &handler,
+		serverErr:     serverErr,
+		stopFollowing: stopFollowing,
+		resign: func() {
+			stopFollowing()
+			stopLeading()
+			<-elector.Stopped()
+			fmt.Println("Released the leader lease")
+		},
+	}, nil
+}
+
+// Returns the error to exit with once the context of the server is done: an error if the leader
+// lease was lost, so that the instance is restarted as a follower, or nil if it was stopped.
+func (l *leaderServer) err() error {
+	select {
+	case <-l.lost:
+		return fmt.Errorf("lost the leader lease; stopped so that only the new leader polls the source API")
+	default:
+		return nil
+	}
+}
+
+// The settings that can be changed by editing the config file and sending SIGHUP; changes to the
+// other settings take effect after a restart.
+var reloadableFlags = map[string]bool{
+	"update_period":              true,
+	"log_update_phase_durations": true,
+	"timeout_period":             true,
+	"platform_stop_ids":          true,
+}
+
+// The settings that enable or disable feeds, publishers and endpoints. These are not reloaded
+// because the feeds are built once at start up, and adding or removing one would mean rebuilding
+// and so briefly dropping the feeds being served.
+var feedFlags = map[string]bool{
+	"grpc_port":                    true,
+	"graphql":                      true,
+	"admin_token":                  true,
+	"output_file":                  true,
+	"upload_bucket":                true,
+	"upload_vehicle_positions_key": true,
+	"push_url":                     true,
+	"nats_url":                     true,
+	"nats_subject":                 true,
+	"nats_differential_subject":    true,
+	"redis_url":                    true,
+	"archive_dir":                  true,
+}
+
+// Returns the names of the reloadable flags in alphabetical order.
+func reloadableFlagNames() []string {
+	var names []string
+	for name := range reloadableFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Whether to log update phase durations; set from --log_update_phase_durations at start up and
+// whenever the config file is reloaded.
+var logPhaseDurations atomic.Bool
+
+// The flags set on the command line, which take precedence over the config file.
+var commandLineFlags = map[string]bool{}
+
+// The values in the config file when it was last loaded, keyed by flag name. A repeated flag has
+// its values joined by newlines.
+var loadedConfig map[string]string
+
+// The flags of all subcommands, which may all be set in the same config file.
+var allFlagSets = []*flag.FlagSet{serveFlags, fetchFlags, validateFlags, selftestFlags, diffFlags, replicaFlags, replayFlags}
+
+// A flag value set in the config file.
+type configSetting struct {
+	name  string
+	value string
+}
+
+// Sets the flags of the subcommand that are in the config file and were not set on the command
+// line.
+//
+// The config file is a YAML mapping from flag names to values. Nested mappings are joined to the
+// flag name with underscores, so that related flags can be grouped; e.g., the bucket key of the
+// upload mapping sets --upload_bucket. A list sets a repeatable flag, such as push_header, once per
+// item. $VARIABLES in values are expanded from the environment, so secrets need not be stored in
+// the file.
+func loadConfigFile(fs *flag.FlagSet) error {
+	settings, err := readConfigFile(configFile, fs)
+	if err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		commandLineFlags[f.Name] = true
+	})
+	for _, setting := range settings {
+		if commandLineFlags[setting.name] {
+			continue
+		}
+		if err := fs.Set(setting.name, setting.value); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %w", configFile, setting.value, setting.name, err)
+		}
+	}
+	loadedConfig = configValues(settings)
+	fmt.Fprintln(os.Stderr, "Loaded config file", configFile)
+	return nil
+}
+
+// Reads the settings in the config file of flags of the provided flag set. Settings of flags of
+// other subcommands are skipped, and settings of flags of no subcommand are an error.
+func readConfigFile(path string, fs *flag.FlagSet) ([]configSetting, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var settings []configSetting
+	if err := flattenConfig("", config, &settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var result []configSetting
+	for _, setting := range settings {
+		if fs.Lookup(setting.name) != nil {
+			result = append(result, setting)
+			continue
+		}
+		known := false
+		for _, other := range allFlagSets {
+			known = known || other.Lookup(setting.name) != nil
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, setting.name)
+		}
+	}
+	return result, nil
+}
+
+func flattenConfig(name string, value interface{}, settings *[]configSetting) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if name != "" {
+				key = name + "_" + key
+			}
+			if err := flattenConfig(key, value[key], settings); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("setting %q: list items must be values", name)
+			}
+			if err := flattenConfig(name, item, settings); err != nil {
+				return err
+			}
+		}
+	case nil:
+		*settings = append(*settings, configSetting{name: name})
+	default:
+		*settings = append(*settings, configSetting{name: name, value: os.ExpandEnv(fmt.Sprint(value))})
+	}
+	return nil
+}
+
+func configValues(settings []configSetting) map[string]string {
+	values := map[string]string{}
+	for _, setting := range settings {
+		if previous, ok := values[setting.name]; ok {
+			values[setting.name] = previous + "\n" + setting.value
+		} else {
+			values[setting.name] = setting.value
+		}
+	}
+	return values
+}
+
+// Re-reads the config file whenever the process receives SIGHUP and applies the changes to the
+// reloadable settings to the source client and the feeds, without interrupting the feeds being
+// served.
+func reloadConfigOnSighup(ctx context.Context, sourceClient pathgtfsrt.SourceClient, feeds ...*pathgtfsrt.Feed) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+		if err := reloadConfigFile(sourceClient, feeds); err != nil {
+			fmt.Printf("Warning: failed to reload config file %s: %s\n", configFile, err)
+		}
+	}
+}
+
+func reloadConfigFile(sourceClient pathgtfsrt.SourceClient, feeds []*pathgtfsrt.Feed) error {
+	settings, err := readConfigFile(configFile, serveFlags)
+	if err != nil {
+		return err
+	}
+	values := configValues(settings)
+	changed := map[string]bool{}
+	for name := range values {
+		changed[name] = values[name] != loadedConfig[name]
+	}
+	for name := range loadedConfig {
+		if _, ok := values[name]; !ok {
+			changed[name] = true
+		}
+	}
+	for name, isChanged := range changed {
+		if !isChanged || commandLineFlags[name] {
+			continue
+		}
+		if feedFlags[name] {
+			fmt.Printf("Warning: %s enables or disables a feed, which cannot be done without dropping the feeds being served; the change in the config file takes effect after a restart\n", name)
+			continue
+		}
+		if !reloadableFlags[name] {
+			fmt.Printf("Warning: the change to %s in the config file takes effect after a restart\n", name)
+			continue
+		}
+		value, ok := values[name]
+		if !ok {
+			value = serveFlags.Lookup(name).DefValue
+		}
+		if err := serveFlags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+		}
+		fmt.Printf("Reloaded %s: %s\n", name, value)
+	}
+	loadedConfig = values
+	logPhaseDurations.Store(*logUpdatePhaseDurations)
+	if changed["update_period"] && !commandLineFlags["update_period"] {
+		if usePanynjAPI && *updatePeriod < minPanynjUpdatePeriod {
 			*updatePeriod = minPanynjUpdatePeriod
 		}
-	} else if *useHTTPSourceAPI {
-		fmt.Println("Source API: HTTP")
-		httpClient := &http.Client{Timeout: *timeoutPeriod}
-		sourceClient = pathgtfsrt.NewHttpSourceClient(httpClient)
+		for _, f := range feeds {
+			f.SetUpdatePeriod(*updatePeriod)
+		}
+	}
+	if changed["timeout_period"] && !commandLineFlags["timeout_period"] {
+		setSourceTimeoutPeriod(sourceClient, timeoutPeriod)
+	}
+	if changed["platform_stop_ids"] && !commandLineFlags["platform_stop_ids"] {
+		platformToStopId, err := parsePlatformStopIds(platformStopIDs)
+		if err != nil {
+			return fmt.Errorf("failed to parse platform_stop_ids: %w", err)
+		}
+		for _, f := range feeds {
+			f.SetPlatformStopIds(platformToStopId)
+		}
+	}
+	return nil
+}
+
+func newS3Publisher(key string) *pathgtfsrt.S3Publisher {
+	opts := []pathgtfsrt.S3PublisherOption{pathgtfsrt.WithS3Region(*uploadRegion)}
+	if *uploadCacheControl != "" {
+		opts = append(opts, pathgtfsrt.WithS3CacheControl(*uploadCacheControl))
+	}
+	if *uploadContentType != "" {
+		opts = append(opts, pathgtfsrt.WithS3ContentType(*uploadContentType))
+	}
+	accessKeyID, secretAccessKey := *uploadAccessKeyID, *uploadSecretAccessKey
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secretAccessKey == "" {
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return pathgtfsrt.NewS3Publisher(&http.Client{Timeout: timeoutPeriod}, clock.New(), *uploadEndpoint, *uploadBucket, key,
+		accessKeyID, secretAccessKey, opts...)
+}
+
+// Builds the feed once and returns it. Log output is written to stderr so that the caller can
+// write the feed to stdout.
+func buildFeedOnce(ctx context.Context) ([]byte, error) {
+	sourceClient, closeSourceClient, err := newSourceClient(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSourceClient()
+	opts, err := feedOptions()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	opts = append(opts, pathgtfsrt.WithLogOutput(os.Stderr))
+	f, err := pathgtfsrt.NewFeed(ctx, clock.New(), time.Hour, sourceClient, nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build feed: %s", err)
+	}
+	return f.Get(), nil
+}
+
+func fetch(ctx context.Context, args []string) error {
+	b, err := buildFeedOnce(ctx)
+	if err != nil {
+		return err
+	}
+	if *fetchOut != "" {
+		return os.WriteFile(*fetchOut, b, 0644)
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+func validate(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: pathgtfsrt validate <path or ->")
+	}
+	var b []byte
+	var err error
+	if args[0] == "-" {
+		b, err = io.ReadAll(os.Stdin)
 	} else {
-		fmt.Println("Source API: gRPC")
-		grpcClient, err := pathgtfsrt.NewGrpcSourceClient(*timeoutPeriod)
+		b, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return validateFeed(b)
+}
+
+func selftest(ctx context.Context, args []string) error {
+	b, err := buildFeedOnce(ctx)
+	if err != nil {
+		return err
+	}
+	return validateFeed(b)
+}
+
+func diff(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: pathgtfsrt diff [--json] <from path> <to path>")
+	}
+	var msgs [2]gtfs.FeedMessage
+	for i, path := range args {
+		b, err := readFeedFile(path)
 		if err != nil {
 			return err
 		}
-		defer grpcClient.Close()
-		sourceClient = grpcClient
+		if err := proto.Unmarshal(b, &msgs[i]); err != nil {
+			return fmt.Errorf("failed to parse GTFS realtime protobuf %s: %s", path, err)
+		}
 	}
+	d := pathgtfsrt.DiffFeedMessages(&msgs[0], &msgs[1])
+	if *diffJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	fmt.Print(d.String())
+	return nil
+}
 
-	f, err := pathgtfsrt.NewFeed(ctx, clock.New(), *updatePeriod, sourceClient, recordUpdate)
+// Reads a feed from a file, decompressing it if it is gzipped, as archived feeds are.
+func readFeedFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to initialize feed: %s", err)
+		return nil, err
+	}
+	if len(b) < 2 || b[0] != 0x1f || b[1] != 0x8b {
+		return b, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
 	}
+	return io.ReadAll(r)
+}
 
-	http.HandleFunc("/", rootHandler)
-	http.Handle("/gtfsrt", promhttp.InstrumentHandlerCounter(numRequestsCounter, f))
-	http.Handle("/metrics", promhttp.Handler())
+func replica(ctx context.Context, args []string) error {
+	withAccessLog, err := newAccessLogger()
+	if err != nil {
+		return err
+	}
+	if err := startDebugServer(); err != nil {
+		return err
+	}
+	var grpcConn *grpc.ClientConn
+	if *replicaGrpcAddress != "" {
+		var err error
+		grpcConn, err = grpc.Dial(*replicaGrpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer grpcConn.Close()
+		fmt.Println("Receiving feeds from the gRPC feed server at", *replicaGrpcAddress)
+	} else {
+		fmt.Println("Reading feeds from Redis keys with prefix", *replicaRedisKeyPrefix)
+	}
+	mux := http.NewServeMux()
+	for _, feed := range []struct {
+		kind pathgtfsrt.FeedKind
+		key  string
+		path string
+	}{
+		{pathgtfsrt.TripUpdatesFeed, "gtfsrt", "/gtfsrt"},
+		{pathgtfsrt.VehiclePositionsFeed, "vehicle_positions", "/vehicle_positions"},
+	} {
+		if grpcConn != nil {
+			mux.Handle(feed.path, pathgtfsrt.NewGrpcFeed(ctx, clock.New(), grpcConn, feed.kind))
+			continue
+		}
+		f, err := pathgtfsrt.NewRedisFeed(ctx, clock.New(), *replicaRedisURL, *replicaRedisKeyPrefix+feed.key,
+			*replicaUpdatePeriod, *replicaTimeoutPeriod)
+		if err != nil {
+			return err
+		}
+		mux.Handle(feed.path, f)
+	}
+	mux.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(fmt.Sprintf(":%d", *replicaPort), requestIdHandler(withAccessLog(mux)))
+}
+
+func replay(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: pathgtfsrt replay [flags] <archive directory>")
+	}
+	opts := []pathgtfsrt.ReplayOption{pathgtfsrt.WithReplaySpeed(*replaySpeed)}
+	if *replayLoop {
+		opts = append(opts, pathgtfsrt.WithReplayLoop())
+	}
+	mux := http.NewServeMux()
+	numReplayed := 0
+	for _, feed := range []struct {
+		prefix string
+		path   string
+	}{{"gtfsrt", "/gtfsrt"}, {"vehiclepositions", "/vehicle_positions"}} {
+		archive, err := pathgtfsrt.LoadArchive(args[0], feed.prefix)
+		if err != nil {
+			return err
+		}
+		if len(archive) == 0 {
+			continue
+		}
+		f, err := pathgtfsrt.NewReplayFeed(clock.New(), archive, opts...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Replaying %d feeds archived between %s and %s at %s\n", len(archive),
+			archive[0].Time.Format(time.RFC3339), archive[len(archive)-1].Time.Format(time.RFC3339), feed.path)
+		mux.Handle(feed.path, f)
+		numReplayed++
+	}
+	if numReplayed == 0 {
+		return fmt.Errorf("no archived feeds found in %s", args[0])
+	}
+	return http.ListenAndServe(fmt.Sprintf(":%d", *replayPort), mux)
+}
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", *port), nil)
+func validateFeed(b []byte) error {
+	var msg gtfs.FeedMessage
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return fmt.Errorf("failed to parse GTFS realtime protobuf: %s", err)
+	}
+	errs := pathgtfsrt.ValidateFeedMessage(&msg)
+	for _, err := range errs {
+		fmt.Println("Problem:", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("found %d problems in feed with %d entities", len(errs), len(msg.GetEntity()))
+	}
+	fmt.Printf("OK: feed with %d entities\n", len(msg.GetEntity()))
+	return nil
 }
 
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, indexHTMLPage, pathgtfsrt.BuildNumber)
+func loadStaticSchedule(location string) (*pathgtfsrt.StaticSchedule, error) {
+	var b []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		httpClient := &http.Client{Timeout: timeoutPeriod}
+		var resp *http.Response
+		resp, err = httpClient.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		b, err = io.ReadAll(resp.Body)
+	} else {
+		b, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pathgtfsrt.LoadStaticSchedule(bytes.NewReader(b), int64(len(b)))
+}
+
+func parseStopDwells(s string) (map[string]time.Duration, error) {
+	stopIdToDwell := map[string]time.Duration{}
+	if s == "" {
+		return stopIdToDwell, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		stopId, rawDwell, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid stop dwell %q", pair)
+		}
+		dwell, err := time.ParseDuration(rawDwell)
+		if err != nil {
+			return nil, err
+		}
+		stopIdToDwell[strings.TrimSpace(stopId)] = dwell
+	}
+	return stopIdToDwell, nil
+}
+
+// Parses the value of --platform_stop_ids: comma-separated <station>/<route>/<direction>=<stop ID>
+// pairs, where the station, route and direction are source API names.
+func parsePlatformStopIds(s string) (map[pathgtfsrt.Platform]string, error) {
+	platformToStopId := map[pathgtfsrt.Platform]string{}
+	if s == "" {
+		return platformToStopId, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		rawPlatform, stopId, ok := strings.Cut(pair, "=")
+		parts := strings.Split(strings.TrimSpace(rawPlatform), "/")
+		if !ok || len(parts) != 3 {
+			return nil, fmt.Errorf("invalid platform stop ID %q", pair)
+		}
+		station, ok := sourceapi.Station_value[strings.ToUpper(parts[0])]
+		if !ok {
+			return nil, fmt.Errorf("unknown station %q", parts[0])
+		}
+		route, ok := sourceapi.Route_value[strings.ToUpper(parts[1])]
+		if !ok {
+			return nil, fmt.Errorf("unknown route %q", parts[1])
+		}
+		direction, ok := sourceapi.Direction_value[strings.ToUpper(parts[2])]
+		if !ok {
+			return nil, fmt.Errorf("unknown direction %q", parts[2])
+		}
+		platform := pathgtfsrt.Platform{
+			Station:   sourceapi.Station(station),
+			Route:     sourceapi.Route(route),
+			Direction: sourceapi.Direction(direction),
+		}
+		platformToStopId[platform] = strings.TrimSpace(stopId)
+	}
+	return platformToStopId, nil
+}
+
+// Responds with 200 OK if the check passes for every feed, and 503 Service Unavailable with the
+// failures otherwise.
+func checkHandler(feeds []namedFeed, check func(*pathgtfsrt.Feed) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var failures []string
+		for _, feed := range feeds {
+			if err := check(feed.feed); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %s", feed.name, err))
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(failures) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, strings.Join(failures, "\n")+"\n")
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+}
+
+// When the process started, for the uptime in the status endpoint.
+var startTime = time.Now()
+
+// Responds with the status of each feed and the uptime of the process, so that operators can
+// diagnose problems without Prometheus, and for the live dashboard. Requests with the admin token
+// also get the current values of the serve flags, with secrets redacted; see adminHandler.
+func serverStatusHandler(feeds []namedFeed) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := struct {
+			BuildNumber   string                            `json:"build_number"`
+			Started       string                            `json:"started"`
+			UptimeSeconds int64                             `json:"uptime_seconds"`
+			Config        map[string]string                 `json:"config,omitempty"`
+			Feeds         map[string]*pathgtfsrt.FeedStatus `json:"feeds"`
+		}{
+			BuildNumber:   pathgtfsrt.BuildNumber,
+			Started:       startTime.UTC().Format(time.RFC3339),
+			UptimeSeconds: int64(time.Since(startTime).Seconds()),
+			Feeds:         map[string]*pathgtfsrt.FeedStatus{},
+		}
+		if hasAdminToken(r) {
+			result.Config = redactedConfig(serveFlags)
+		}
+		for _, feed := range feeds {
+			result.Feeds[feed.name] = feed.feed.Status()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+	})
 }
 
-func recordUpdate(msg *gtfs.FeedMessage, errs []error) {
-	numTripStopTimesGauge.Reset()
-	for _, entity := range msg.GetEntity() {
-		directionID := "NY"
-		if entity.GetTripUpdate().GetTrip().GetDirectionId() == 0 {
-			directionID = "NJ"
+// Returns the current values of the flags, with secrets redacted: flags whose names indicate a
+// secret, passwords in URLs and the values of push headers.
+func redactedConfig(fs *flag.FlagSet) map[string]string {
+	config := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch {
+		case f.Name == "push_header":
+			var names []string
+			for _, header := range pushHeaders {
+				name, _, _ := strings.Cut(header, ":")
+				names = append(names, strings.TrimSpace(name)+": REDACTED")
+			}
+			value = strings.Join(names, "\n")
+		case value != "" && (strings.Contains(f.Name, "token") || strings.Contains(f.Name, "secret") || strings.Contains(f.Name, "access_key")):
+			value = "REDACTED"
+		case strings.Contains(value, "://"):
+			if u, err := url.Parse(value); err == nil {
+				value = u.Redacted()
+			}
 		}
-		for _, stopTimeUpdate := range entity.GetTripUpdate().GetStopTimeUpdate() {
-			stopID := stopTimeUpdate.GetStopId()
-			numTripStopTimesGauge.WithLabelValues(stopID, directionID).Inc()
+		config[f.Name] = value
+	})
+	return config
+}
+
+// A feed and the name used to select it in the admin endpoints.
+type namedFeed struct {
+	name string
+	feed *pathgtfsrt.Feed
+}
+
+// Returns whether the request has the admin token as an Authorization: Bearer header. No request
+// has it if no admin token is set.
+func hasAdminToken(r *http.Request) bool {
+	if *adminToken == "" {
+		return false
+	}
+	// The whole header is compared, so the token alone, without the Bearer scheme, is rejected.
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+*adminToken)) == 1
+}
+
+// Wraps an admin endpoint so that it only responds to POST requests with the admin token.
+func adminHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasAdminToken(r) {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "admin endpoints only accept POST requests", http.StatusMethodNotAllowed)
+			return
 		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Starts a server for debugging endpoints on --debug_address, if it is set. The endpoints are served
+// separately from the feeds so that they are not exposed to consumers. The server runs until the
+// process exits.
+func startDebugServer() error {
+	if debugAddress == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	mux.Handle("/debug/vars", expvar.Handler())
+	listener, err := net.Listen("tcp", debugAddress)
+	if err != nil {
+		return fmt.Errorf("failed to start the debug server: %w", err)
+	}
+	fmt.Println("Serving debugging endpoints on", listener.Addr())
+	go func() {
+		err := http.Serve(listener, mux)
+		fmt.Println("Warning: the debug server stopped:", err)
+	}()
+	return nil
+}
+
+// Returns a function that wraps a handler so that every request is logged to stdout after it
+// completes, in the format set by --access_log. If access logging is disabled, handlers are not
+// wrapped.
+func newAccessLogger() (func(http.Handler) http.Handler, error) {
+	var format func(r *http.Request, w *loggingResponseWriter, start time.Time, latency time.Duration) string
+	switch accessLog {
+	case "":
+		return func(h http.Handler) http.Handler { return h }, nil
+	case "common":
+		format = formatCommonLogLine
+	case "json":
+		format = formatJsonLogLine
+	default:
+		return nil, fmt.Errorf("unknown access log format %q; must be common or json", accessLog)
 	}
-	numUpdatesCounter.Inc()
-	numRequestErrs.Add(float64(len(errs)))
-	lastUpdateGauge.SetToCurrentTime()
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			lw := &loggingResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(lw, r)
+			fmt.Println(format(r, lw, start, time.Since(start)))
+		})
+	}, nil
+}
+
+// Formats a request in the Common Log Format, followed by the latency in seconds and the request ID.
+func formatCommonLogLine(r *http.Request, w *loggingResponseWriter, start time.Time, latency time.Duration) string {
+	return fmt.Sprintf("%s - - [%s] %q %d %d %.3f %s", clientIP(r), start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.URL.RequestURI()+" "+r.Proto, w.statusCode(), w.bytes, latency.Seconds(),
+		pathgtfsrt.RequestIdFromContext(r.Context()))
+}
+
+// Formats a request as a JSON object.
+func formatJsonLogLine(r *http.Request, w *loggingResponseWriter, start time.Time, latency time.Duration) string {
+	b, _ := json.Marshal(struct {
+		Time      string  `json:"time"`
+		ClientIP  string  `json:"client_ip"`
+		Method    string  `json:"method"`
+		Path      string  `json:"path"`
+		Status    int     `json:"status"`
+		Bytes     int     `json:"bytes"`
+		Latency   float64 `json:"latency_seconds"`
+		UserAgent string  `json:"user_agent,omitempty"`
+		RequestId string  `json:"request_id"`
+	}{
+		Time:      start.UTC().Format(time.RFC3339Nano),
+		ClientIP:  clientIP(r),
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Status:    w.statusCode(),
+		Bytes:     w.bytes,
+		Latency:   latency.Seconds(),
+		UserAgent: r.UserAgent(),
+		RequestId: pathgtfsrt.RequestIdFromContext(r.Context()),
+	})
+	return string(b)
+}
+
+// Wraps a handler so that each request has a request ID, which is returned in the X-Request-Id
+// response header and carried by the request's context, and so is included in the access log and
+// sent to the source API by refreshes. A valid request ID in the X-Request-Id request header, e.g.
+// from a load balancer, is reused.
+func requestIdHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(pathgtfsrt.RequestIdHeader)
+		if !validRequestId(requestId) {
+			requestId = pathgtfsrt.NewRequestId()
+		}
+		w.Header().Set(pathgtfsrt.RequestIdHeader, requestId)
+		h.ServeHTTP(w, r.WithContext(pathgtfsrt.ContextWithRequestId(r.Context(), requestId)))
+	})
+}
+
+// Returns whether a request ID from a client can be used: it is short and only contains letters,
+// digits, dots, dashes and underscores, so that it cannot corrupt the logs.
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > 64 {
+		return false
+	}
+	for _, c := range requestId {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the IP address the request was received from. Proxy headers such as X-Forwarded-For are
+// ignored, as they can be set by clients.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// A response writer that records the status and size of the response for the access log. It
+// supports flushing and hijacking, which the event stream and WebSocket handlers need.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int
+	hijacked bool
+}
+
+func (w *loggingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *loggingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking")
+	}
+	w.hijacked = true
+	return hijacker.Hijack()
+}
+
+// Returns the status of the response. Hijacked connections, which are upgraded to WebSockets, are
+// logged with 101 Switching Protocols.
+func (w *loggingResponseWriter) statusCode() int {
+	switch {
+	case w.hijacked:
+		return http.StatusSwitchingProtocols
+	case w.status == 0:
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Returns the feeds selected by the feed query parameter, or all feeds if it is not set.
+func selectFeeds(w http.ResponseWriter, r *http.Request, feeds []namedFeed) ([]namedFeed, bool) {
+	name := r.URL.Query().Get("feed")
+	if name == "" {
+		return feeds, true
+	}
+	for _, feed := range feeds {
+		if feed.name == name {
+			return []namedFeed{feed}, true
+		}
+	}
+	http.Error(w, fmt.Sprintf("unknown feed %q", name), http.StatusNotFound)
+	return nil, false
+}
+
+// Updates the feeds immediately, outside of the regular schedule, and responds once the updates
+// have completed.
+func refreshHandler(feeds []namedFeed) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selected, ok := selectFeeds(w, r, feeds)
+		if !ok {
+			return
+		}
+		var results []string
+		failed := false
+		for _, feed := range selected {
+			fmt.Printf("Refreshing %s feed at admin request\n", feed.name)
+			result, err := feed.feed.ForceUpdate(r.Context())
+			if err != nil {
+				results = append(results, fmt.Sprintf("Failed to refresh %s feed: %s", feed.name, err))
+				failed = true
+				continue
+			}
+			if n := len(result.StationErrs); n > 0 {
+				results = append(results, fmt.Sprintf("Refreshed %s feed; failed to get data for %d stations", feed.name, n))
+				continue
+			}
+			results = append(results, fmt.Sprintf("Refreshed %s feed", feed.name))
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if failed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		io.WriteString(w, strings.Join(results, "\n")+"\n")
+	})
+}
+
+// Pauses or resumes the regular updates of the feeds. While paused, the most recent feeds continue
+// to be served.
+func pauseHandler(feeds []namedFeed, pause bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selected, ok := selectFeeds(w, r, feeds)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, feed := range selected {
+			if pause {
+				feed.feed.Pause()
+				fmt.Printf("Paused updates of %s feed at admin request\n", feed.name)
+				fmt.Fprintf(w, "Paused updates of %s feed\n", feed.name)
+			} else {
+				feed.feed.Resume()
+				fmt.Printf("Resumed updates of %s feed at admin request\n", feed.name)
+				fmt.Fprintf(w, "Resumed updates of %s feed\n", feed.name)
+			}
+		}
+	})
+}
+
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, indexHTMLPage)
+}
+
+func printUpdatePhaseDurations(d pathgtfsrt.UpdatePhaseDurations) {
+	if logPhaseDurations.Load() {
+		fmt.Printf("Update phase durations: fetch=%s build=%s marshal=%s\n", d.Fetch, d.Build, d.Marshal)
+	}
+}
+
+func recordUpdate(result pathgtfsrt.UpdateResult) {
+	numUpdatesVar.Add(1)
+	numRequestErrsVar.Add(int64(len(result.StationErrs)))
+	numEntitiesVar.Set(int64(len(result.Msg.GetEntity())))
+	lastUpdateVar.Set(time.Now().Unix())
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pathgtfsrt "github.com/jamespfennell/path-train-gtfs-realtime"
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestReloadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatalf("WriteFile() err got=%v, want=<nil>", err)
+		}
+	}
+	configFile = path
+	t.Cleanup(func() {
+		configFile = ""
+		loadedConfig = nil
+		commandLineFlags = map[string]bool{}
+		logPhaseDurations.Store(false)
+		sourceTimeoutPeriod.Store(0)
+		for _, name := range []string{"update_period", "log_update_phase_durations", "timeout_period", "platform_stop_ids", "persist_max_age"} {
+			serveFlags.Set(name, serveFlags.Lookup(name).DefValue)
+		}
+	})
+
+	writeConfig("update_period: 10s\npersist_max_age: 3m\n")
+	if err := loadConfigFile(serveFlags); err != nil {
+		t.Fatalf("loadConfigFile() err got=%v, want=<nil>", err)
+	}
+	writeConfig("update_period: 20s\nlog_update_phase_durations: true\ntimeout_period: 2s\n" +
+		"platform_stop_ids: JOURNAL_SQUARE/JSQ_33/TO_NY=26731N\npersist_max_age: 9m\n")
+	if err := reloadConfigFile(nil, nil); err != nil {
+		t.Fatalf("reloadConfigFile() err got=%v, want=<nil>", err)
+	}
+
+	if *updatePeriod != 20*time.Second {
+		t.Errorf("update_period got=%s, want=%s", *updatePeriod, 20*time.Second)
+	}
+	if !logPhaseDurations.Load() {
+		t.Errorf("log_update_phase_durations got=false, want=true")
+	}
+	if got := time.Duration(sourceTimeoutPeriod.Load()); got != 2*time.Second {
+		t.Errorf("source API timeout got=%s, want=%s", got, 2*time.Second)
+	}
+	if platformStopIDs != "JOURNAL_SQUARE/JSQ_33/TO_NY=26731N" {
+		t.Errorf("platform_stop_ids got=%q, want=%q", platformStopIDs, "JOURNAL_SQUARE/JSQ_33/TO_NY=26731N")
+	}
+	// Only the reloadable flags are changed by a reload.
+	if *persistMaxAge != 3*time.Minute {
+		t.Errorf("persist_max_age got=%s, want=%s", *persistMaxAge, 3*time.Minute)
+	}
+}
+
+func TestReloadableFlagNames(t *testing.T) {
+	got := reloadableFlagNames()
+	want := []string{"log_update_phase_durations", "platform_stop_ids", "timeout_period", "update_period"}
+	if len(got) != len(want) {
+		t.Fatalf("reloadableFlagNames() got=%v, want=%v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("reloadableFlagNames() got=%v, want=%v", got, want)
+		}
+		if serveFlags.Lookup(got[i]) == nil {
+			t.Errorf("reloadable flag %s is not a serve flag", got[i])
+		}
+	}
+	for name := range feedFlags {
+		if serveFlags.Lookup(name) == nil {
+			t.Errorf("feed flag %s is not a serve flag", name)
+		}
+	}
+}
+
+func TestHasAdminToken(t *testing.T) {
+	defer func(token string) { *adminToken = token }(*adminToken)
+	*adminToken = "secret"
+	for _, tc := range []struct {
+		authorization string
+		want          bool
+	}{
+		{authorization: "Bearer secret", want: true},
+		{authorization: "secret", want: false},
+		{authorization: "Bearer wrong", want: false},
+		{authorization: "Basic secret", want: false},
+		{authorization: "", want: false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/admin/refresh", nil)
+		if tc.authorization != "" {
+			r.Header.Set("Authorization", tc.authorization)
+		}
+		if got := hasAdminToken(r); got != tc.want {
+			t.Errorf("hasAdminToken() with Authorization %q got=%t, want=%t", tc.authorization, got, tc.want)
+		}
+	}
+}
+
+func TestCheckGtfsRealtimeVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version string
+		wantErr bool
+	}{
+		{version: "2.0"},
+		{version: "1.0"},
+		{version: "0.2"},
+		{version: "2", wantErr: true},
+		{version: "3.0", wantErr: true},
+		{version: "", wantErr: true},
+	} {
+		if err := checkGtfsRealtimeVersion(tc.version); (err != nil) != tc.wantErr {
+			t.Errorf("checkGtfsRealtimeVersion(%q) err got=%v, want error=%t", tc.version, err, tc.wantErr)
+		}
+	}
+}
+
+func TestParseScheduleRelationship(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    gtfs.TripDescriptor_ScheduleRelationship
+		wantErr bool
+	}{
+		{value: "UNSCHEDULED", want: gtfs.TripDescriptor_UNSCHEDULED},
+		{value: "added", want: gtfs.TripDescriptor_ADDED},
+		{value: "SCHEDULED", wantErr: true},
+		{value: "CANCELED", wantErr: true},
+		{value: "DUPLICATED", wantErr: true},
+		{value: "unknown", wantErr: true},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parseScheduleRelationship(tc.value)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("parseScheduleRelationship(%q) err got=%v, want error=%t", tc.value, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("parseScheduleRelationship(%q) got=%s, want=%s", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParsePlatformStopIds(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    map[pathgtfsrt.Platform]string
+		wantErr bool
+	}{
+		{value: "", want: map[pathgtfsrt.Platform]string{}},
+		{
+			value: "JOURNAL_SQUARE/JSQ_33/TO_NY=26731N, hoboken/hob_33/to_nj=26730S",
+			want: map[pathgtfsrt.Platform]string{
+				{Station: sourceapi.Station_JOURNAL_SQUARE, Route: sourceapi.Route_JSQ_33, Direction: sourceapi.Direction_TO_NY}: "26731N",
+				{Station: sourceapi.Station_HOBOKEN, Route: sourceapi.Route_HOB_33, Direction: sourceapi.Direction_TO_NJ}:        "26730S",
+			},
+		},
+		{value: "JOURNAL_SQUARE/JSQ_33=26731N", wantErr: true},
+		{value: "JOURNAL_SQUARE/JSQ_33/TO_NY", wantErr: true},
+		{value: "JOURNAL_SQUARE/JSQ_33/UPTOWN=26731N", wantErr: true},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parsePlatformStopIds(tc.value)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("parsePlatformStopIds(%q) err got=%v, want error=%t", tc.value, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("parsePlatformStopIds(%q) got != want, diff=%s", tc.value, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package pathgtfsrt
+
+import (
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+// SkippedTrains contains the number of upcoming trains from the source API in an update that were
+// left out of the feed because they are missing data, by the data that is missing. A train missing
+// several fields is counted once, for the first of them in the order of the fields.
+type SkippedTrains struct {
+	// MissingRoute is the number of trains whose route has no GTFS static route ID.
+	MissingRoute int
+	// MissingDirection is the number of trains with neither the TO_NY nor the TO_NJ direction.
+	MissingDirection int
+	// MissingArrival is the number of trains without a projected arrival time.
+	MissingArrival int
+	// MissingLastUpdated is the number of trains without a last updated time.
+	MissingLastUpdated int
+}
+
+// WithSkippedTrainsCallback registers a callback that is invoked after each update with the number
+// of upcoming trains from the source API that were left out of the feed, so that silent degradation
+// of the source data can be monitored.
+func WithSkippedTrainsCallback(callback func(SkippedTrains)) FeedOption {
+	return func(o *feedOptions) {
+		o.skippedCallback = callback
+	}
+}
+
+// The data a train from the source API can be missing, which keeps it out of the feed.
+type missingTrainData int
+
+const (
+	noMissingData missingTrainData = iota
+	missingRoute
+	missingDirection
+	missingArrival
+	missingLastUpdated
+)
+
+// Returns the first data that the train is missing, or noMissingData if a trip update can be built.
+func checkTrainData(staticData staticData, train Train) missingTrainData {
+	if _, ok := staticData.routeToRouteId[train.Route]; !ok {
+		return missingRoute
+	}
+	if train.Direction != sourceapi.Direction_TO_NJ && train.Direction != sourceapi.Direction_TO_NY {
+		return missingDirection
+	}
+	if train.ProjectedArrival == nil {
+		return missingArrival
+	}
+	if train.LastUpdated == nil {
+		return missingLastUpdated
+	}
+	return noMissingData
+}
+
+// Counts the trains in the realtime data that are left out of the feed.
+func countSkippedTrains(staticData staticData, realtimeData map[sourceapi.Station][]Train) SkippedTrains {
+	var skipped SkippedTrains
+	for _, station := range staticData.stations {
+		for _, train := range realtimeData[station] {
+			switch checkTrainData(staticData, train) {
+			case missingRoute:
+				skipped.MissingRoute++
+			case missingDirection:
+				skipped.MissingDirection++
+			case missingArrival:
+				skipped.MissingArrival++
+			case missingLastUpdated:
+				skipped.MissingLastUpdated++
+			}
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,54 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedWithSkippedTrainsCallback(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			// Missing both the route and the last updated time.
+			{
+				Direction:        sourceapi.Direction_TO_NJ,
+				ProjectedArrival: makeTimestamppb(5),
+			},
+			{
+				Route:            sourceapi.Route_HOB_33,
+				ProjectedArrival: makeTimestamppb(5),
+				LastUpdated:      makeTimestamppb(10),
+			},
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			{
+				Route:       sourceapi.Route_HOB_33,
+				Direction:   sourceapi.Direction_TO_NJ,
+				LastUpdated: makeTimestamppb(10),
+			},
+			{
+				Route:            sourceapi.Route_HOB_33,
+				Direction:        sourceapi.Direction_TO_NJ,
+				ProjectedArrival: makeTimestamppb(5),
+			},
+		},
+	})
+	var got SkippedTrains
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(UpdateResult) {},
+		WithSkippedTrainsCallback(func(skipped SkippedTrains) {
+			got = skipped
+		}))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	want := SkippedTrains{MissingRoute: 1, MissingDirection: 1, MissingArrival: 1, MissingLastUpdated: 1}
+	if got != want {
+		t.Errorf("skipped trains got=%+v, want=%+v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package pathgtfsrt
+
+import (
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Builds a DIFFERENTIAL GTFS Realtime message that transforms the previous message into the
+// current message.
+//
+// The result contains all entities in the current message that are new or have changed, and a
+// deleted entity for each entity in the previous message that is not in the current message.
+// Entities are matched using their IDs. If there is no previous message, all entities in the
+// current message are included.
+func buildDifferentialFeedMessage(previous, current *gtfs.FeedMessage) *gtfs.FeedMessage {
+	previousEntities := map[string]*gtfs.FeedEntity{}
+	for _, entity := range previous.GetEntity() {
+		previousEntities[entity.GetId()] = entity
+	}
+	var entities []*gtfs.FeedEntity
+	currentIds := map[string]bool{}
+	for _, entity := range current.GetEntity() {
+		currentIds[entity.GetId()] = true
+		if previousEntity, ok := previousEntities[entity.GetId()]; ok && proto.Equal(previousEntity, entity) {
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	for _, entity := range previous.GetEntity() {
+		if currentIds[entity.GetId()] {
+			continue
+		}
+		entities = append(entities, &gtfs.FeedEntity{
+			Id:        entity.Id,
+			IsDeleted: ptr(true),
+		})
+	}
+	header := proto.Clone(current.GetHeader()).(*gtfs.FeedHeader)
+	header.Incrementality = gtfs.FeedHeader_DIFFERENTIAL.Enum()
+	return &gtfs.FeedMessage{
+		Header: header,
+		Entity: entities,
+	}
+}
+
+// Returns the number of entities of the current message that are not in the previous message, of
+// entities of the previous message that are not in the current message, and of entities in both
+// messages that differ.
+func countEntityChanges(previous, current *gtfs.FeedMessage) (added, removed, changed int) {
+	previousEntities := map[string]*gtfs.FeedEntity{}
+	for _, entity := range previous.GetEntity() {
+		previousEntities[entity.GetId()] = entity
+	}
+	for _, entity := range current.GetEntity() {
+		previousEntity, ok := previousEntities[entity.GetId()]
+		switch {
+		case !ok:
+			added++
+		case !proto.Equal(previousEntity, entity):
+			changed++
+		}
+		delete(previousEntities, entity.GetId())
+	}
+	return added, len(previousEntities), changed
+}
@@ -0,0 +1,75 @@
+package pathgtfsrt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// EventsHandler returns a handler that streams the GTFS realtime data to clients using
+// Server-Sent Events.
+//
+// The current data is sent when the client connects, and new data is sent after each update in
+// which the feed entities differ from the data last sent to the client. Each event has type "feed"
+// and contains the full feed message, encoded as base64 protobuf or, if requested in the same way
+// as for ServeHTTP, as JSON. A client that falls behind skips to the most recent data.
+func (f *Feed) EventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		snapshots, cancel := f.subscribe()
+		defer cancel()
+		json := wantsJson(r)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// Updates are compared with the data last sent rather than the previous update, as the
+		// client may have skipped updates.
+		var lastSent *gtfs.FeedMessage
+		if s := f.get(); s.msg != nil {
+			if err := writeEvent(w, s, json); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastSent = s.msg
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case s := <-snapshots:
+				if lastSent != nil && len(buildDifferentialFeedMessage(lastSent, s.msg).GetEntity()) == 0 {
+					continue
+				}
+				if err := writeEvent(w, s, json); err != nil {
+					return
+				}
+				flusher.Flush()
+				lastSent = s.msg
+			}
+		}
+	})
+}
+
+func writeEvent(w http.ResponseWriter, s snapshot, json bool) error {
+	var data string
+	if json {
+		b, err := protojson.Marshal(s.msg)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	} else {
+		data = base64.StdEncoding.EncodeToString(s.gtfs)
+	}
+	_, err := fmt.Fprintf(w, "event: feed\ndata: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,184 @@
+package pathgtfsrt
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFeedEventsHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target string
+		decode func(data string, msg *gtfsrt.FeedMessage) error
+	}{
+		{
+			name:   "protobuf",
+			target: "/events",
+			decode: func(data string, msg *gtfsrt.FeedMessage) error {
+				b, err := base64.StdEncoding.DecodeString(data)
+				if err != nil {
+					return err
+				}
+				return proto.Unmarshal(b, msg)
+			},
+		},
+		{
+			name:   "json",
+			target: "/events?format=json",
+			decode: func(data string, msg *gtfsrt.FeedMessage) error {
+				return protojson.Unmarshal([]byte(data), msg)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := clock.NewMock()
+			client := newTestSourceClient(map[sourceapi.Station][]Train{
+				sourceapi.Station_HOBOKEN: {
+					sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+				},
+			})
+			updateSignal := make(chan struct{}, 1)
+			f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+				func(UpdateResult) {
+					updateSignal <- struct{}{}
+				})
+			if err != nil {
+				t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+			}
+			<-updateSignal
+			server := httptest.NewServer(f.EventsHandler())
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + tc.target)
+			if err != nil {
+				t.Fatalf("http.Get() err got=%v, want=<nil>", err)
+			}
+			defer resp.Body.Close()
+			if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("Content-Type got=%q, want=%q", got, "text/event-stream")
+			}
+			scanner := bufio.NewScanner(resp.Body)
+			scanner.Buffer(nil, 1024*1024)
+			readEvent := func() *gtfsrt.FeedMessage {
+				var event, data string
+				for scanner.Scan() {
+					line := scanner.Text()
+					if line == "" {
+						break
+					}
+					if strings.HasPrefix(line, "event: ") {
+						event = strings.TrimPrefix(line, "event: ")
+					}
+					if strings.HasPrefix(line, "data: ") {
+						data = strings.TrimPrefix(line, "data: ")
+					}
+				}
+				if event != "feed" {
+					t.Fatalf("event type got=%q, want=%q", event, "feed")
+				}
+				var msg gtfsrt.FeedMessage
+				if err := tc.decode(data, &msg); err != nil {
+					t.Fatalf("decoding event data err got=%v, want=<nil>", err)
+				}
+				return &msg
+			}
+
+			if numEntities := len(readEvent().GetEntity()); numEntities != 1 {
+				t.Errorf("initial event number of entities got=%d, want=1", numEntities)
+			}
+
+			// An update without changes does not produce an event.
+			c.Add(5 * time.Second)
+			<-updateSignal
+			client.stationToTrains[sourceapi.Station_HOBOKEN] = append(client.stationToTrains[sourceapi.Station_HOBOKEN],
+				sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 10))
+			c.Add(5 * time.Second)
+			<-updateSignal
+
+			if numEntities := len(readEvent().GetEntity()); numEntities != 2 {
+				t.Errorf("second event number of entities got=%d, want=2", numEntities)
+			}
+		})
+	}
+}
+
+func TestFeedEventsHandler_SkippedUpdates(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+
+	w := &blockingFlushWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		flushed:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		f.EventsHandler().ServeHTTP(w, r)
+		close(done)
+	}()
+	// The headers are flushed, then the handler blocks flushing the initial event.
+	<-w.flushed
+	w.release <- struct{}{}
+	<-w.flushed
+
+	// While the client is slow, an update with changes is followed by an update without
+	// changes, so the handler only receives the second.
+	client.stationToTrains[sourceapi.Station_HOBOKEN] = append(client.stationToTrains[sourceapi.Station_HOBOKEN],
+		sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 10))
+	c.Add(5 * time.Second)
+	<-updateSignal
+	c.Add(5 * time.Second)
+	<-updateSignal
+	w.release <- struct{}{}
+
+	select {
+	case <-w.flushed:
+	case <-time.After(time.Second):
+		t.Fatalf("no event sent for the skipped update")
+	}
+	cancel()
+	w.release <- struct{}{}
+	<-done
+	if numEvents := strings.Count(w.Body.String(), "event: feed\n"); numEvents != 2 {
+		t.Errorf("number of events got=%d, want=2", numEvents)
+	}
+}
+
+// A response writer whose Flush signals the test and blocks until the test releases it.
+type blockingFlushWriter struct {
+	*httptest.ResponseRecorder
+	flushed chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingFlushWriter) Flush() {
+	w.flushed <- struct{}{}
+	<-w.release
+}
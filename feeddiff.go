@@ -0,0 +1,222 @@
+package pathgtfsrt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	"google.golang.org/protobuf/proto"
+)
+
+// FeedDiff describes how the entities of one GTFS realtime message differ from another. Entities
+// are matched using their IDs.
+type FeedDiff struct {
+	FromTimestamp uint64       `json:"from_timestamp"`
+	ToTimestamp   uint64       `json:"to_timestamp"`
+	Added         []EntityDiff `json:"added"`
+	Removed       []EntityDiff `json:"removed"`
+	Changed       []EntityDiff `json:"changed"`
+}
+
+// EntityDiff describes an entity that was added, removed or changed.
+type EntityDiff struct {
+	Id string `json:"id"`
+	// A short description of the entity; e.g., the trip and route of a trip update.
+	Summary string `json:"summary"`
+	// For changed entities, a readable description of each change.
+	Changes []string `json:"changes,omitempty"`
+}
+
+// DiffFeedMessages compares two GTFS realtime messages. Entities are listed in the order they
+// appear in the messages.
+func DiffFeedMessages(from, to *gtfs.FeedMessage) FeedDiff {
+	diff := FeedDiff{
+		FromTimestamp: from.GetHeader().GetTimestamp(),
+		ToTimestamp:   to.GetHeader().GetTimestamp(),
+		Added:         []EntityDiff{},
+		Removed:       []EntityDiff{},
+		Changed:       []EntityDiff{},
+	}
+	fromEntities := map[string]*gtfs.FeedEntity{}
+	for _, entity := range from.GetEntity() {
+		fromEntities[entity.GetId()] = entity
+	}
+	toIds := map[string]bool{}
+	for _, entity := range to.GetEntity() {
+		toIds[entity.GetId()] = true
+		fromEntity, ok := fromEntities[entity.GetId()]
+		if !ok {
+			diff.Added = append(diff.Added, EntityDiff{Id: entity.GetId(), Summary: summarizeEntity(entity)})
+			continue
+		}
+		if proto.Equal(fromEntity, entity) {
+			continue
+		}
+		diff.Changed = append(diff.Changed, EntityDiff{
+			Id:      entity.GetId(),
+			Summary: summarizeEntity(entity),
+			Changes: diffEntities(fromEntity, entity),
+		})
+	}
+	for _, entity := range from.GetEntity() {
+		if !toIds[entity.GetId()] {
+			diff.Removed = append(diff.Removed, EntityDiff{Id: entity.GetId(), Summary: summarizeEntity(entity)})
+		}
+	}
+	return diff
+}
+
+// String renders the diff in a readable format:
+//
+//	From 2023-02-26T10:10:00Z to 2023-02-26T10:10:05Z: 1 added, 0 removed, 1 changed
+//	+ <id> (trip <trip ID>, route <route ID>)
+//	~ <id> (trip <trip ID>, route <route ID>)
+//	    stop 26730 arrival 10:15:00Z -> 10:16:00Z (+60s)
+func (d FeedDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From %s to %s: %d added, %d removed, %d changed\n",
+		formatFeedTimestamp(d.FromTimestamp), formatFeedTimestamp(d.ToTimestamp),
+		len(d.Added), len(d.Removed), len(d.Changed))
+	for _, entities := range []struct {
+		symbol string
+		diffs  []EntityDiff
+	}{{"+", d.Added}, {"-", d.Removed}, {"~", d.Changed}} {
+		for _, entity := range entities.diffs {
+			fmt.Fprintf(&b, "%s %s (%s)\n", entities.symbol, entity.Id, entity.Summary)
+			for _, change := range entity.Changes {
+				fmt.Fprintf(&b, "    %s\n", change)
+			}
+		}
+	}
+	return b.String()
+}
+
+func summarizeEntity(entity *gtfs.FeedEntity) string {
+	var trip *gtfs.TripDescriptor
+	var kind string
+	switch {
+	case entity.TripUpdate != nil:
+		kind, trip = "trip update", entity.TripUpdate.GetTrip()
+	case entity.Vehicle != nil:
+		kind, trip = "vehicle", entity.Vehicle.GetTrip()
+	case entity.Alert != nil:
+		return "alert"
+	case entity.GetIsDeleted():
+		return "deleted"
+	default:
+		return "empty"
+	}
+	return fmt.Sprintf("%s, trip %s, route %s", kind, trip.GetTripId(), trip.GetRouteId())
+}
+
+// Describes the changes between two versions of an entity.
+func diffEntities(from, to *gtfs.FeedEntity) []string {
+	var changes []string
+	if from.TripUpdate != nil && to.TripUpdate != nil {
+		changes = append(changes, diffTripDescriptors(from.TripUpdate.GetTrip(), to.TripUpdate.GetTrip())...)
+		changes = append(changes, diffStopTimeUpdates(from.TripUpdate.GetStopTimeUpdate(), to.TripUpdate.GetStopTimeUpdate())...)
+	}
+	if from.Vehicle != nil && to.Vehicle != nil {
+		changes = append(changes, diffTripDescriptors(from.Vehicle.GetTrip(), to.Vehicle.GetTrip())...)
+		if from.Vehicle.GetStopId() != to.Vehicle.GetStopId() || from.Vehicle.GetCurrentStatus() != to.Vehicle.GetCurrentStatus() {
+			changes = append(changes, fmt.Sprintf("position %s %s -> %s %s",
+				from.Vehicle.GetCurrentStatus(), from.Vehicle.GetStopId(), to.Vehicle.GetCurrentStatus(), to.Vehicle.GetStopId()))
+		}
+	}
+	if len(changes) == 0 {
+		// For example, only a timestamp changed, or the entity changed type.
+		changes = append(changes, "other fields changed")
+	}
+	return changes
+}
+
+func diffTripDescriptors(from, to *gtfs.TripDescriptor) []string {
+	var changes []string
+	if from.GetTripId() != to.GetTripId() {
+		changes = append(changes, fmt.Sprintf("trip %s -> %s", from.GetTripId(), to.GetTripId()))
+	}
+	if from.GetRouteId() != to.GetRouteId() {
+		changes = append(changes, fmt.Sprintf("route %s -> %s", from.GetRouteId(), to.GetRouteId()))
+	}
+	if from.GetScheduleRelationship() != to.GetScheduleRelationship() {
+		changes = append(changes, fmt.Sprintf("schedule relationship %s -> %s", from.GetScheduleRelationship(), to.GetScheduleRelationship()))
+	}
+	return changes
+}
+
+// Matches stop time updates using their stop IDs.
+func diffStopTimeUpdates(from, to []*gtfs.TripUpdate_StopTimeUpdate) []string {
+	var changes []string
+	fromUpdates := map[string]*gtfs.TripUpdate_StopTimeUpdate{}
+	for _, update := range from {
+		fromUpdates[update.GetStopId()] = update
+	}
+	toStopIds := map[string]bool{}
+	for _, update := range to {
+		toStopIds[update.GetStopId()] = true
+		fromUpdate, ok := fromUpdates[update.GetStopId()]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("stop %s added, arrival %s", update.GetStopId(), formatStopTime(update.GetArrival())))
+			continue
+		}
+		for _, event := range []struct {
+			name     string
+			from, to *gtfs.TripUpdate_StopTimeEvent
+		}{{"arrival", fromUpdate.GetArrival(), update.GetArrival()}, {"departure", fromUpdate.GetDeparture(), update.GetDeparture()}} {
+			if proto.Equal(event.from, event.to) {
+				continue
+			}
+			change := fmt.Sprintf("stop %s %s %s -> %s", update.GetStopId(), event.name, formatStopTime(event.from), formatStopTime(event.to))
+			if event.from != nil && event.to != nil {
+				change += fmt.Sprintf(" (%+ds)", event.to.GetTime()-event.from.GetTime())
+			}
+			changes = append(changes, change)
+		}
+		if fromUpdate.GetScheduleRelationship() != update.GetScheduleRelationship() {
+			changes = append(changes, fmt.Sprintf("stop %s schedule relationship %s -> %s",
+				update.GetStopId(), fromUpdate.GetScheduleRelationship(), update.GetScheduleRelationship()))
+		}
+	}
+	for _, update := range from {
+		if !toStopIds[update.GetStopId()] {
+			changes = append(changes, fmt.Sprintf("stop %s removed", update.GetStopId()))
+		}
+	}
+	return changes
+}
+
+func formatStopTime(event *gtfs.TripUpdate_StopTimeEvent) string {
+	if event == nil {
+		return "none"
+	}
+	return time.Unix(event.GetTime(), 0).UTC().Format("15:04:05Z")
+}
+
+func formatFeedTimestamp(timestamp uint64) string {
+	return time.Unix(int64(timestamp), 0).UTC().Format(time.RFC3339)
+}
+
+// DiffHandler returns a handler that responds with the differences between the current and
+// previous versions of the feed, in the readable format of FeedDiff.String, or as JSON if requested
+// using the Accept header or the format=json query parameter. Until the feed has been updated
+// twice, the previous version is empty.
+func (f *Feed) DiffHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := f.get()
+		if s.msg == nil {
+			http.Error(w, "feed is warming up", http.StatusServiceUnavailable)
+			return
+		}
+		diff := DiffFeedMessages(s.previousMsg, s.msg)
+		if wantsJson(r) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(diff)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, diff.String())
+	})
+}
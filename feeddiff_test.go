@@ -0,0 +1,55 @@
+package pathgtfsrt
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+)
+
+func TestDiffFeedMessages(t *testing.T) {
+	withId := func(id string, entity *gtfsrt.FeedEntity) *gtfsrt.FeedEntity {
+		entity.Id = &id
+		return entity
+	}
+	from := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{Timestamp: ptr(uint64(*makeUnix(10)))},
+		Entity: []*gtfsrt.FeedEntity{
+			withId("unchanged", wantFeedEntity(routeID1, 0, stopID14St, 15, 5)),
+			withId("changed", wantFeedEntity(routeID1, 1, stopIDHoboken, 16, 5)),
+			withId("removed", wantFeedEntity(routeID1, 1, stopID14St, 20, 5)),
+		},
+	}
+	to := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{Timestamp: ptr(uint64(*makeUnix(11)))},
+		Entity: []*gtfsrt.FeedEntity{
+			withId("unchanged", wantFeedEntity(routeID1, 0, stopID14St, 15, 5)),
+			withId("changed", wantFeedEntity(routeID1, 1, stopIDHoboken, 17, 5)),
+			withId("added", wantFeedEntity(routeID1, 0, stopIDHoboken, 25, 6)),
+		},
+	}
+
+	got := DiffFeedMessages(from, to)
+
+	summary := "trip update, trip , route " + routeID1
+	want := FeedDiff{
+		FromTimestamp: uint64(*makeUnix(10)),
+		ToTimestamp:   uint64(*makeUnix(11)),
+		Added:         []EntityDiff{{Id: "added", Summary: summary}},
+		Removed:       []EntityDiff{{Id: "removed", Summary: summary}},
+		Changed: []EntityDiff{
+			{Id: "changed", Summary: summary, Changes: []string{"stop stopID2 arrival 10:16:00Z -> 10:17:00Z (+60s)"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffFeedMessages() got != want, diff=%s", diff)
+	}
+	wantString := "From 2023-02-26T10:10:00Z to 2023-02-26T10:11:00Z: 1 added, 1 removed, 1 changed\n" +
+		"+ added (" + summary + ")\n" +
+		"- removed (" + summary + ")\n" +
+		"~ changed (" + summary + ")\n" +
+		"    stop stopID2 arrival 10:16:00Z -> 10:17:00Z (+60s)\n"
+	if gotString := got.String(); gotString != wantString {
+		t.Errorf("String() got=\n%s\nwant=\n%s", gotString, wantString)
+	}
+}
@@ -0,0 +1,39 @@
+package pathgtfsrt
+
+import (
+	"fmt"
+
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+// StationFetchError is the error that occurs when the realtime data for a station cannot be
+// retrieved from the source API.
+//
+// The feed reports these errors in UpdateResult.StationErrs, so callers can tell a single failing
+// station apart from an outage of the source API, in which the data of every station fails.
+type StationFetchError struct {
+	Station sourceapi.Station
+	// Endpoint is the URL or the gRPC method that was requested, or empty if the source client
+	// does not report it.
+	Endpoint string
+	Cause    error
+}
+
+func (e *StationFetchError) Error() string {
+	if e.Endpoint == "" {
+		return fmt.Sprintf("failed to get trains at station %s: %s", e.Station, e.Cause)
+	}
+	return fmt.Sprintf("failed to get trains at station %s from %s: %s", e.Station, e.Endpoint, e.Cause)
+}
+
+func (e *StationFetchError) Unwrap() error {
+	return e.Cause
+}
+
+// Wraps an error of a source client in a StationFetchError, unless it already is one.
+func newStationFetchError(station sourceapi.Station, endpoint string, err error) *StationFetchError {
+	if fetchErr, ok := err.(*StationFetchError); ok {
+		return fetchErr
+	}
+	return &StationFetchError{Station: station, Endpoint: endpoint, Cause: err}
+}
@@ -0,0 +1,62 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestSourceHttpStationFetchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `not json`)
+	}))
+	defer server.Close()
+
+	client := NewHttpSourceClient(http.DefaultClient, WithSourceApiUrl(server.URL+"/v1"))
+	_, err := client.GetTrainsAtStation(context.Background(), sourceapi.Station_HOBOKEN)
+	var fetchErr *StationFetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("GetTrainsAtStation() err got=%v, want a *StationFetchError", err)
+	}
+	if fetchErr.Station != sourceapi.Station_HOBOKEN {
+		t.Errorf("station got=%s, want=%s", fetchErr.Station, sourceapi.Station_HOBOKEN)
+	}
+	if want := server.URL + "/v1/stations/hoboken/realtime/"; fetchErr.Endpoint != want {
+		t.Errorf("endpoint got=%q, want=%q", fetchErr.Endpoint, want)
+	}
+}
+
+func TestFeedStationFetchErrors(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN:           {},
+		sourceapi.Station_FOURTEENTH_STREET: {},
+	})
+	updateSignal := make(chan UpdateResult, 1)
+	c := clock.NewMock()
+	_, err := NewFeed(context.Background(), c, 5*time.Second, client, func(result UpdateResult) {
+		updateSignal <- result
+	})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+
+	// The mock client returns errors that are not StationFetchErrors, which the feed wraps.
+	delete(client.stationToTrains, sourceapi.Station_FOURTEENTH_STREET)
+	c.Add(5 * time.Second)
+	result := <-updateSignal
+	if len(result.StationErrs) != 1 {
+		t.Fatalf("station errors got=%v, want 1 error", result.StationErrs)
+	}
+	var fetchErr *StationFetchError
+	if !errors.As(result.StationErrs[sourceapi.Station_FOURTEENTH_STREET], &fetchErr) || fetchErr.Station != sourceapi.Station_FOURTEENTH_STREET {
+		t.Errorf("error for FOURTEENTH_STREET got=%v, want a *StationFetchError for the station", result.StationErrs[sourceapi.Station_FOURTEENTH_STREET])
+	}
+}
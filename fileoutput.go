@@ -0,0 +1,28 @@
+package pathgtfsrt
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Writes the data to the path by writing it to a temporary file in the same directory and then
+// renaming the temporary file, so that readers of the path never see a partially written file.
+func writeFileAtomically(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,59 @@
+package pathgtfsrt
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedWithFileOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gtfsrt")
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		}, WithFileOutput(path))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+
+	checkFile := func() {
+		t.Helper()
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("os.ReadFile() err got=%v, want=<nil>", err)
+		}
+		if !bytes.Equal(got, f.Get()) {
+			t.Errorf("file content got=%v, want=%v", got, f.Get())
+		}
+	}
+	checkFile()
+
+	client.stationToTrains[sourceapi.Station_HOBOKEN] = append(client.stationToTrains[sourceapi.Station_HOBOKEN],
+		sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 10))
+	c.Add(5 * time.Second)
+	<-updateSignal
+	checkFile()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("os.ReadDir() err got=%v, want=<nil>", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("number of files got=%d, want=1", len(entries))
+	}
+}
@@ -0,0 +1,543 @@
+package pathgtfsrt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+// GraphQLHandler returns a handler that answers GraphQL queries about the most recent data. Queries
+// are read from the query parameter of GET requests, or from the query field of a JSON body for
+// POST requests. The schema is:
+//
+//	type Query {
+//	  stations: [Station!]!
+//	  station(id: String!): Station
+//	  routes: [Route!]!
+//	}
+//	type Station {
+//	  id: String!       # source API station name, like HOBOKEN
+//	  stopId: String!
+//	  name: String!
+//	  trains(direction: Direction, route: String, limit: Int): [Train!]!
+//	}
+//	type Train {
+//	  route: String!    # source API route name, like HOB_33
+//	  routeId: String!
+//	  direction: Direction!
+//	  headsign: String
+//	  arrival: String!  # RFC 3339
+//	  secondsAway: Int!
+//	}
+//	type Route {
+//	  id: String!
+//	  routeId: String!
+//	  name: String!
+//	  color: String!
+//	}
+//	enum Direction { TO_NY TO_NJ }
+//
+// The station argument is matched like the departure boards: either the source API station name,
+// case insensitive, or the GTFS stop ID. Trains that have already arrived are omitted, and the rest
+// are ordered by arrival. For example, the next 3 trains toward New York at Hoboken are given by:
+//
+//	{ station(id: "hoboken") { trains(direction: TO_NY, limit: 3) { route arrival secondsAway } } }
+//
+// Only query operations with literal arguments, aliases and __typename are supported; variables,
+// fragments and directives are not. Request bodies larger than 64 KiB and selection sets nested
+// more than 10 deep are rejected.
+func (f *Feed) GraphQLHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query string
+		switch r.Method {
+		case http.MethodGet:
+			query = r.URL.Query().Get("query")
+		case http.MethodPost:
+			var body struct {
+				Query string `json:"query"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphqlBodySize)).Decode(&body); err != nil {
+				http.Error(w, fmt.Sprintf("invalid request body: %s", err), http.StatusBadRequest)
+				return
+			}
+			query = body.Query
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		type graphqlError struct {
+			Message string `json:"message"`
+		}
+		var response struct {
+			Data   interface{}    `json:"data,omitempty"`
+			Errors []graphqlError `json:"errors,omitempty"`
+		}
+		selections, err := parseGraphqlQuery(query)
+		if err == nil {
+			root := graphqlQuery{f: f, trains: f.get().trains, now: f.clock.Now()}
+			var data graphqlResult
+			if data, err = executeGraphql(root, selections); err == nil {
+				response.Data = data
+			}
+		}
+		if err != nil {
+			response.Errors = []graphqlError{{Message: err.Error()}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+const (
+	// The maximum size of the body of a GraphQL POST request.
+	maxGraphqlBodySize = 64 << 10
+	// The maximum nesting depth of GraphQL selection sets; the schema needs at most 3.
+	maxGraphqlDepth = 10
+)
+
+// A field in a GraphQL selection set.
+type graphqlSelection struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	selections []graphqlSelection
+}
+
+// An enum value in a GraphQL query.
+type graphqlEnum string
+
+// An object in the GraphQL schema.
+type graphqlObject interface {
+	graphqlTypeName() string
+	graphqlField(name string, args map[string]interface{}) (interface{}, error)
+}
+
+// The result of executing a selection set on an object; a JSON object whose keys are in the order
+// of the selections.
+type graphqlResult []graphqlResultField
+
+type graphqlResultField struct {
+	key   string
+	value interface{}
+}
+
+func (r graphqlResult) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, field := range r {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func executeGraphql(object graphqlObject, selections []graphqlSelection) (graphqlResult, error) {
+	result := graphqlResult{}
+	for _, selection := range selections {
+		var value interface{}
+		var err error
+		if selection.name == "__typename" {
+			value = object.graphqlTypeName()
+		} else {
+			value, err = object.graphqlField(selection.name, selection.args)
+			if err != nil {
+				return nil, err
+			}
+		}
+		value, err = executeGraphqlValue(object.graphqlTypeName(), selection, value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, graphqlResultField{key: selection.alias, value: value})
+	}
+	return result, nil
+}
+
+func executeGraphqlValue(typeName string, selection graphqlSelection, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch v := value.(type) {
+	case graphqlObject:
+		if len(selection.selections) == 0 {
+			return nil, fmt.Errorf("field %q of type %q must have a selection of subfields", selection.name, typeName)
+		}
+		return executeGraphql(v, selection.selections)
+	case []graphqlObject:
+		if len(selection.selections) == 0 {
+			return nil, fmt.Errorf("field %q of type %q must have a selection of subfields", selection.name, typeName)
+		}
+		results := []graphqlResult{}
+		for _, object := range v {
+			result, err := executeGraphql(object, selection.selections)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+		return results, nil
+	default:
+		if len(selection.selections) > 0 {
+			return nil, fmt.Errorf("field %q of type %q is a scalar and cannot have a selection of subfields", selection.name, typeName)
+		}
+		return value, nil
+	}
+}
+
+func graphqlUnknownField(typeName, name string) error {
+	return fmt.Errorf("cannot query field %q on type %q", name, typeName)
+}
+
+type graphqlQuery struct {
+	f      *Feed
+	trains map[sourceapi.Station][]Train
+	now    time.Time
+}
+
+func (q graphqlQuery) graphqlTypeName() string { return "Query" }
+
+func (q graphqlQuery) graphqlField(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "stations":
+		var stations []graphqlObject
+		for _, station := range q.f.staticData.stations {
+			stations = append(stations, graphqlStation{q: q, station: station})
+		}
+		return stations, nil
+	case "station":
+		id, ok := args["id"].(string)
+		if !ok {
+			return nil, fmt.Errorf("argument \"id\" of field \"station\" must be a string")
+		}
+		station, ok := q.f.lookupStation(id)
+		if !ok {
+			return nil, nil
+		}
+		return graphqlStation{q: q, station: station}, nil
+	case "routes":
+		var routes []graphqlObject
+		for route, routeId := range q.f.staticData.routeToRouteId {
+			routes = append(routes, graphqlRoute{route: route, routeId: routeId})
+		}
+		sort.Slice(routes, func(i, j int) bool { return routes[i].(graphqlRoute).route < routes[j].(graphqlRoute).route })
+		return routes, nil
+	}
+	return nil, graphqlUnknownField(q.graphqlTypeName(), name)
+}
+
+type graphqlStation struct {
+	q       graphqlQuery
+	station sourceapi.Station
+}
+
+func (s graphqlStation) graphqlTypeName() string { return "Station" }
+
+func (s graphqlStation) graphqlField(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "id":
+		return s.station.String(), nil
+	case "stopId":
+		return s.q.f.staticData.stationToStopId[s.station], nil
+	case "name":
+		return stationName(s.station), nil
+	case "trains":
+		var direction, route string
+		limit := -1
+		if v, ok := args["direction"]; ok {
+			e, ok := v.(graphqlEnum)
+			if !ok || (e != "TO_NY" && e != "TO_NJ") {
+				return nil, fmt.Errorf("argument \"direction\" of field \"trains\" must be TO_NY or TO_NJ")
+			}
+			direction = string(e)
+		}
+		if v, ok := args["route"]; ok {
+			if route, ok = v.(string); !ok {
+				return nil, fmt.Errorf("argument \"route\" of field \"trains\" must be a string")
+			}
+		}
+		if v, ok := args["limit"]; ok {
+			l, ok := v.(int64)
+			if !ok || l < 0 {
+				return nil, fmt.Errorf("argument \"limit\" of field \"trains\" must be a non-negative integer")
+			}
+			limit = int(l)
+		}
+		trains := []graphqlObject{}
+		for _, train := range upcomingTrains(s.q.trains[s.station], s.q.now) {
+			if limit >= 0 && len(trains) >= limit {
+				break
+			}
+			if direction != "" && train.Direction.String() != direction {
+				continue
+			}
+			if route != "" && !strings.EqualFold(train.Route.String(), route) {
+				continue
+			}
+			trains = append(trains, graphqlTrain{q: s.q, train: train})
+		}
+		return trains, nil
+	}
+	return nil, graphqlUnknownField(s.graphqlTypeName(), name)
+}
+
+type graphqlTrain struct {
+	q     graphqlQuery
+	train Train
+}
+
+func (t graphqlTrain) graphqlTypeName() string { return "Train" }
+
+func (t graphqlTrain) graphqlField(name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "route":
+		return t.train.Route.String(), nil
+	case "routeId":
+		return t.q.f.staticData.routeToRouteId[t.train.Route], nil
+	case "direction":
+		return t.train.Direction.String(), nil
+	case "headsign":
+		if t.train.Headsign == "" {
+			return nil, nil
+		}
+		return t.train.Headsign, nil
+	case "arrival":
+		return t.train.ProjectedArrival.AsTime().UTC().Format(time.RFC3339), nil
+	case "secondsAway":
+		return int64(t.train.ProjectedArrival.AsTime().Sub(t.q.now) / time.Second), nil
+	}
+	return nil, graphqlUnknownField(t.graphqlTypeName(), name)
+}
+
+type graphqlRoute struct {
+	route   sourceapi.Route
+	routeId string
+}
+
+func (r graphqlRoute) graphqlTypeName() string { return "Route" }
+
+func (r graphqlRoute) graphqlField(name string, args map[string]interface{}) (interface{}, error) {
+	info, ok := sourceRouteToRouteInfo[r.route]
+	if !ok {
+		info = routeInfo{name: r.route.String()}
+	}
+	switch name {
+	case "id":
+		return r.route.String(), nil
+	case "routeId":
+		return r.routeId, nil
+	case "name":
+		return info.name, nil
+	case "color":
+		return info.color, nil
+	}
+	return nil, graphqlUnknownField(r.graphqlTypeName(), name)
+}
+
+// Parses a GraphQL document containing a single query operation and returns its selection set.
+func parseGraphqlQuery(query string) ([]graphqlSelection, error) {
+	tokens, err := tokenizeGraphql(query)
+	if err != nil {
+		return nil, err
+	}
+	p := graphqlParser{tokens: tokens}
+	if p.peek() == "query" {
+		p.next()
+		if t := p.peek(); t != "{" && t != "" {
+			p.next()
+		}
+	}
+	selections, err := p.parseSelectionSet(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != "" {
+		return nil, fmt.Errorf("syntax error: unexpected %q after the query", t)
+	}
+	return selections, nil
+}
+
+type graphqlParser struct {
+	tokens []string
+}
+
+func (p *graphqlParser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *graphqlParser) next() string {
+	t := p.peek()
+	if len(p.tokens) > 0 {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+func (p *graphqlParser) expect(want string) error {
+	if got := p.next(); got != want {
+		return fmt.Errorf("syntax error: expected %q, got %q", want, got)
+	}
+	return nil
+}
+
+func (p *graphqlParser) parseName() (string, error) {
+	t := p.next()
+	if !isGraphqlName(t) {
+		return "", fmt.Errorf("syntax error: expected a name, got %q", t)
+	}
+	return t, nil
+}
+
+// Parses a selection set at the provided nesting depth, starting from 1.
+func (p *graphqlParser) parseSelectionSet(depth int) ([]graphqlSelection, error) {
+	if depth > maxGraphqlDepth {
+		return nil, fmt.Errorf("syntax error: selection sets nested more than %d deep", maxGraphqlDepth)
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []graphqlSelection
+	for p.peek() != "}" {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		selection := graphqlSelection{alias: name, name: name}
+		if p.peek() == ":" {
+			p.next()
+			if selection.name, err = p.parseName(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == "(" {
+			if selection.args, err = p.parseArguments(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == "{" {
+			if selection.selections, err = p.parseSelectionSet(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		selections = append(selections, selection)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("syntax error: empty selection set")
+	}
+	return selections, nil
+}
+
+func (p *graphqlParser) parseArguments() (map[string]interface{}, error) {
+	p.next()
+	args := map[string]interface{}{}
+	for p.peek() != ")" {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		switch {
+		case strings.HasPrefix(t, `"`):
+			s, err := strconv.Unquote(t)
+			if err != nil {
+				return nil, fmt.Errorf("syntax error: invalid string %s", t)
+			}
+			args[name] = s
+		case t == "true" || t == "false":
+			args[name] = t == "true"
+		case t == "null":
+			args[name] = nil
+		case isGraphqlName(t):
+			args[name] = graphqlEnum(t)
+		default:
+			i, err := strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("syntax error: unsupported value %q for argument %q", t, name)
+			}
+			args[name] = i
+		}
+	}
+	p.next()
+	return args, nil
+}
+
+func isGraphqlName(t string) bool {
+	if t == "" {
+		return false
+	}
+	for i, c := range t {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Splits a GraphQL document into tokens, dropping whitespace, commas and comments. Strings are
+// kept with their quotes.
+func tokenizeGraphql(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				j++
+			}
+			if j == len(s) {
+				return nil, fmt.Errorf("syntax error: unterminated string %s", s[i:])
+			}
+			j++
+			tokens = append(tokens, s[i:j])
+			i = j
+		case strings.IndexByte("{}():!$[]=@", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\n\r,#\"{}():!$[]=@", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
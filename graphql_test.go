@@ -0,0 +1,108 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedGraphQLHandler(t *testing.T) {
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 20, 5),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 12, 5),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			// This train has already arrived.
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 9, 5),
+		},
+	})
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		query  string
+		want   string
+	}{
+		{
+			name:   "next trains toward NY",
+			method: http.MethodGet,
+			query: `query NextTrains {
+				station(id: "hoboken") {
+					name
+					next: trains(direction: TO_NY, limit: 1) { route arrival secondsAway }
+				}
+			}`,
+			want: `{"data":{"station":{"name":"Hoboken","next":[{"route":"HOB_33","arrival":"2023-02-26T10:15:00Z","secondsAway":300}]}}}`,
+		},
+		{
+			name:   "stations and routes",
+			method: http.MethodPost,
+			query:  `{ stations { __typename id stopId } routes { id routeId name color } }`,
+			want:   `{"data":{"stations":[{"__typename":"Station","id":"HOBOKEN","stopId":"stopID2"}],"routes":[{"id":"HOB_33","routeId":"routeID1","name":"Hoboken - 33rd Street","color":"4D92FB"}]}}`,
+		},
+		{
+			name:   "unknown station",
+			method: http.MethodGet,
+			query:  `{ station(id: "newark") { name } }`,
+			want:   `{"data":{"station":null}}`,
+		},
+		{
+			name:   "unknown field",
+			method: http.MethodGet,
+			query:  `{ station(id: "hoboken") { alerts } }`,
+			want:   `{"errors":[{"message":"cannot query field \"alerts\" on type \"Station\""}]}`,
+		},
+		{
+			name:   "syntax error",
+			method: http.MethodGet,
+			query:  `{ stations { id }`,
+			want:   `{"errors":[{"message":"syntax error: expected a name, got \"\""}]}`,
+		},
+		{
+			name:   "unterminated string",
+			method: http.MethodGet,
+			query:  `{ station(id: "\`,
+			want:   `{"errors":[{"message":"syntax error: unterminated string \"\\"}]}`,
+		},
+		{
+			name:   "nested too deep",
+			method: http.MethodGet,
+			query:  strings.Repeat("{ station ", 11) + strings.Repeat("}", 11),
+			want:   `{"errors":[{"message":"syntax error: selection sets nested more than 10 deep"}]}`,
+		},
+		{
+			name:   "body too large",
+			method: http.MethodPost,
+			query:  `{ stations { id } }` + strings.Repeat(" ", maxGraphqlBodySize),
+			want:   `invalid request body: http: request body too large`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var r *http.Request
+			if tc.method == http.MethodGet {
+				r = httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(tc.query), nil)
+			} else {
+				body := `{"query": "` + strings.ReplaceAll(tc.query, `"`, `\"`) + `"}`
+				r = httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+			}
+			w := httptest.NewRecorder()
+			f.GraphQLHandler().ServeHTTP(w, r)
+			if got := strings.TrimSpace(w.Body.String()); got != tc.want {
+				t.Errorf("response got=%s, want=%s", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package pathgtfsrt
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
@@ -10,7 +11,8 @@ import (
 )
 
 const (
-	grpcApiUrl = "path.grpc.razza.dev:443"
+	grpcApiUrl               = "path.grpc.razza.dev:443"
+	grpcUpcomingTrainsMethod = "/path_api.v1.Stations/GetUpcomingTrains"
 )
 
 // GrpcSourceClient is a source client that gets data using the Razza gRPC API.
@@ -18,21 +20,45 @@ type GrpcSourceClient struct {
 	conn          *grpc.ClientConn
 	stations      *sourceapi.StationsClient
 	routes        *sourceapi.RoutesClient
-	timeoutPeriod time.Duration
+	timeoutPeriod atomic.Int64
 }
 
-func NewGrpcSourceClient(timeoutPeriod time.Duration) (*GrpcSourceClient, error) {
-	conn, err := grpc.Dial(grpcApiUrl, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewGrpcSourceClient creates a client for the Razza gRPC API. Additional dial options, such as
+// the one returned by Recorder.GrpcDialOption, are passed to the gRPC connection.
+func NewGrpcSourceClient(timeoutPeriod time.Duration, opts ...grpc.DialOption) (*GrpcSourceClient, error) {
+	return NewGrpcSourceClientForAddress(grpcApiUrl, timeoutPeriod, opts...)
+}
+
+// NewGrpcSourceClientForAddress creates a client for a server implementing the Razza gRPC API at
+// the provided host:port address, such as a mirror of the public API.
+func NewGrpcSourceClientForAddress(address string, timeoutPeriod time.Duration, opts ...grpc.DialOption) (*GrpcSourceClient, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(requestIdUnaryClientInterceptor),
+	}, opts...)
+	conn, err := grpc.Dial(address, opts...)
 	if err != nil {
 		return nil, err
 	}
 	stationsClient := sourceapi.NewStationsClient(conn)
 	routesClient := sourceapi.NewRoutesClient(conn)
-	return &GrpcSourceClient{conn: conn, stations: &stationsClient, routes: &routesClient, timeoutPeriod: timeoutPeriod}, nil
+	client := &GrpcSourceClient{conn: conn, stations: &stationsClient, routes: &routesClient}
+	client.timeoutPeriod.Store(int64(timeoutPeriod))
+	return client, nil
+}
+
+// SetTimeoutPeriod changes the timeout of requests to the API. Requests in progress keep their
+// timeout.
+func (client *GrpcSourceClient) SetTimeoutPeriod(timeoutPeriod time.Duration) {
+	client.timeoutPeriod.Store(int64(timeoutPeriod))
+}
+
+func (client *GrpcSourceClient) getTimeoutPeriod() time.Duration {
+	return time.Duration(client.timeoutPeriod.Load())
 }
 
 func (client *GrpcSourceClient) GetStationToStopId(ctx context.Context) (stationToStopId map[sourceapi.Station]string, err error) {
-	ctx, cancel := context.WithTimeout(ctx, client.timeoutPeriod)
+	ctx, cancel := context.WithTimeout(ctx, client.getTimeoutPeriod())
 	defer cancel()
 	response, err := (*client.stations).ListStations(ctx, &sourceapi.ListStationsRequest{})
 	if err != nil {
@@ -46,7 +72,7 @@ func (client *GrpcSourceClient) GetStationToStopId(ctx context.Context) (station
 }
 
 func (client *GrpcSourceClient) GetRouteToRouteId(ctx context.Context) (routeToRouteId map[sourceapi.Route]string, err error) {
-	ctx, cancel := context.WithTimeout(ctx, client.timeoutPeriod)
+	ctx, cancel := context.WithTimeout(ctx, client.getTimeoutPeriod())
 	defer cancel()
 	response, err := (*client.routes).ListRoutes(ctx, &sourceapi.ListRoutesRequest{})
 	if err != nil {
@@ -64,12 +90,12 @@ func (client *GrpcSourceClient) Close() error {
 }
 
 func (client *GrpcSourceClient) GetTrainsAtStation(ctx context.Context, station sourceapi.Station) ([]Train, error) {
-	ctx, cancel := context.WithTimeout(ctx, client.timeoutPeriod)
+	ctx, cancel := context.WithTimeout(ctx, client.getTimeoutPeriod())
 	defer cancel()
 	request := sourceapi.GetUpcomingTrainsRequest{Station: station}
 	response, err := (*client.stations).GetUpcomingTrains(ctx, &request)
 	if err != nil {
-		return nil, err
+		return nil, newStationFetchError(station, client.conn.Target()+grpcUpcomingTrainsMethod, err)
 	}
 	var trains []Train
 	for _, train := range response.UpcomingTrains {
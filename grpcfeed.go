@@ -0,0 +1,158 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// FeedKind identifies one of the feeds served by a FeedServer.
+type FeedKind int
+
+const (
+	// The feed built by NewFeed.
+	TripUpdatesFeed FeedKind = iota
+	// The feed built by NewVehiclePositionFeed.
+	VehiclePositionsFeed
+)
+
+const (
+	grpcFeedInitialBackoff = time.Second
+	grpcFeedMaxBackoff     = 30 * time.Second
+)
+
+// GrpcFeed serves a feed built by another process and received from its FeedServer. This allows
+// the process that polls the source API and builds the feed to be run separately from the
+// processes that serve it, so that the serving processes can be scaled and deployed independently.
+type GrpcFeed struct {
+	mutex  sync.RWMutex
+	feed   []byte
+	cancel context.CancelFunc
+	// Closed once the subscription goroutine has returned.
+	stopped chan struct{}
+}
+
+// GrpcFeedOption configures optional behavior of a GrpcFeed.
+type GrpcFeedOption func(*grpcFeedOptions)
+
+type grpcFeedOptions struct {
+	logOutput io.Writer
+}
+
+// WithGrpcFeedLogOutput makes the feed write warnings about failed subscriptions to the provided
+// writer rather than to stdout.
+func WithGrpcFeedLogOutput(w io.Writer) GrpcFeedOption {
+	return func(o *grpcFeedOptions) {
+		o.logOutput = w
+	}
+}
+
+// NewGrpcFeed subscribes to a feed of the FeedServer at the other end of the provided connection
+// and serves the most recent message received. It returns immediately; until the first message is
+// received, ServeHTTP responds with 503 Service Unavailable. If the subscription fails it is
+// retried with exponential backoff, while the previous message continues to be served, until the
+// context is cancelled.
+func NewGrpcFeed(ctx context.Context, clock clock.Clock, conn grpc.ClientConnInterface, kind FeedKind, opts ...GrpcFeedOption) *GrpcFeed {
+	options := grpcFeedOptions{logOutput: os.Stdout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	f := &GrpcFeed{cancel: cancel, stopped: make(chan struct{})}
+	client := gtfs.NewFeedServiceClient(conn)
+	method := "SubscribeTripUpdates"
+	open := func(ctx context.Context) (feedStream, error) {
+		return client.SubscribeTripUpdates(ctx, &emptypb.Empty{})
+	}
+	if kind == VehiclePositionsFeed {
+		method = "SubscribeVehiclePositions"
+		open = func(ctx context.Context) (feedStream, error) {
+			return client.SubscribeVehiclePositions(ctx, &emptypb.Empty{})
+		}
+	}
+	go func() {
+		defer close(f.stopped)
+		backoff := grpcFeedInitialBackoff
+		for {
+			received, err := f.subscribe(ctx, open)
+			if ctx.Err() != nil {
+				return
+			}
+			if received {
+				backoff = grpcFeedInitialBackoff
+			}
+			fmt.Fprintf(options.logOutput, "Warning: subscription to %s failed, retrying in %s: %s\n", method, backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-clock.After(backoff):
+			}
+			backoff *= 2
+			if backoff > grpcFeedMaxBackoff {
+				backoff = grpcFeedMaxBackoff
+			}
+		}
+	}()
+	return f
+}
+
+// Close cancels the subscription to the feed and waits for it to end. The most recently received
+// feed continues to be served.
+func (f *GrpcFeed) Close() error {
+	f.cancel()
+	<-f.stopped
+	return nil
+}
+
+// The client side of either of the subscribe methods of the feed service.
+type feedStream interface {
+	Recv() (*gtfs.FeedMessage, error)
+}
+
+// Receives messages until the stream fails, and returns whether any messages were received.
+func (f *GrpcFeed) subscribe(ctx context.Context, open func(context.Context) (feedStream, error)) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := open(ctx)
+	if err != nil {
+		return false, err
+	}
+	received := false
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			return received, err
+		}
+		received = true
+		f.mutex.Lock()
+		f.feed = b
+		f.mutex.Unlock()
+	}
+}
+
+// Get returns the most recent feed received, or nil if none has been received.
+func (f *GrpcFeed) Get() []byte {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.feed
+}
+
+// ServeHTTP responds to all requests with the most recent feed received, in the same way as
+// Feed.ServeHTTP.
+func (f *GrpcFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveFeedBytes(w, r, f.Get(), grpcFeedInitialBackoff)
+}
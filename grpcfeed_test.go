@@ -0,0 +1,67 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestGrpcFeed(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+	conn := newFeedServerConn(t, NewFeedServer(f, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	grpcFeed := NewGrpcFeed(ctx, clock.New(), conn, TripUpdatesFeed)
+
+	waitForGrpcFeed(t, grpcFeed, f.Get())
+	client.stationToTrains[sourceapi.Station_HOBOKEN] = append(client.stationToTrains[sourceapi.Station_HOBOKEN],
+		sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 10))
+	c.Add(5 * time.Second)
+	<-updateSignal
+	waitForGrpcFeed(t, grpcFeed, f.Get())
+
+	w := httptest.NewRecorder()
+	grpcFeed.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if got := w.Body.String(); got != string(f.Get()) {
+		t.Errorf("ServeHTTP() got=%v, want=%v", w.Body.Bytes(), f.Get())
+	}
+
+	// After closing, the last received feed is still served.
+	if err := grpcFeed.Close(); err != nil {
+		t.Errorf("Close() err got=%v, want=<nil>", err)
+	}
+	if got := grpcFeed.Get(); string(got) != string(f.Get()) {
+		t.Errorf("Get() after Close() got=%v, want=%v", got, f.Get())
+	}
+}
+
+func waitForGrpcFeed(t *testing.T, f *GrpcFeed, want []byte) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for string(f.Get()) != string(want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Get() got=%v, want=%v", f.Get(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,89 @@
+package pathgtfsrt
+
+import (
+	"context"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// FeedServiceName is the full name of the gRPC service registered by FeedServer. The service is
+// defined in proto/gtfsrt/feed_service.proto.
+const FeedServiceName = "pathgtfsrt.FeedService"
+
+// FeedServer serves the feeds over gRPC.
+type FeedServer struct {
+	tripUpdates      *Feed
+	vehiclePositions *Feed
+}
+
+// NewFeedServer creates a new gRPC server for the provided feeds. The vehicle positions feed may be nil,
+// in which case GetVehiclePositions and SubscribeVehiclePositions return an Unimplemented error.
+//
+// The subscribe methods send the current feed message, if there is one, and then a new feed message
+// after every update of the feed. A subscriber that falls behind skips to the most recent message.
+func NewFeedServer(tripUpdates *Feed, vehiclePositions *Feed) *FeedServer {
+	return &FeedServer{tripUpdates: tripUpdates, vehiclePositions: vehiclePositions}
+}
+
+// Register registers the feed service on the provided gRPC server.
+func (s *FeedServer) Register(registrar grpc.ServiceRegistrar) {
+	gtfs.RegisterFeedServiceServer(registrar, s)
+}
+
+// GetTripUpdates implements gtfs.FeedServiceServer.
+func (s *FeedServer) GetTripUpdates(ctx context.Context, _ *emptypb.Empty) (*gtfs.FeedMessage, error) {
+	return getFeedMessage(s.tripUpdates)
+}
+
+// GetVehiclePositions implements gtfs.FeedServiceServer.
+func (s *FeedServer) GetVehiclePositions(ctx context.Context, _ *emptypb.Empty) (*gtfs.FeedMessage, error) {
+	if s.vehiclePositions == nil {
+		return nil, status.Error(codes.Unimplemented, "vehicle positions feed is not enabled")
+	}
+	return getFeedMessage(s.vehiclePositions)
+}
+
+// SubscribeTripUpdates implements gtfs.FeedServiceServer.
+func (s *FeedServer) SubscribeTripUpdates(_ *emptypb.Empty, stream gtfs.FeedService_SubscribeTripUpdatesServer) error {
+	return subscribeToFeed(s.tripUpdates, stream)
+}
+
+// SubscribeVehiclePositions implements gtfs.FeedServiceServer.
+func (s *FeedServer) SubscribeVehiclePositions(_ *emptypb.Empty, stream gtfs.FeedService_SubscribeVehiclePositionsServer) error {
+	if s.vehiclePositions == nil {
+		return status.Error(codes.Unimplemented, "vehicle positions feed is not enabled")
+	}
+	return subscribeToFeed(s.vehiclePositions, stream)
+}
+
+func subscribeToFeed(f *Feed, stream grpc.ServerStream) error {
+	snapshots, cancel := f.subscribe()
+	defer cancel()
+	if msg := f.get().msg; msg != nil {
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case s := <-snapshots:
+			if err := stream.SendMsg(s.msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func getFeedMessage(f *Feed) (*gtfs.FeedMessage, error) {
+	msg := f.get().msg
+	if msg == nil {
+		return nil, status.Error(codes.Unavailable, "feed has not been built yet")
+	}
+	return msg, nil
+}
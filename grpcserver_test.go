@@ -0,0 +1,115 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestFeedServer(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	f, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	conn := newFeedServerConn(t, NewFeedServer(f, nil))
+
+	got := &gtfsrt.FeedMessage{}
+	if err := conn.Invoke(context.Background(), "/"+FeedServiceName+"/GetTripUpdates", &emptypb.Empty{}, got); err != nil {
+		t.Fatalf("GetTripUpdates() err got=%v, want=<nil>", err)
+	}
+	if diff := cmp.Diff(f.get().msg, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetTripUpdates() got != want, diff=%s", diff)
+	}
+
+	err = conn.Invoke(context.Background(), "/"+FeedServiceName+"/GetVehiclePositions", &emptypb.Empty{}, &gtfsrt.FeedMessage{})
+	if code := status.Code(err); code != codes.Unimplemented {
+		t.Errorf("GetVehiclePositions() code got=%s, want=%s", code, codes.Unimplemented)
+	}
+}
+
+func TestFeedServerSubscribe(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+	conn := newFeedServerConn(t, NewFeedServer(f, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := gtfsrt.NewFeedServiceClient(conn).SubscribeTripUpdates(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("SubscribeTripUpdates() err got=%v, want=<nil>", err)
+	}
+	for i, wantNumEntities := range []int{1, 2} {
+		if i > 0 {
+			client.stationToTrains[sourceapi.Station_HOBOKEN] = append(client.stationToTrains[sourceapi.Station_HOBOKEN],
+				sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 10))
+			c.Add(5 * time.Second)
+			<-updateSignal
+		}
+		got, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() err got=%v, want=<nil>", err)
+		}
+		if numEntities := len(got.GetEntity()); numEntities != wantNumEntities {
+			t.Errorf("message %d number of entities got=%d, want=%d", i, numEntities, wantNumEntities)
+		}
+	}
+}
+
+func TestFeedServerWarmingUp(t *testing.T) {
+	conn := newFeedServerConn(t, NewFeedServer(&Feed{}, nil))
+
+	err := conn.Invoke(context.Background(), "/"+FeedServiceName+"/GetTripUpdates", &emptypb.Empty{}, &gtfsrt.FeedMessage{})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Errorf("GetTripUpdates() code got=%s, want=%s", code, codes.Unavailable)
+	}
+}
+
+func newFeedServerConn(t *testing.T, feedServer *FeedServer) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	feedServer.Register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.Dial() err got=%v, want=<nil>", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
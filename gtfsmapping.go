@@ -1,6 +1,8 @@
 package pathgtfsrt
 
 import (
+	"sort"
+
 	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
 )
 
@@ -29,3 +31,52 @@ var sourceRouteToGtfsRouteId = map[sourceapi.Route]string{
 	sourceapi.Route_NWK_WTC:    "862",
 	sourceapi.Route_JSQ_33_HOB: "1024",
 }
+
+// StaticDataDrift describes how the static data retrieved from a source API differs from the
+// snapshots above.
+//
+// Drift may indicate a bug in the source API or a real change to the PATH system that requires
+// code changes.
+type StaticDataDrift struct {
+	AddedStations   []sourceapi.Station
+	RemovedStations []sourceapi.Station
+	ChangedStations []sourceapi.Station
+	AddedRoutes     []sourceapi.Route
+	RemovedRoutes   []sourceapi.Route
+	ChangedRoutes   []sourceapi.Route
+}
+
+// Empty returns true if there is no drift.
+func (d StaticDataDrift) Empty() bool {
+	return len(d.AddedStations)+len(d.RemovedStations)+len(d.ChangedStations)+
+		len(d.AddedRoutes)+len(d.RemovedRoutes)+len(d.ChangedRoutes) == 0
+}
+
+func computeStaticDataDrift(stationToStopId map[sourceapi.Station]string, routeToRouteId map[sourceapi.Route]string) StaticDataDrift {
+	var d StaticDataDrift
+	d.AddedStations, d.RemovedStations, d.ChangedStations = diffMapping(sourceStationToGtfsStopId, stationToStopId)
+	d.AddedRoutes, d.RemovedRoutes, d.ChangedRoutes = diffMapping(sourceRouteToGtfsRouteId, routeToRouteId)
+	return d
+}
+
+func diffMapping[K ~int32](baseline, live map[K]string) (added, removed, changed []K) {
+	for k, v := range live {
+		baselineV, ok := baseline[k]
+		if !ok {
+			added = append(added, k)
+		} else if baselineV != v {
+			changed = append(changed, k)
+		}
+	}
+	for k := range baseline {
+		if _, ok := live[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	for _, keys := range [][]K{added, removed, changed} {
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i] < keys[j]
+		})
+	}
+	return
+}
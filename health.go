@@ -0,0 +1,42 @@
+package pathgtfsrt
+
+import (
+	"fmt"
+	"time"
+)
+
+// CheckLive returns an error if the update loop of the feed is stuck: no update has completed
+// within the update period plus the provided timeout. This is suitable for a liveness probe, since
+// restarting the process is the only way to recover a stuck update loop. While updates are paused
+// the loop still progresses, so the feed is live.
+func (f *Feed) CheckLive(timeout time.Duration) error {
+	f.mutex.RLock()
+	progressed, updatePeriod := f.progressed, f.updatePeriod
+	f.mutex.RUnlock()
+	if stalled := f.clock.Since(progressed); stalled > updatePeriod+timeout {
+		return fmt.Errorf("update loop has not progressed for %s", stalled.Truncate(time.Second))
+	}
+	return nil
+}
+
+// CheckReady returns an error unless the feed has been built from the source API at least once,
+// and the most recent update with fresh data from the source API is at most the provided age.
+// Updates in which every request to the source API fails do not count. A feed restored from disk
+// using WithPersistence is not ready until it has been built. This is suitable for a readiness
+// probe, so that traffic is sent to other replicas while this one cannot reach the source API.
+func (f *Feed) CheckReady(maxAge time.Duration) error {
+	s := f.get()
+	if s.health.lastDataUpdate.IsZero() {
+		return fmt.Errorf("feed has not been built from the source API yet")
+	}
+	if age := f.clock.Since(s.health.lastDataUpdate); age > maxAge {
+		return fmt.Errorf("feed has no fresh data from the source API for %s", age.Truncate(time.Second))
+	}
+	return nil
+}
+
+func (f *Feed) markProgress() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.progressed = f.clock.Now()
+}
@@ -0,0 +1,86 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedCheckLive(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {},
+	})
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	if err := f.CheckLive(10 * time.Second); err != nil {
+		t.Errorf("CheckLive() after start up err got=%v, want=<nil>", err)
+	}
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	defer close(unblock)
+	client.onGetTrains = func() {
+		started <- struct{}{}
+		<-unblock
+	}
+
+	c.Add(5 * time.Second)
+	<-started
+	if err := f.CheckLive(10 * time.Second); err != nil {
+		t.Errorf("CheckLive() during an update err got=%v, want=<nil>", err)
+	}
+	c.Add(11 * time.Second)
+
+	if err := f.CheckLive(10 * time.Second); err == nil {
+		t.Errorf("CheckLive() with a stuck update err got=<nil>, want error")
+	}
+}
+
+func TestFeedCheckReady(t *testing.T) {
+	if err := (&Feed{clock: clock.NewMock()}).CheckReady(time.Minute); err == nil {
+		t.Errorf("CheckReady() before the first update err got=<nil>, want error")
+	}
+
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN:           {},
+		sourceapi.Station_FOURTEENTH_STREET: {},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+	if err := f.CheckReady(30 * time.Second); err != nil {
+		t.Errorf("CheckReady() after the first update err got=%v, want=<nil>", err)
+	}
+
+	// Updates in which only some requests fail still contain fresh data.
+	delete(client.stationToTrains, sourceapi.Station_FOURTEENTH_STREET)
+	for i := 0; i < 7; i++ {
+		c.Add(5 * time.Second)
+		<-updateSignal
+	}
+	if err := f.CheckReady(30 * time.Second); err != nil {
+		t.Errorf("CheckReady() with some failed requests err got=%v, want=<nil>", err)
+	}
+
+	delete(client.stationToTrains, sourceapi.Station_HOBOKEN)
+	for i := 0; i < 7; i++ {
+		c.Add(5 * time.Second)
+		<-updateSignal
+	}
+	if err := f.CheckReady(30 * time.Second); err == nil {
+		t.Errorf("CheckReady() with all requests failing for 35s err got=<nil>, want error")
+	}
+}
@@ -21,39 +21,49 @@ const (
 
 // HttpSourceClient is a source client that gets data using the Razza HTTP API.
 type HttpSourceClient struct {
-	httpClient    HttpClient
+	httpClient HttpClient
+	userAgent  string
+	baseUrl    string
 }
 
-func NewHttpSourceClient(httpClient HttpClient) *HttpSourceClient {
-	return &HttpSourceClient{httpClient: httpClient}
+func NewHttpSourceClient(httpClient HttpClient, opts ...SourceClientOption) *HttpSourceClient {
+	options := newSourceClientOptions(opts)
+	baseUrl := apiBaseUrl
+	if options.url != "" {
+		baseUrl = strings.TrimSuffix(options.url, "/") + "/"
+	}
+	return &HttpSourceClient{httpClient: httpClient, userAgent: options.userAgent, baseUrl: baseUrl}
 }
 
-func (client *HttpSourceClient) GetTrainsAtStation(_ context.Context, station sourceapi.Station) ([]Train, error) {
+func (client *HttpSourceClient) GetTrainsAtStation(ctx context.Context, station sourceapi.Station) ([]Train, error) {
 	type jsonUpcomingTrain struct {
 		ProjectedArrival  string
 		LastUpdated       string
 		RouteAsString     string `json:"route"`
 		DirectionAsString string `json:"direction"`
 		LineName          string `json:"lineName"`
+		Headsign          string `json:"headsign"`
 	}
 	type jsonGetUpcomingTrainsResponse struct {
 		Trains []jsonUpcomingTrain `json:"upcomingTrains"`
 	}
 	stationAsString := strings.ToLower(sourceapi.Station_name[int32(station)])
-	realtimeApiContent, err := client.getContent(fmt.Sprintf(apiRealtimeEndpoint, stationAsString))
+	endpoint := fmt.Sprintf(apiRealtimeEndpoint, stationAsString)
+	realtimeApiContent, err := client.getContent(ctx, endpoint)
 	if err != nil {
-		return nil, err
+		return nil, newStationFetchError(station, client.baseUrl+endpoint, err)
 	}
 	response := jsonGetUpcomingTrainsResponse{}
 	err = json.Unmarshal(realtimeApiContent, &response)
 	if err != nil {
-		return nil, err
+		return nil, newStationFetchError(station, client.baseUrl+endpoint, err)
 	}
 	var trains []Train
 	for _, rawUpcomingTrain := range response.Trains {
 		upcomingTrain := sourceapi.GetUpcomingTrainsResponse_UpcomingTrain{
 			Route:            client.convertRouteAsStringToRoute(rawUpcomingTrain.RouteAsString),
 			LineName:         rawUpcomingTrain.LineName,
+			Headsign:         rawUpcomingTrain.Headsign,
 			Direction:        client.convertDirectionAsStringToDirection(rawUpcomingTrain.DirectionAsString),
 			ProjectedArrival: client.convertApiTimeStringToTimestamp(rawUpcomingTrain.ProjectedArrival),
 			LastUpdated:      client.convertApiTimeStringToTimestamp(rawUpcomingTrain.LastUpdated),
@@ -64,8 +74,8 @@ func (client *HttpSourceClient) GetTrainsAtStation(_ context.Context, station so
 	return trains, nil
 }
 
-func (client *HttpSourceClient) GetStationToStopId(_ context.Context) (map[sourceapi.Station]string, error) {
-	stationsContent, err := client.getContent(apiStationsEndpoint)
+func (client *HttpSourceClient) GetStationToStopId(ctx context.Context) (map[sourceapi.Station]string, error) {
+	stationsContent, err := client.getContent(ctx, apiStationsEndpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -88,8 +98,8 @@ func (client *HttpSourceClient) GetStationToStopId(_ context.Context) (map[sourc
 	return stationToStopId, nil
 }
 
-func (client *HttpSourceClient) GetRouteToRouteId(_ context.Context) (map[sourceapi.Route]string, error) {
-	routesContent, err := client.getContent(apiRoutesEndpoint)
+func (client *HttpSourceClient) GetRouteToRouteId(ctx context.Context) (map[sourceapi.Route]string, error) {
+	routesContent, err := client.getContent(ctx, apiRoutesEndpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -133,8 +143,8 @@ func (client *HttpSourceClient) convertApiTimeStringToTimestamp(timeString strin
 }
 
 // Get the raw bytes from an endpoint in the API.
-func (client HttpSourceClient) getContent(endpoint string) (bytes []byte, err error) {
-	resp, err := client.httpClient.Get(apiBaseUrl + endpoint)
+func (client HttpSourceClient) getContent(ctx context.Context, endpoint string) (bytes []byte, err error) {
+	resp, err := httpGet(ctx, client.httpClient, client.baseUrl+endpoint, client.userAgent)
 	if err != nil {
 		return
 	}
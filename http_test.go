@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
@@ -34,6 +35,7 @@ func TestSourceHttpGetTrainsAtStation(t *testing.T) {
 					Route:            sourceapi.Route_JSQ_33_HOB,
 					Direction:        sourceapi.Direction_TO_NY,
 					LineName:         "33rd Street via Hoboken",
+					Headsign:         "33rd Street via Hoboken",
 					ProjectedArrival: mkTimestampFromRfc3339("2023-12-23T05:36:15Z"),
 					LastUpdated:      mkTimestampFromRfc3339("2023-12-23T05:35:44Z"),
 				},
@@ -41,6 +43,7 @@ func TestSourceHttpGetTrainsAtStation(t *testing.T) {
 					Route:            sourceapi.Route_JSQ_33_HOB,
 					Direction:        sourceapi.Direction_TO_NY,
 					LineName:         "33rd Street via Hoboken",
+					Headsign:         "33rd Street via Hoboken",
 					ProjectedArrival: mkTimestampFromRfc3339("2023-12-23T06:01:30Z"),
 					LastUpdated:      mkTimestampFromRfc3339("2023-12-23T05:35:44Z"),
 				},
@@ -48,6 +51,7 @@ func TestSourceHttpGetTrainsAtStation(t *testing.T) {
 					Route:            sourceapi.Route_JSQ_33_HOB,
 					Direction:        sourceapi.Direction_TO_NJ,
 					LineName:         "Journal Square via Hoboken",
+					Headsign:         "Journal Square via Hoboken",
 					ProjectedArrival: mkTimestampFromRfc3339("2023-12-23T05:36:15Z"),
 					LastUpdated:      mkTimestampFromRfc3339("2023-12-23T05:35:44Z"),
 				},
@@ -55,6 +59,7 @@ func TestSourceHttpGetTrainsAtStation(t *testing.T) {
 					Route:            sourceapi.Route_JSQ_33_HOB,
 					Direction:        sourceapi.Direction_TO_NJ,
 					LineName:         "Journal Square via Hoboken",
+					Headsign:         "Journal Square via Hoboken",
 					ProjectedArrival: mkTimestampFromRfc3339("2023-12-23T06:02:44Z"),
 					LastUpdated:      mkTimestampFromRfc3339("2023-12-23T05:35:44Z"),
 				},
@@ -70,6 +75,7 @@ func TestSourceHttpGetTrainsAtStation(t *testing.T) {
 					Route:            sourceapi.Route_JSQ_33,
 					Direction:        sourceapi.Direction_TO_NY,
 					LineName:         "33rd Street",
+					Headsign:         "33rd Street",
 					ProjectedArrival: mkTimestampFromRfc3339("2023-12-27T00:09:21Z"),
 					LastUpdated:      mkTimestampFromRfc3339("2023-12-27T00:01:24Z"),
 				},
@@ -89,6 +95,96 @@ func TestSourceHttpGetTrainsAtStation(t *testing.T) {
 	}
 }
 
+func TestSourceHttpUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		opts          []SourceClientOption
+		wantUserAgent string
+	}{
+		{
+			name:          "default",
+			wantUserAgent: DefaultUserAgent(),
+		},
+		{
+			name:          "configured",
+			opts:          []SourceClientOption{WithUserAgent("test-agent/1.0")},
+			wantUserAgent: "test-agent/1.0",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotUserAgent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserAgent = r.UserAgent()
+				fmt.Fprint(w, `{"routes": []}`)
+			}))
+			defer server.Close()
+
+			client := NewHttpSourceClient(newRedirectingHttpClient(t, server.URL), tc.opts...)
+			if _, err := client.GetRouteToRouteId(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if gotUserAgent != tc.wantUserAgent {
+				t.Errorf("User-Agent got=%q, want=%q", gotUserAgent, tc.wantUserAgent)
+			}
+		})
+	}
+}
+
+func TestSourceHttpApiUrl(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		fmt.Fprint(w, `{"routes": []}`)
+	}))
+	defer server.Close()
+
+	client := NewHttpSourceClient(http.DefaultClient, WithSourceApiUrl(server.URL+"/mirror/v1"))
+	if _, err := client.GetRouteToRouteId(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "/mirror/v1/routes/"; gotPath != want {
+		t.Errorf("request path got=%q, want=%q", gotPath, want)
+	}
+}
+
+func TestSourceHttpRequestId(t *testing.T) {
+	var gotRequestId string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRequestId = r.Header.Get(RequestIdHeader)
+		fmt.Fprint(w, `{"routes": []}`)
+	}))
+	defer server.Close()
+
+	client := NewHttpSourceClient(http.DefaultClient, WithSourceApiUrl(server.URL+"/v1"))
+	ctx := ContextWithRequestId(context.Background(), "abc123")
+	if _, err := client.GetRouteToRouteId(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotRequestId != "abc123" {
+		t.Errorf("%s header got=%q, want=%q", RequestIdHeader, gotRequestId, "abc123")
+	}
+}
+
+// Returns an HTTP client that sends all requests to the provided server URL.
+func newRedirectingHttpClient(t *testing.T, serverURL string) *http.Client {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) err got=%v, want=<nil>", serverURL, err)
+	}
+	return &http.Client{Transport: redirectingTransport{url: u}}
+}
+
+type redirectingTransport struct {
+	url *url.URL
+}
+
+func (rt redirectingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = rt.url.Scheme
+	r.URL.Host = rt.url.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
 func mkTimestampFromRfc3339(timeString string) *timestamp.Timestamp {
 	timeObj, err := time.Parse(time.RFC3339, timeString)
 	if err != nil {
@@ -1,7 +1,76 @@
 package pathgtfsrt
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
 
 type HttpClient interface {
 	Get(url string) (resp *http.Response, err error)
 }
+
+// DefaultUserAgent returns the User-Agent sent on requests to the HTTP source APIs when none is
+// configured.
+func DefaultUserAgent() string {
+	version := BuildNumber
+	if version == "" {
+		version = "dev"
+	}
+	return "path-train-gtfs-realtime/" + version
+}
+
+// SourceClientOption configures optional behavior of the HTTP source clients.
+type SourceClientOption func(*sourceClientOptions)
+
+type sourceClientOptions struct {
+	userAgent string
+	url       string
+}
+
+func newSourceClientOptions(opts []SourceClientOption) sourceClientOptions {
+	options := sourceClientOptions{userAgent: DefaultUserAgent()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithUserAgent sets the User-Agent header sent on requests to the source API.
+// The default is DefaultUserAgent().
+func WithUserAgent(userAgent string) SourceClientOption {
+	return func(o *sourceClientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithSourceApiUrl sets the URL the source API is requested from, instead of the public API; e.g.,
+// to use a mirror or a proxy. For the HTTP API it is the base URL of the endpoints, and for the
+// PANYNJ API it is the URL of the JSON file.
+func WithSourceApiUrl(url string) SourceClientOption {
+	return func(o *sourceClientOptions) {
+		o.url = url
+	}
+}
+
+// Performs a GET request with the provided User-Agent, and the request ID of the context; see
+// ContextWithRequestId.
+//
+// The headers and the context can only be set if the HTTP client can send arbitrary requests, as
+// *http.Client can. Otherwise the request is sent using the client's Get method.
+func httpGet(ctx context.Context, httpClient HttpClient, url string, userAgent string) (*http.Response, error) {
+	doer, ok := httpClient.(interface {
+		Do(req *http.Request) (*http.Response, error)
+	})
+	if !ok {
+		return httpClient.Get(url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if requestId := RequestIdFromContext(ctx); requestId != "" {
+		req.Header.Set(RequestIdHeader, requestId)
+	}
+	return doer.Do(req)
+}
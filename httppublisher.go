@@ -0,0 +1,109 @@
+package pathgtfsrt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// HttpPublisher is a publisher that POSTs the feed to a URL, such as the ingestion endpoint of a
+// downstream aggregator, so that the downstream does not need to poll the feed.
+type HttpPublisher struct {
+	httpClient *http.Client
+	clock      clock.Clock
+	url        string
+	options    httpPublisherOptions
+}
+
+// HttpPublisherOption configures optional behavior of the HTTP publisher.
+type HttpPublisherOption func(*httpPublisherOptions)
+
+type httpPublisherOptions struct {
+	header         http.Header
+	retries        int
+	initialBackoff time.Duration
+	logOutput      io.Writer
+}
+
+// WithHttpPublisherHeader adds a header to each request, such as an Authorization header.
+func WithHttpPublisherHeader(name, value string) HttpPublisherOption {
+	return func(o *httpPublisherOptions) {
+		o.header.Add(name, value)
+	}
+}
+
+// WithHttpPublisherRetries sets how many times a failed request is retried, and how long to wait
+// before the first retry. The wait doubles after each retry. Requests are retried if they fail
+// without a response, or if the response status is 429 or 5xx. The default is 3 retries with an
+// initial wait of 1 second.
+func WithHttpPublisherRetries(retries int, initialBackoff time.Duration) HttpPublisherOption {
+	return func(o *httpPublisherOptions) {
+		o.retries = retries
+		o.initialBackoff = initialBackoff
+	}
+}
+
+// WithHttpPublisherLogOutput makes the publisher write warnings about retried requests to the
+// provided writer rather than to stdout.
+func WithHttpPublisherLogOutput(w io.Writer) HttpPublisherOption {
+	return func(o *httpPublisherOptions) {
+		o.logOutput = w
+	}
+}
+
+// NewHttpPublisher creates a publisher that POSTs the feed to the provided URL with Content-Type
+// application/x-protobuf.
+func NewHttpPublisher(httpClient *http.Client, clock clock.Clock, url string, opts ...HttpPublisherOption) *HttpPublisher {
+	options := httpPublisherOptions{header: http.Header{}, retries: 3, initialBackoff: time.Second, logOutput: os.Stdout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &HttpPublisher{httpClient: httpClient, clock: clock, url: url, options: options}
+}
+
+// Publish POSTs the feed, retrying if the request fails.
+func (p *HttpPublisher) Publish(ctx context.Context, feed []byte) error {
+	backoff := p.options.initialBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := p.post(ctx, feed)
+		if err == nil || !retry || attempt >= p.options.retries {
+			return err
+		}
+		fmt.Fprintf(p.options.logOutput, "Warning: failed to push feed to %s, retrying in %s: %s\n", p.url, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.clock.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Sends a single request and returns whether the request can be retried if it failed.
+func (p *HttpPublisher) post(ctx context.Context, feed []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(feed))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range p.options.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s pushing to %s: %s", resp.Status, p.url, body)
+}
@@ -0,0 +1,81 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+func TestHttpPublisher(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "success",
+			statuses:     []int{http.StatusNoContent},
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry then success",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 3,
+		},
+		{
+			name:         "retries exhausted",
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "client error is not retried",
+			statuses:     []int{http.StatusUnauthorized},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer token" {
+					t.Errorf("Authorization got=%q, want=%q", got, "Bearer token")
+				}
+				if got := r.Header.Get("Content-Type"); got != "application/x-protobuf" {
+					t.Errorf("Content-Type got=%q, want=%q", got, "application/x-protobuf")
+				}
+				if body, _ := io.ReadAll(r.Body); string(body) != "feed" {
+					t.Errorf("body got=%q, want=%q", body, "feed")
+				}
+				w.WriteHeader(tc.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+			var log strings.Builder
+			publisher := NewHttpPublisher(server.Client(), clock.New(), server.URL,
+				WithHttpPublisherHeader("Authorization", "Bearer token"),
+				WithHttpPublisherRetries(2, time.Millisecond),
+				WithHttpPublisherLogOutput(&log))
+
+			err := publisher.Publish(context.Background(), []byte("feed"))
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Publish() err got=%v, want error=%t", err, tc.wantErr)
+			}
+			if attempts != tc.wantAttempts {
+				t.Errorf("attempts got=%d, want=%d", attempts, tc.wantAttempts)
+			}
+			// A warning is logged before each retry.
+			if got := strings.Count(log.String(), "Warning: "); got != tc.wantAttempts-1 {
+				t.Errorf("warnings got=%d, want=%d", got, tc.wantAttempts-1)
+			}
+		})
+	}
+}
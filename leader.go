@@ -0,0 +1,168 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// Extends the lease if it is still held by this instance.
+const redisRenewLeaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// Releases the lease if it is still held by this instance.
+const redisReleaseLeaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// RedisLeaderElector elects a single leader among multiple instances using a lease stored under a
+// key in Redis, so that in multi-replica deployments only the leader polls the source API.
+//
+// The lease expires if the leader stops renewing it; e.g., because it crashed. Another instance
+// then becomes the leader within the lease duration.
+type RedisLeaderElector struct {
+	clock  clock.Clock
+	client *redisClient
+	key    string
+	id     string
+	ttl    time.Duration
+	// How long after the lease was acquired or last renewed the leader steps down if it could not
+	// renew it since, so that it stops acting as the leader before the lease expires.
+	stepDown time.Duration
+	options  redisLeaderElectorOptions
+
+	lostOnce sync.Once
+	lost     chan struct{}
+	stopped  chan struct{}
+}
+
+// RedisLeaderElectorOption configures optional behavior of a RedisLeaderElector.
+type RedisLeaderElectorOption func(*redisLeaderElectorOptions)
+
+type redisLeaderElectorOptions struct {
+	logOutput io.Writer
+}
+
+// WithRedisLeaderElectorLogOutput makes the elector write warnings about failures to acquire or
+// renew the lease to the provided writer rather than to stdout.
+func WithRedisLeaderElectorLogOutput(w io.Writer) RedisLeaderElectorOption {
+	return func(o *redisLeaderElectorOptions) {
+		o.logOutput = w
+	}
+}
+
+// NewRedisLeaderElector creates an elector using the Redis server at the provided URL; see
+// NewRedisPublisher. The ID identifies this instance and must be unique among the instances, such
+// as the host name. The lease is renewed every third of its duration. If it cannot be renewed, the
+// leader steps down the timeout plus a tenth of the lease duration before the lease expires, to
+// allow for a request in flight and for clock drift; the lease duration must leave time to renew
+// the lease at least once before then.
+func NewRedisLeaderElector(clock clock.Clock, redisURL, key, id string, ttl, timeout time.Duration, opts ...RedisLeaderElectorOption) (*RedisLeaderElector, error) {
+	stepDown := ttl - timeout - ttl/10
+	if stepDown <= ttl/3 {
+		return nil, fmt.Errorf("leader lease duration %s is too short for the timeout %s", ttl, timeout)
+	}
+	client, err := newRedisClient(redisURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	options := redisLeaderElectorOptions{logOutput: os.Stdout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &RedisLeaderElector{clock: clock, client: client, key: key, id: id, ttl: ttl, stepDown: stepDown,
+		options: options, lost: make(chan struct{}), stopped: make(chan struct{})}, nil
+}
+
+// Campaign blocks until this instance becomes the leader or the context is cancelled. Once it is
+// the leader, the lease is renewed in the background until the context is cancelled, at which
+// point the lease is released, or until the lease is lost; see Lost and Stopped.
+func (e *RedisLeaderElector) Campaign(ctx context.Context) error {
+	for {
+		// The lease expires at the latest its duration after the request to acquire it was sent.
+		start := e.clock.Now()
+		acquired, err := e.tryAcquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(e.options.logOutput, "Warning: failed to acquire leader lease %s: %s\n", e.key, err)
+		}
+		if acquired {
+			go e.renew(ctx, start)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			e.client.Close()
+			close(e.stopped)
+			return ctx.Err()
+		case <-e.clock.After(e.ttl / 3):
+		}
+	}
+}
+
+// Lost returns a channel that is closed if this instance was the leader and the lease is held by
+// another instance, or could not be renewed and is about to expire. Another instance may then be
+// the leader, so this instance must stop acting as the leader.
+func (e *RedisLeaderElector) Lost() <-chan struct{} {
+	return e.lost
+}
+
+// Stopped returns a channel that is closed once this instance has stopped campaigning and
+// renewing the lease: after the context passed to Campaign is cancelled and the lease, if held,
+// is released, or after the lease is lost. Callers shutting down should wait for it so that the
+// other instances need not wait for the lease to expire.
+func (e *RedisLeaderElector) Stopped() <-chan struct{} {
+	return e.stopped
+}
+
+func (e *RedisLeaderElector) tryAcquire(ctx context.Context) (bool, error) {
+	_, err := e.client.command(ctx, "SET", e.key, e.id, "NX", "PX", strconv.FormatInt(e.ttl.Milliseconds(), 10))
+	if err == errRedisNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Renews the lease, which was acquired at the provided time, until the context is cancelled or the
+// lease is lost.
+func (e *RedisLeaderElector) renew(ctx context.Context, renewed time.Time) {
+	defer close(e.stopped)
+	defer e.client.Close()
+	for {
+		// After a failed renewal, the next attempt is made no later than the step down time.
+		wait := e.ttl / 3
+		if untilStepDown := renewed.Add(e.stepDown).Sub(e.clock.Now()); untilStepDown < wait {
+			wait = untilStepDown
+		}
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), e.client.timeout)
+			defer cancel()
+			e.client.command(releaseCtx, "EVAL", redisReleaseLeaseScript, "1", e.key, e.id)
+			return
+		case <-e.clock.After(wait):
+		}
+		start := e.clock.Now()
+		if start.Sub(renewed) >= e.stepDown {
+			fmt.Fprintf(e.options.logOutput, "Warning: could not renew leader lease %s before it expires\n", e.key)
+			e.lostOnce.Do(func() { close(e.lost) })
+			return
+		}
+		reply, err := e.client.command(ctx, "EVAL", redisRenewLeaseScript, "1", e.key, e.id, strconv.FormatInt(e.ttl.Milliseconds(), 10))
+		if err == nil && reply == int64(1) {
+			renewed = start
+			continue
+		}
+		if err == nil {
+			fmt.Fprintf(e.options.logOutput, "Warning: leader lease %s is held by another instance\n", e.key)
+			e.lostOnce.Do(func() { close(e.lost) })
+			return
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+		fmt.Fprintf(e.options.logOutput, "Warning: failed to renew leader lease %s: %s\n", e.key, err)
+	}
+}
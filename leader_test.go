@@ -0,0 +1,122 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+func TestRedisLeaderElector(t *testing.T) {
+	address, server := runFakeRedisServer(t)
+	c := clock.NewMock()
+	newElector := func(id string) *RedisLeaderElector {
+		e, err := NewRedisLeaderElector(c, "redis://"+address, "leader", id, 3*time.Second, time.Second)
+		if err != nil {
+			t.Fatalf("NewRedisLeaderElector() err got=%v, want=<nil>", err)
+		}
+		return e
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leader := newElector("a")
+	if err := leader.Campaign(ctx); err != nil {
+		t.Fatalf("Campaign() err got=%v, want=<nil>", err)
+	}
+
+	follower := newElector("b")
+	followerCtx, cancelFollower := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelFollower()
+	if err := follower.Campaign(followerCtx); err == nil {
+		t.Errorf("Campaign() of follower err got=<nil>, want error")
+	}
+
+	// Another instance takes the lease, e.g. because this instance was paused for longer than the
+	// lease duration.
+	server.mutex.Lock()
+	server.values["leader"] = "b"
+	server.mutex.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for lost := false; !lost; {
+		c.Add(time.Second)
+		select {
+		case <-leader.Lost():
+			lost = true
+		case <-time.After(10 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatalf("Lost() was not closed after the lease was taken")
+			}
+		}
+	}
+}
+
+func TestRedisLeaderElectorStepsDownBeforeLeaseExpires(t *testing.T) {
+	address, server := runFakeRedisServer(t)
+	c := clock.NewMock()
+	var log strings.Builder
+	e, err := NewRedisLeaderElector(c, "redis://"+address, "leader", "a", 3*time.Second, time.Second,
+		WithRedisLeaderElectorLogOutput(&log))
+	if err != nil {
+		t.Fatalf("NewRedisLeaderElector() err got=%v, want=<nil>", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := e.Campaign(ctx); err != nil {
+		t.Fatalf("Campaign() err got=%v, want=<nil>", err)
+	}
+
+	// The lease cannot be renewed, so the leader steps down after 3s - 1s - 300ms, before the lease
+	// expires and before a renewal in flight could time out after it expired.
+	server.mutex.Lock()
+	server.errReply = "ERR unavailable"
+	server.mutex.Unlock()
+	for elapsed := time.Duration(0); ; elapsed += 100 * time.Millisecond {
+		select {
+		case <-e.Lost():
+			if elapsed < 1700*time.Millisecond {
+				t.Errorf("Lost() closed after %s, want after 1.7s", elapsed)
+			}
+			if want := "could not renew leader lease leader before it expires"; !strings.Contains(log.String(), want) {
+				t.Errorf("log output got=%q, want to contain %q", log.String(), want)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		if elapsed >= 2*time.Second {
+			t.Fatalf("Lost() was not closed after %s, want after 1.7s", elapsed)
+		}
+		c.Add(100 * time.Millisecond)
+	}
+}
+
+func TestNewRedisLeaderElector_LeaseTooShort(t *testing.T) {
+	if _, err := NewRedisLeaderElector(clock.NewMock(), "redis://localhost", "leader", "a", 3*time.Second, 2*time.Second); err == nil {
+		t.Errorf("NewRedisLeaderElector() err got=<nil>, want error")
+	}
+}
+
+func TestRedisLeaderElectorReleasesLease(t *testing.T) {
+	address, server := runFakeRedisServer(t)
+	e, err := NewRedisLeaderElector(clock.NewMock(), "redis://"+address, "leader", "a", 3*time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("NewRedisLeaderElector() err got=%v, want=<nil>", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := e.Campaign(ctx); err != nil {
+		t.Fatalf("Campaign() err got=%v, want=<nil>", err)
+	}
+	cancel()
+	select {
+	case <-e.Stopped():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Stopped() was not closed after the context was cancelled")
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if value, ok := server.values["leader"]; ok {
+		t.Errorf("lease got=%q, want released", value)
+	}
+}
@@ -0,0 +1,145 @@
+package pathgtfsrt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithPrometheusMetrics registers Prometheus metrics about the updates of the feed with the
+// provided registerer, so that programs embedding the feed get the same metrics as the binary in
+// this repository: the number of updates and of source API errors, the time of the last update, the
+// duration of updates and of their phases, the number of skipped trains, the size of the feed and
+// its number of entities, trip stop times and trips, and the static data drift.
+//
+// The metric names start with path_train_gtfsrt_, or path_train_gtfsrt_vehicle_positions_ for a feed
+// returned by NewVehiclePositionFeed, except that the size and the number of entities of both feeds
+// are path_train_gtfsrt_feed_size_bytes and path_train_gtfsrt_feed_entities with a feed label
+// (gtfsrt or vehicle_positions). A trip updates feed and its vehicle positions feed can therefore
+// share a registerer. To register the metrics of several trip updates feeds with one registerer,
+// wrap it using prometheus.WrapRegistererWith with a label that distinguishes the feeds; otherwise
+// NewFeed fails because the metrics are already registered.
+func WithPrometheusMetrics(registerer prometheus.Registerer) FeedOption {
+	return func(o *feedOptions) {
+		o.registerer = registerer
+	}
+}
+
+// The Prometheus metrics of a feed; see WithPrometheusMetrics.
+type feedMetrics struct {
+	numUpdates      prometheus.Counter
+	numRequestErrs  prometheus.Counter
+	lastUpdate      prometheus.Gauge
+	phaseDuration   *prometheus.HistogramVec
+	updateDuration  prometheus.Histogram
+	numSkipped      *prometheus.CounterVec
+	size            prometheus.Gauge
+	numEntities     prometheus.Gauge
+	numStopTimes    *prometheus.GaugeVec
+	numTrips        *prometheus.GaugeVec
+	staticDataDrift *prometheus.GaugeVec
+}
+
+func newFeedMetrics(registerer prometheus.Registerer, vehiclePositions bool) (*feedMetrics, error) {
+	feed, prefix := "gtfsrt", "path_train_gtfsrt_"
+	if vehiclePositions {
+		feed, prefix = "vehicle_positions", "path_train_gtfsrt_vehicle_positions_"
+	}
+	m := &feedMetrics{
+		numUpdates: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefix + "num_updates",
+			Help: "Number of completed updates",
+		}),
+		numRequestErrs: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefix + "num_source_api_errors",
+			Help: "Number of errors when retrieving realtime data from the source API",
+		}),
+		lastUpdate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prefix + "last_update",
+			Help: "Time of the last completed update",
+		}),
+		phaseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: prefix + "update_phase_duration_seconds",
+			Help: "Duration of each phase (fetch, build, marshal) of an update",
+		}, []string{"phase"}),
+		updateDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    prefix + "update_duration_seconds",
+			Help:    "Duration of each update, from the first request to the source API until the feed is serialized",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+		}),
+		numSkipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "num_skipped_trains",
+			Help: "Number of upcoming trains from the source API left out of the feed, by the missing data (route, direction, arrival or last_updated), summed over updates",
+		}, []string{"missing"}),
+		size: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "path_train_gtfsrt_feed_size_bytes",
+			Help:        "Size of the serialized feed built by the last update, by feed",
+			ConstLabels: prometheus.Labels{"feed": feed},
+		}),
+		numEntities: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "path_train_gtfsrt_feed_entities",
+			Help:        "Number of entities in the feed built by the last update, by feed",
+			ConstLabels: prometheus.Labels{"feed": feed},
+		}),
+		numStopTimes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "num_trip_stop_times",
+			Help: "Number of trip stop times per station and direction",
+		}, []string{"stop_id", "direction"}),
+		numTrips: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "num_trips",
+			Help: "Number of upcoming trains per route and direction",
+		}, []string{"route_id", "direction"}),
+		staticDataDrift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "static_data_drift",
+			Help: "Number of stations and routes in the source API static data that differ from the built-in snapshot",
+		}, []string{"kind", "change"}),
+	}
+	for _, c := range []prometheus.Collector{
+		m.numUpdates, m.numRequestErrs, m.lastUpdate, m.phaseDuration, m.updateDuration, m.numSkipped,
+		m.size, m.numEntities, m.numStopTimes, m.numTrips, m.staticDataDrift,
+	} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *feedMetrics) recordUpdate(result UpdateResult, durations UpdatePhaseDurations, skipped SkippedTrains) {
+	msg := result.Msg
+	m.numUpdates.Inc()
+	m.numRequestErrs.Add(float64(len(result.StationErrs)))
+	m.lastUpdate.SetToCurrentTime()
+	m.phaseDuration.WithLabelValues("fetch").Observe(durations.Fetch.Seconds())
+	m.phaseDuration.WithLabelValues("build").Observe(durations.Build.Seconds())
+	m.phaseDuration.WithLabelValues("marshal").Observe(durations.Marshal.Seconds())
+	m.updateDuration.Observe(result.Duration.Seconds())
+	m.numSkipped.WithLabelValues("route").Add(float64(skipped.MissingRoute))
+	m.numSkipped.WithLabelValues("direction").Add(float64(skipped.MissingDirection))
+	m.numSkipped.WithLabelValues("arrival").Add(float64(skipped.MissingArrival))
+	m.numSkipped.WithLabelValues("last_updated").Add(float64(skipped.MissingLastUpdated))
+	m.size.Set(float64(result.Bytes))
+	m.numEntities.Set(float64(len(msg.GetEntity())))
+	m.numStopTimes.Reset()
+	m.numTrips.Reset()
+	for _, entity := range msg.GetEntity() {
+		if entity.TripUpdate == nil {
+			continue
+		}
+		direction := "NY"
+		if entity.GetTripUpdate().GetTrip().GetDirectionId() == 0 {
+			direction = "NJ"
+		}
+		m.numTrips.WithLabelValues(entity.GetTripUpdate().GetTrip().GetRouteId(), direction).Inc()
+		for _, stopTimeUpdate := range entity.GetTripUpdate().GetStopTimeUpdate() {
+			m.numStopTimes.WithLabelValues(stopTimeUpdate.GetStopId(), direction).Inc()
+		}
+	}
+}
+
+func (m *feedMetrics) recordStaticDataDrift(drift StaticDataDrift) {
+	m.staticDataDrift.WithLabelValues("station", "added").Set(float64(len(drift.AddedStations)))
+	m.staticDataDrift.WithLabelValues("station", "removed").Set(float64(len(drift.RemovedStations)))
+	m.staticDataDrift.WithLabelValues("station", "changed").Set(float64(len(drift.ChangedStations)))
+	m.staticDataDrift.WithLabelValues("route", "added").Set(float64(len(drift.AddedRoutes)))
+	m.staticDataDrift.WithLabelValues("route", "removed").Set(float64(len(drift.RemovedRoutes)))
+	m.staticDataDrift.WithLabelValues("route", "changed").Set(float64(len(drift.ChangedRoutes)))
+}
@@ -0,0 +1,129 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFeedWithPrometheusMetrics(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			// Missing the route, so skipped.
+			{
+				Direction:        sourceapi.Direction_TO_NJ,
+				ProjectedArrival: makeTimestamppb(5),
+				LastUpdated:      makeTimestamppb(10),
+			},
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {},
+	})
+	registry := prometheus.NewRegistry()
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(UpdateResult) {},
+		WithPrometheusMetrics(registry))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"path_train_gtfsrt_num_updates", nil, 1},
+		{"path_train_gtfsrt_num_source_api_errors", nil, 0},
+		{"path_train_gtfsrt_feed_entities", map[string]string{"feed": "gtfsrt"}, 1},
+		{"path_train_gtfsrt_num_trips", map[string]string{"route_id": routeID1, "direction": "NY"}, 1},
+		{"path_train_gtfsrt_num_trip_stop_times", map[string]string{"stop_id": stopIDHoboken, "direction": "NY"}, 1},
+		{"path_train_gtfsrt_num_skipped_trains", map[string]string{"missing": "route"}, 1},
+		{"path_train_gtfsrt_num_skipped_trains", map[string]string{"missing": "arrival"}, 0},
+	} {
+		if got := gatheredValue(t, registry, tc.name, tc.labels); got != tc.want {
+			t.Errorf("%s%v got=%v, want=%v", tc.name, tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestVehiclePositionFeedWithPrometheusMetrics(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+		},
+	})
+	registry := prometheus.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := clock.NewMock()
+	tripUpdatesFeed, err := NewFeed(ctx, c, 5*time.Second, client, nil, WithPrometheusMetrics(registry))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	vehiclePositionFeed, err := NewVehiclePositionFeed(ctx, c, tripUpdatesFeed, nil, WithPrometheusMetrics(registry))
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+
+	// The metrics of the trip updates feed are unchanged by the vehicle positions feed.
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"path_train_gtfsrt_num_updates", nil, 1},
+		{"path_train_gtfsrt_vehicle_positions_num_updates", nil, 1},
+		{"path_train_gtfsrt_feed_entities", map[string]string{"feed": "gtfsrt"}, 1},
+		{"path_train_gtfsrt_feed_entities", map[string]string{"feed": "vehicle_positions"},
+			float64(len(vehiclePositionFeed.GetMessage().GetEntity()))},
+	} {
+		if got := gatheredValue(t, registry, tc.name, tc.labels); got != tc.want {
+			t.Errorf("%s%v got=%v, want=%v", tc.name, tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestFeedWithPrometheusMetricsAlreadyRegistered(t *testing.T) {
+	client := newTestSourceClient(nil)
+	registry := prometheus.NewRegistry()
+	for i, wantErr := range []bool{false, true} {
+		_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+			func(UpdateResult) {},
+			WithPrometheusMetrics(registry))
+		if (err != nil) != wantErr {
+			t.Errorf("NewFeed() call %d err got=%v, want error=%t", i, err, wantErr)
+		}
+	}
+}
+
+// Returns the value of the counter or gauge with the provided name and labels.
+func gatheredValue(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() err got=%v, want=<nil>", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			if metric.GetCounter() != nil {
+				return metric.GetCounter().GetValue()
+			}
+			return metric.GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("metric %s%v not found", name, labels)
+	return 0
+}
@@ -0,0 +1,151 @@
+package pathgtfsrt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type natsMessage struct {
+	connect map[string]interface{}
+	subject string
+	payload string
+}
+
+// Runs a fake NATS server that accepts a single connection and sends the received messages on the
+// returned channel. Publishes to the subject "reject" are answered with -ERR.
+func runFakeNatsServer(t *testing.T) (string, <-chan natsMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan natsMessage, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1024}\r\n")
+		reader := bufio.NewReader(conn)
+		var connect map[string]interface{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "CONNECT":
+				json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &connect)
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case "PUB":
+				var n int
+				fmt.Sscan(fields[2], &n)
+				payload := make([]byte, n+2)
+				if _, err := io.ReadFull(reader, payload); err != nil {
+					return
+				}
+				if fields[1] == "reject" {
+					fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish to reject'\r\n")
+					continue
+				}
+				// Simulate the server pinging an idle client.
+				fmt.Fprint(conn, "PING\r\n")
+				messages <- natsMessage{connect: connect, subject: fields[1], payload: string(payload[:n])}
+			}
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func TestNatsPublisher(t *testing.T) {
+	address, messages := runFakeNatsServer(t)
+	publisher, err := NewNatsPublisher("nats://alice:secret@"+address, "path.gtfsrt", time.Second)
+	if err != nil {
+		t.Fatalf("NewNatsPublisher() err got=%v, want=<nil>", err)
+	}
+	defer publisher.Close()
+
+	for _, feed := range []string{"feed1", "feed2"} {
+		if err := publisher.Publish(context.Background(), []byte(feed)); err != nil {
+			t.Fatalf("Publish() err got=%v, want=<nil>", err)
+		}
+		got := <-messages
+		if got.subject != "path.gtfsrt" {
+			t.Errorf("subject got=%s, want=%s", got.subject, "path.gtfsrt")
+		}
+		if got.payload != feed {
+			t.Errorf("payload got=%s, want=%s", got.payload, feed)
+		}
+		if got.connect["user"] != "alice" || got.connect["pass"] != "secret" {
+			t.Errorf("CONNECT got=%v, want user=alice and pass=secret", got.connect)
+		}
+	}
+
+	if err := publisher.Publish(context.Background(), make([]byte, 2000)); err == nil {
+		t.Errorf("Publish() of oversized feed err got=<nil>, want error")
+	}
+}
+
+func TestNatsPublisher_ServerError(t *testing.T) {
+	address, _ := runFakeNatsServer(t)
+	publisher, err := NewNatsPublisher(address, "reject", time.Second)
+	if err != nil {
+		t.Fatalf("NewNatsPublisher() err got=%v, want=<nil>", err)
+	}
+	defer publisher.Close()
+
+	err = publisher.Publish(context.Background(), []byte("feed"))
+
+	if err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Publish() err got=%v, want permissions violation", err)
+	}
+}
+
+func TestNewNatsPublisher_UnsupportedURL(t *testing.T) {
+	for _, natsURL := range []string{"tls://localhost:4222", "http://localhost:4222"} {
+		if _, err := NewNatsPublisher(natsURL, "path.gtfsrt", time.Second); err == nil {
+			t.Errorf("NewNatsPublisher(%q) err got=<nil>, want error", natsURL)
+		}
+	}
+}
+
+func TestNatsPublisher_TlsRequired(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"tls_required\":true}\r\n")
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+	publisher, err := NewNatsPublisher("nats://alice:secret@"+listener.Addr().String(), "path.gtfsrt", time.Second)
+	if err != nil {
+		t.Fatalf("NewNatsPublisher() err got=%v, want=<nil>", err)
+	}
+	defer publisher.Close()
+
+	if err := publisher.Publish(context.Background(), []byte("feed")); err == nil {
+		t.Errorf("Publish() err got=<nil>, want error")
+	}
+	if line := <-received; line != "" {
+		t.Errorf("received after INFO got=%q, want nothing", line)
+	}
+}
@@ -29,6 +29,8 @@ type cachedContent struct {
 // It is what is used to power the official realtime schedules on the PATH website: https://www.panynj.gov/path/en/index.html
 type PaNyNjClient struct {
 	httpClient    HttpClient
+	userAgent     string
+	url           string
 	clock         clock.Clock
 	cachedContent *cachedContent
 	mu            sync.RWMutex
@@ -90,19 +92,24 @@ type Message struct {
 	LastUpdated        string `json:"lastUpdated"`
 }
 
-func NewPaNyNjSourceClient(httpClient HttpClient, clock clock.Clock) *PaNyNjClient {
-	return &PaNyNjClient{httpClient: httpClient, clock: clock}
+func NewPaNyNjSourceClient(httpClient HttpClient, clock clock.Clock, opts ...SourceClientOption) *PaNyNjClient {
+	options := newSourceClientOptions(opts)
+	url := paNyNjApiUrl
+	if options.url != "" {
+		url = options.url
+	}
+	return &PaNyNjClient{httpClient: httpClient, userAgent: options.userAgent, url: url, clock: clock}
 }
 
-func (client *PaNyNjClient) GetTrainsAtStation(_ context.Context, station sourceapi.Station) ([]Train, error) {
-	realtimeApiContent, err := client.getContent()
+func (client *PaNyNjClient) GetTrainsAtStation(ctx context.Context, station sourceapi.Station) ([]Train, error) {
+	realtimeApiContent, err := client.getContent(ctx)
 	if err != nil {
-		return nil, err
+		return nil, newStationFetchError(station, client.url, err)
 	}
 	response := RidePathResponse{}
 	err = json.Unmarshal(realtimeApiContent, &response)
 	if err != nil {
-		return nil, err
+		return nil, newStationFetchError(station, client.url, err)
 	}
 	var trains []Train
 	for _, result := range response.Results {
@@ -114,10 +121,11 @@ func (client *PaNyNjClient) GetTrainsAtStation(_ context.Context, station source
 			for _, message := range destination.Messages {
 				lastUpdated, err := client.convertApiLastUpdatedTimeStringToTimestamp(message.LastUpdated)
 				if err != nil {
-					return nil, err
+					return nil, newStationFetchError(station, client.url, err)
 				}
 				upcomingTrain := sourceapi.GetUpcomingTrainsResponse_UpcomingTrain{
 					Route:            client.convertLineColorToRoute(message.LineColor),
+					Headsign:         message.HeadSign,
 					Direction:        client.convertDirectionAsStringToDirection(destination.Label),
 					ProjectedArrival: client.convertApiSecondsToArrivalAsStringToTimestamp(lastUpdated, message.SecondsToArrival),
 					LastUpdated:      lastUpdated,
@@ -181,7 +189,7 @@ func (client *PaNyNjClient) convertApiSecondsToArrivalAsStringToTimestamp(lastUp
 }
 
 // Get the raw bytes from an endpoint in the API.
-func (client *PaNyNjClient) getContent() (bytes []byte, err error) {
+func (client *PaNyNjClient) getContent(ctx context.Context) (bytes []byte, err error) {
 	client.mu.RLock()
 	cachedData, err, ok := client.getCachedContent()
 	if ok {
@@ -199,8 +207,8 @@ func (client *PaNyNjClient) getContent() (bytes []byte, err error) {
 		return cachedData, err
 	}
 
-	url := attachTimestampToUrl(paNyNjApiUrl, client.clock)
-	resp, err := client.httpClient.Get(url)
+	url := attachTimestampToUrl(client.url, client.clock)
+	resp, err := httpGet(ctx, client.httpClient, url, client.userAgent)
 	if err != nil {
 		client.cachedContent = &cachedContent{timestamp: client.clock.Now(), data: nil, error: err}
 		return nil, err
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strconv"
@@ -30,12 +32,14 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950359),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950959),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
@@ -47,24 +51,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950304),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702951175),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950461),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:57.869032-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702951061),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:57.869032-05:00"),
@@ -76,36 +84,42 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950515),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:47.905034-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950941),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:47.905034-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950479),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:52.813168-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950486),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:52.813168-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702951121),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:52.813168-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702951199),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:52.813168-05:00"),
@@ -117,24 +131,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950215),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:52.813168-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "Journal Square",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950558),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:52.813168-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950296),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:32.933609-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950761),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:32.933609-05:00"),
@@ -146,24 +164,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "Journal Square",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950318),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950701),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950131),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950761),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
@@ -175,24 +197,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950401),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:42.854056-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950486),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:42.854056-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950341),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:42.854056-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950476),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:42.854056-05:00"),
@@ -204,24 +230,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950119),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950539),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702951019),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "World Trade Center",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702951259),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
@@ -233,24 +263,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950179),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:12.868217-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950239),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:12.868217-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_NWK_WTC,
+					Headsign:         "Newark",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950839),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:12.868217-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_WTC,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950899),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:12.868217-05:00"),
@@ -262,24 +296,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950472),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:32.933609-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "Journal Square",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950557),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:32.933609-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950638),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:42.854056-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950723),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:42.854056-05:00"),
@@ -291,24 +329,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950391),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:32.933609-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "Journal Square",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950476),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:32.933609-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950761),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950846),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
@@ -324,24 +366,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950208),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "Journal Square",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950293),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:27.941258-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950187),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:47.905034-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "33rd Street",
 					Direction:        sourceapi.Direction_TO_NY,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950272),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:41:47.905034-05:00"),
@@ -353,24 +399,28 @@ func TestGetTrainsAtStation(t *testing.T) {
 			trains: []Train{
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950127),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "Journal Square",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950127),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_HOB_33,
+					Headsign:         "Hoboken",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950719),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
 				},
 				{
 					Route:            sourceapi.Route_JSQ_33,
+					Headsign:         "Journal Square",
 					Direction:        sourceapi.Direction_TO_NJ,
 					ProjectedArrival: mkTimestampFromUnixSeconds(1702950839),
 					LastUpdated:      mkTimestampFromIso8601("2023-12-18T20:42:07.827997-05:00"),
@@ -503,34 +553,56 @@ func TestGetRouteToRouteId(t *testing.T) {
 	}
 }
 
+func TestUserAgent(t *testing.T) {
+	var gotUserAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserAgent = r.UserAgent()
+		fmt.Fprint(w, `{"results": []}`)
+	}))
+	defer server.Close()
+
+	client := NewPaNyNjSourceClient(newRedirectingHttpClient(t, server.URL), clock.New(), WithUserAgent("test-agent/1.0"))
+	if _, err := client.GetTrainsAtStation(context.Background(), sourceapi.Station_HOBOKEN); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "test-agent/1.0"; gotUserAgent != want {
+		t.Errorf("User-Agent got=%q, want=%q", gotUserAgent, want)
+	}
+}
+
 func GetFourteenthStreetTrains(c clock.Clock, offset int64) []Train {
 	return []Train{
 		{
 			Route:            sourceapi.Route_HOB_33,
+			Headsign:         "Hoboken",
 			Direction:        sourceapi.Direction_TO_NJ,
 			ProjectedArrival: mkTimestampFromUnixSeconds(1702950297 + offset),
 			LastUpdated:      mkTimestampFromIso8601WithOffset("2023-12-18T20:41:57.869032-05:00", offset),
 		},
 		{
 			Route:            sourceapi.Route_JSQ_33,
+			Headsign:         "Journal Square",
 			Direction:        sourceapi.Direction_TO_NJ,
 			ProjectedArrival: mkTimestampFromUnixSeconds(1702950382 + offset),
 			LastUpdated:      mkTimestampFromIso8601WithOffset("2023-12-18T20:41:57.869032-05:00", offset),
 		},
 		{
 			Route:            sourceapi.Route_JSQ_33_HOB,
+			Headsign:         "Journal Square via Hoboken",
 			Direction:        sourceapi.Direction_TO_NJ,
 			ProjectedArrival: mkTimestampFromUnixSeconds(1702952629 + offset),
 			LastUpdated:      mkTimestampFromIso8601WithOffset("2023-12-18T20:41:57.869032-05:00", offset),
 		},
 		{
 			Route:            sourceapi.Route_HOB_33,
+			Headsign:         "33rd Street",
 			Direction:        sourceapi.Direction_TO_NY,
 			ProjectedArrival: mkTimestampFromUnixSeconds(1702950134 + offset),
 			LastUpdated:      mkTimestampFromIso8601WithOffset("2023-12-18T20:41:52.813168-05:00", offset),
 		},
 		{
 			Route:            sourceapi.Route_HOB_33,
+			Headsign:         "33rd Street",
 			Direction:        sourceapi.Direction_TO_NY,
 			ProjectedArrival: mkTimestampFromUnixSeconds(1702950821 + offset),
 			LastUpdated:      mkTimestampFromIso8601WithOffset("2023-12-18T20:41:52.813168-05:00", offset),
@@ -4,16 +4,23 @@ package pathgtfsrt
 import (
 	"context"
 	"crypto/md5"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
 	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -21,6 +28,12 @@ import (
 // Set via flags on Go build
 var BuildNumber string
 
+// DefaultMinUpdatePeriod is the default value of the smallest update period a feed accepts.
+const DefaultMinUpdatePeriod = time.Second
+
+// DefaultGtfsRealtimeVersion is the GTFS realtime version in the header of feeds by default.
+const DefaultGtfsRealtimeVersion = "2.0"
+
 // Train contains data about a PATH train at a specific station.
 type Train *sourceapi.GetUpcomingTrainsResponse_UpcomingTrain
 
@@ -40,91 +53,990 @@ type SourceClient interface {
 // Feed also satisfies the http.Handler interface, and simply responds to all requests with the most recent
 // GTFS realtime data.
 type Feed struct {
-	gtfs  []byte
-	mutex sync.RWMutex
+	clock           clock.Clock
+	updatePeriod    time.Duration
+	minUpdatePeriod time.Duration
+	ticker          *clock.Ticker
+	refreshes       chan *refresh
+	built           chan struct{}
+	paused          bool
+	progressed      time.Time
+	differential    bool
+	maxStaleness    time.Duration
+	staticData      staticData
+	staticDataDrift StaticDataDrift
+	snapshot        snapshot
+	history         []snapshot
+	historySize     int
+	logOutput       io.Writer
+	subscribers     map[chan snapshot]struct{}
+	callbacks       []subscribedCallback
+	nextCallbackId  int
+	// The functions that cancel the subscriptions of the channels returned by Updates.
+	updatesCancels map[int]func()
+	mutex          sync.RWMutex
+	// The platform-level stop IDs; see WithPlatformStopIds and SetPlatformStopIds.
+	platformToStopId map[Platform]string
+	// Cancels the context of the background goroutines, which are tracked by the wait group.
+	cancel     context.CancelFunc
+	done       <-chan struct{}
+	goroutines sync.WaitGroup
+}
+
+// ErrFeedClosed is returned by methods of a feed that has been closed; see Feed.Close.
+var ErrFeedClosed = errors.New("feed is closed")
+
+// An update callback added using Subscribe.
+type subscribedCallback struct {
+	id       int
+	callback UpdateCallback
+}
+
+// The result of a single update of the feed.
+type snapshot struct {
+	msg               *gtfs.FeedMessage
+	gtfs              []byte
+	differentialMsg   *gtfs.FeedMessage
+	differentialGtfs  []byte
+	sourceLastUpdated time.Time
+	// The upcoming trains at each station that the message was built from.
+	trains map[sourceapi.Station][]Train
+	// The message built by the previous update, or nil if this is the first update.
+	previousMsg *gtfs.FeedMessage
+	// When the update started.
+	updated time.Time
+	// The most recent errors from the source API, oldest first, across this and earlier updates.
+	recentErrors []recordedError
+	// The results of the requests to the source API in this and earlier updates.
+	health fetchHealth
+	// When the most recent fresh data from the source API in the message was fetched, or for a
+	// message loaded from disk, built.
+	fresh time.Time
+	// Whether the snapshot was loaded from disk rather than built by an update.
+	restored bool
 }
 
 // UpdateCallback is the type of callback that the feed runs after each update.
+type UpdateCallback func(result UpdateResult)
+
+// UpdateResult describes a feed update.
+type UpdateResult struct {
+	// Msg is the GTFS realtime message that was just built.
+	Msg *gtfs.FeedMessage
+	// Duration is the time taken by the update, from the first request to the source API until the
+	// message is serialized.
+	Duration time.Duration
+	// StationErrs contains, for each station whose realtime data could not be retrieved from the
+	// source API, the error that occured, which is a *StationFetchError. The previously retrieved
+	// data is used for these stations.
+	StationErrs map[sourceapi.Station]error
+	// EntitiesAdded, EntitiesRemoved and EntitiesChanged are the number of entities of the message
+	// that are not in the message of the previous update, of entities of the previous message that
+	// are not in the message, and of entities in both messages that differ. Entities are matched by
+	// ID.
+	EntitiesAdded   int
+	EntitiesRemoved int
+	EntitiesChanged int
+	// Bytes is the size of the serialized message.
+	Bytes int
+}
+
+// Platform identifies the platform at a station that trains on a given route and
+// direction arrive at.
+type Platform struct {
+	Station   sourceapi.Station
+	Route     sourceapi.Route
+	Direction sourceapi.Direction
+}
+
+// FeedOption configures optional behavior of the feed.
+type FeedOption func(*feedOptions)
+
+type feedOptions struct {
+	platformToStopId map[Platform]string
+	minUpdatePeriod  time.Duration
+	rawRouteCodes    bool
+	phaseCallback    func(UpdatePhaseDurations)
+	skippedCallback  func(SkippedTrains)
+	differential     bool
+	schedule         *StaticSchedule
+	routePatterns    map[routePatternKey][]PatternStop
+	tripStitching    bool
+	departures       bool
+	defaultDwell     time.Duration
+	stopIdToDwell    map[string]time.Duration
+	relationship     *gtfs.TripDescriptor_ScheduleRelationship
+	version          string
+	outputPath       string
+	publishers       []feedPublisher
+	historySize      int
+	persistPath      string
+	persistMaxAge    time.Duration
+	maxStaleness     time.Duration
+	staticDataWait   time.Duration
+	registerer       prometheus.Registerer
+	logOutput        io.Writer
+	// For feeds that are only updated when the feed they are derived from is updated, the feed
+	// they are derived from.
+	derivedFrom *Feed
+}
+
+// UpdatePhaseDurations contains how long each phase of a feed update took.
+type UpdatePhaseDurations struct {
+	// Fetch is the time taken to retrieve realtime data from the source API.
+	Fetch time.Duration
+	// Build is the time taken to build the GTFS realtime messages.
+	Build time.Duration
+	// Marshal is the time taken to serialize the GTFS realtime messages.
+	Marshal time.Duration
+}
+
+// WithUpdatePhaseDurationsCallback registers a callback that is invoked with the durations of the
+// phases of each update. It is invoked before the update callback.
+func WithUpdatePhaseDurationsCallback(callback func(UpdatePhaseDurations)) FeedOption {
+	return func(o *feedOptions) {
+		o.phaseCallback = callback
+	}
+}
+
+// WithLogOutput makes the feed write its log output to the provided writer rather than to stdout.
+func WithLogOutput(w io.Writer) FeedOption {
+	return func(o *feedOptions) {
+		o.logOutput = w
+	}
+}
+
+// WithDifferentialIncrementality makes Get and ServeHTTP return the feed in DIFFERENTIAL mode,
+// as returned by GetDifferential, rather than in FULL_DATASET mode. This reduces bandwidth for
+// consumers that poll at least once per update period.
+//
+// The update callback still receives the FULL_DATASET message.
+func WithDifferentialIncrementality() FeedOption {
+	return func(o *feedOptions) {
+		o.differential = true
+	}
+}
+
+// WithStaticSchedule matches each realtime arrival against the provided static schedule. If a
+// scheduled trip with the same route and direction arrives at the station within 10 minutes of the
+// projected arrival, the trip descriptor contains the ID and start date of the closest such trip
+// instead of a synthesized trip ID. The delay of the trip update and of the arrival is then the
+// difference between the projected and scheduled arrivals.
+//
+// Each scheduled trip appears in at most one trip update. Arrivals of the same scheduled trip at
+// different stations are merged into one trip update. If several trains at a station match the
+// same scheduled trip, it is assigned to the train with the smallest delay, and the other trains
+// keep synthesized trip IDs.
+//
+// The schedule's stop IDs and route IDs must match those in the feed.
+func WithStaticSchedule(schedule *StaticSchedule) FeedOption {
+	return func(o *feedOptions) {
+		o.schedule = schedule
+	}
+}
+
+// WithRoutePatterns extends each trip update with predicted stop time updates for the stations
+// after the reporting station, using the route pattern for the trip's route and direction. The
+// predicted arrivals are the projected arrival at the reporting station plus the travel time
+// between the stations in the pattern.
+//
+// Route patterns can be loaded from JSON using LoadRoutePatterns or derived from a static
+// schedule using StaticSchedule.RoutePatterns.
+func WithRoutePatterns(patterns []RoutePattern) FeedOption {
+	return func(o *feedOptions) {
+		o.routePatterns = map[routePatternKey][]PatternStop{}
+		for _, pattern := range patterns {
+			o.routePatterns[routePatternKey{routeId: pattern.RouteId, directionId: pattern.DirectionId}] = pattern.Stops
+		}
+	}
+}
+
+// WithTripStitching merges the trip updates for the same train at multiple stations into a single
+// trip update with a stop time update for each station, in the order of the route pattern.
+//
+// Arrivals are merged if they are on the same route and in the same direction, and the difference
+// between the arrivals at the two stations is within 2 minutes of the travel time between the
+// stations. Route patterns must be provided using WithRoutePatterns; arrivals on routes without a
+// route pattern are not merged.
+func WithTripStitching() FeedOption {
+	return func(o *feedOptions) {
+		o.tripStitching = true
+	}
+}
+
+// WithDepartures sets a departure time on each stop time update, in addition to the arrival time.
+// The departure time is the arrival time plus the dwell time for the stop ID in stopIdToDwell or,
+// if the stop ID is not in the map, the default dwell time. A dwell time of zero makes the departure
+// time the same as the arrival time.
+func WithDepartures(defaultDwell time.Duration, stopIdToDwell map[string]time.Duration) FeedOption {
+	return func(o *feedOptions) {
+		o.departures = true
+		o.defaultDwell = defaultDwell
+		o.stopIdToDwell = stopIdToDwell
+	}
+}
+
+// WithScheduleRelationship sets the schedule relationship of each trip descriptor. Trips that were
+// matched against the static schedule (see WithStaticSchedule) are SCHEDULED, and all other trips
+// have the provided relationship, which should be UNSCHEDULED or ADDED.
 //
-// The first argument is the GTFS realtime message that was just built.
-// The second argument is the list of all errors that occured when getting realtime data
-// from the source API.
-type UpdateCallback func(msg *gtfs.FeedMessage, requestErrs []error)
+// By default the schedule relationship is not set.
+func WithScheduleRelationship(unmatched gtfs.TripDescriptor_ScheduleRelationship) FeedOption {
+	return func(o *feedOptions) {
+		o.relationship = &unmatched
+	}
+}
+
+// WithGtfsRealtimeVersion sets the GTFS realtime version in the header of the feed. This is
+// intended for consumers pinned to version 0.2; the content of the feed is the same regardless
+// of the version.
+func WithGtfsRealtimeVersion(version string) FeedOption {
+	return func(o *feedOptions) {
+		o.version = version
+	}
+}
+
+// WithFileOutput writes the feed, as returned by Get, to the provided path after every update. The
+// file is replaced atomically by writing to a temporary file in the same directory and renaming it,
+// so the path can be served directly by a static file server. Errors writing the file are logged and
+// do not stop the update.
+func WithFileOutput(path string) FeedOption {
+	return func(o *feedOptions) {
+		o.outputPath = path
+	}
+}
+
+// WithRawRouteCodesInTripIds prefixes each synthesized trip ID with the source API route code
+// followed by a colon; e.g., "HOB_33:<hash>". This is useful when debugging route mapping issues.
+//
+// The route code can be recovered using RawRouteCodeFromTripId.
+func WithRawRouteCodesInTripIds() FeedOption {
+	return func(o *feedOptions) {
+		o.rawRouteCodes = true
+	}
+}
+
+// RawRouteCodeFromTripId returns the source API route code in a trip ID generated by a feed
+// constructed with the WithRawRouteCodesInTripIds option.
+func RawRouteCodeFromTripId(tripId string) (sourceapi.Route, bool) {
+	rawRouteCode, _, ok := strings.Cut(tripId, ":")
+	if !ok {
+		return sourceapi.Route_ROUTE_UNSPECIFIED, false
+	}
+	route, ok := sourceapi.Route_value[rawRouteCode]
+	if !ok {
+		return sourceapi.Route_ROUTE_UNSPECIFIED, false
+	}
+	return sourceapi.Route(route), true
+}
+
+// WithMinUpdatePeriod sets the smallest update period the feed accepts.
+//
+// If the feed is constructed with a shorter update period, the period is raised to this
+// value so that the source API is not overloaded. The default is DefaultMinUpdatePeriod.
+func WithMinUpdatePeriod(minUpdatePeriod time.Duration) FeedOption {
+	return func(o *feedOptions) {
+		o.minUpdatePeriod = minUpdatePeriod
+	}
+}
+
+// WithMaxStaleness makes the feed respond with 503 Service Unavailable, rather than with stale
+// predictions, once the most recent fresh data from the source API is older than the provided
+// duration. Updates in which every request to the source API fails do not provide fresh data. A
+// feed loaded using WithPersistence is fresh as of when it was built.
+func WithMaxStaleness(maxStaleness time.Duration) FeedOption {
+	return func(o *feedOptions) {
+		o.maxStaleness = maxStaleness
+	}
+}
+
+// WithStaticDataRetries makes the feed retry getting the static data from the source API when it
+// is constructed, for up to the provided duration, rather than failing immediately. This lets the
+// feed ride out short outages of the source API at start up. Retries back off exponentially from 1
+// second to 30 seconds.
+func WithStaticDataRetries(maxWait time.Duration) FeedOption {
+	return func(o *feedOptions) {
+		o.staticDataWait = maxWait
+	}
+}
+
+// WithPlatformStopIds makes the feed resolve stop IDs to platform-level GTFS static stop IDs
+// rather than to the parent station.
+//
+// Trains whose station, route and direction has no entry in the map fall back to the parent
+// station's stop ID.
+//
+// Only the stop ID of the stop time update for the station where the train was observed, and of
+// vehicle positions derived from it, is replaced. Everything else keys on the parent station's stop
+// ID: trip IDs, stitching observations into trips, matching to the static schedule, and the
+// predicted downstream stop times added using route patterns, which keep the stop IDs of the
+// patterns.
+func WithPlatformStopIds(platformToStopId map[Platform]string) FeedOption {
+	return func(o *feedOptions) {
+		o.platformToStopId = platformToStopId
+	}
+}
 
 // NewFeed creates a new feed.
 //
 // This function gets static and realtime data from the source API and creates the
-// first version of the GTFS realtime feed before returning.
+// first version of the GTFS realtime feed before returning, unless a persisted feed is loaded; see
+// WithPersistence.
 // It then, in the background, periodically updates the realtime data following the provided
-// update period.
+// update period. Update periods shorter than the minimum (see WithMinUpdatePeriod) are raised
+// to the minimum.
+//
+// After each update, including the first synchronous update, the provided callback is invoked,
+// unless it is nil. More callbacks can be added using Subscribe.
+func NewFeed(ctx context.Context, clock clock.Clock, updatePeriod time.Duration, sourceClient SourceClient, callback UpdateCallback, opts ...FeedOption) (*Feed, error) {
+	return newFeed(ctx, clock, updatePeriod, sourceClient, callback, buildGtfsRealtimeFeedMessage, opts)
+}
+
+// NewVehiclePositionFeed creates a new feed of approximate vehicle positions, derived from a trip
+// updates feed returned by NewFeed.
+//
+// The source APIs only report upcoming trains at each station, so positions are approximated:
+// each trip is reported as incoming at (or, once its projected arrival has passed, stopped at) the
+// stop with its earliest projected arrival. A train is only identified across stations if route
+// patterns are configured (see WithRoutePatterns); otherwise, for each station, route and
+// direction, only the train with the earliest projected arrival is reported. Vehicle positions do
+// not contain coordinates. The trip descriptors match those in the trip updates feed, so the two
+// feeds can be joined.
 //
-// After each update, including the first synchronous update, the provided callback is invoked.
-func NewFeed(ctx context.Context, clock clock.Clock, updatePeriod time.Duration, sourceClient SourceClient, callback UpdateCallback) (*Feed, error) {
-	f := Feed{}
-	fmt.Println("Starting up")
-	staticData, err := getStaticData(ctx, sourceClient)
+// The feed does not request the source API. It is updated after each update of the trip updates
+// feed, from the same realtime data, unless it is paused, and otherwise behaves like the feed
+// returned by NewFeed. The requests of the trip updates feed to the source API count as its own:
+// a station whose request failed is reported as failed, and the feed has fresh data when the trip
+// updates feed does. Until the trip updates feed has been built from the source API, e.g. while it
+// serves a persisted feed, the feed is not built.
+func NewVehiclePositionFeed(ctx context.Context, clock clock.Clock, tripUpdatesFeed *Feed, callback UpdateCallback, opts ...FeedOption) (*Feed, error) {
+	opts = append(opts[:len(opts):len(opts)], func(o *feedOptions) {
+		o.derivedFrom = tripUpdatesFeed
+	})
+	client := &derivedSourceClient{feed: tripUpdatesFeed}
+	f, err := newFeed(ctx, clock, tripUpdatesFeed.getUpdatePeriod(), client, callback, buildVehiclePositionFeedMessage, opts)
+	if err != nil {
+		return nil, err
+	}
+	unsubscribe := tripUpdatesFeed.Subscribe(func(result UpdateResult) {
+		client.record(result)
+		if f.Paused() {
+			return
+		}
+		if err := f.Refresh(ctx); err != nil && err != ErrFeedClosed {
+			fmt.Fprintf(f.logOutput, "Warning: failed to update vehicle positions: %s\n", err)
+		}
+	})
+	go func() {
+		<-f.done
+		unsubscribe()
+	}()
+	return f, nil
+}
+
+// A function that builds a GTFS Realtime message from a snapshot of the current data.
+type feedBuilder func(clock clock.Clock, staticData staticData, realtimeData map[sourceapi.Station][]Train, options feedOptions) *gtfs.FeedMessage
+
+func newFeed(ctx context.Context, clock clock.Clock, updatePeriod time.Duration, sourceClient SourceClient, callback UpdateCallback, build feedBuilder, opts []FeedOption) (*Feed, error) {
+	options := feedOptions{minUpdatePeriod: DefaultMinUpdatePeriod, version: DefaultGtfsRealtimeVersion, logOutput: os.Stdout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if updatePeriod < options.minUpdatePeriod {
+		fmt.Fprintf(options.logOutput, "Warning: update period %s is below the minimum of %s; using the minimum\n", updatePeriod, options.minUpdatePeriod)
+		updatePeriod = options.minUpdatePeriod
+	}
+	f := Feed{
+		clock:           clock,
+		updatePeriod:    updatePeriod,
+		minUpdatePeriod: options.minUpdatePeriod,
+		refreshes:       make(chan *refresh),
+		built:           make(chan struct{}),
+		differential:    options.differential,
+		maxStaleness:    options.maxStaleness,
+		historySize:     options.historySize,
+		logOutput:       options.logOutput,
+		cancel:          cancel,
+		done:            ctx.Done(),
+	}
+	f.platformToStopId = options.platformToStopId
+	var metrics *feedMetrics
+	if options.registerer != nil {
+		var err error
+		// The only derived feeds are vehicle positions feeds.
+		metrics, err = newFeedMetrics(options.registerer, options.derivedFrom != nil)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+	fmt.Fprintln(options.logOutput, "Starting up")
+	staticData, err := getStaticDataWithRetries(ctx, clock, sourceClient, options.staticDataWait, options.logOutput)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
+	f.staticData = staticData
+	f.staticDataDrift = computeStaticDataDrift(staticData.stationToStopId, staticData.routeToRouteId)
+	if !f.staticDataDrift.Empty() {
+		fmt.Fprintf(options.logOutput, "Warning: static data from the source API differs from the built-in snapshot: %+v\n", f.staticDataDrift)
+	}
+	if metrics != nil {
+		metrics.recordStaticDataDrift(f.staticDataDrift)
+	}
 	realtimeData := map[sourceapi.Station][]Train{}
+	var previousFeedMessage *gtfs.FeedMessage
+	var recentErrors []recordedError
+	var health fetchHealth
+	var builtOnce sync.Once
+	restored := false
+	if options.persistPath != "" {
+		var s snapshot
+		s, restored, err = loadPersistedSnapshot(clock, options.persistPath, options.persistMaxAge, options.logOutput)
+		if err != nil {
+			fmt.Fprintf(options.logOutput, "Warning: failed to load persisted feed: %s\n", err)
+		}
+		if restored {
+			fmt.Fprintln(options.logOutput, "Loaded persisted feed from", options.persistPath)
+			f.set(s)
+			previousFeedMessage = s.msg
+		}
+	}
 
-	updateFunc := func() []error {
-		fmt.Println("Updating GTFS Realtime feed.")
-		requestErrs := updateRealtimeData(ctx, realtimeData, sourceClient, staticData)
-		feedMessage := buildGtfsRealtimeFeedMessage(clock, staticData, realtimeData)
+	// Each update has a request ID, which is sent to the source API and included in the logs.
+	updateFunc := func(requestId string) (UpdateResult, []error) {
+		fmt.Fprintf(options.logOutput, "Updating GTFS Realtime feed (request ID %s).\n", requestId)
+		start := clock.Now()
+		requestErrs, failedStations := updateRealtimeData(ContextWithRequestId(ctx, requestId), realtimeData, sourceClient, staticData, options.logOutput)
+		fetched := clock.Now()
+		buildOptions := options
+		buildOptions.platformToStopId = f.getPlatformStopIds()
+		feedMessage := build(clock, staticData, realtimeData, buildOptions)
+		differentialFeedMessage := buildDifferentialFeedMessage(previousFeedMessage, feedMessage)
+		built := clock.Now()
 		out, err := proto.Marshal(feedMessage)
 		if err != nil {
 			panic(fmt.Sprintf("failed go generate realtime protobuf file: %s", err))
 		}
-		f.set(out)
-		callback(feedMessage, requestErrs)
-		fmt.Println("Finished updating")
-		return requestErrs
+		differentialOut, err := proto.Marshal(differentialFeedMessage)
+		if err != nil {
+			panic(fmt.Sprintf("failed go generate differential realtime protobuf file: %s", err))
+		}
+		durations := UpdatePhaseDurations{
+			Fetch:   fetched.Sub(start),
+			Build:   built.Sub(fetched),
+			Marshal: clock.Since(built),
+		}
+		skipped := countSkippedTrains(staticData, realtimeData)
+		result := UpdateResult{
+			Msg:         feedMessage,
+			Duration:    durations.Fetch + durations.Build + durations.Marshal,
+			StationErrs: failedStations,
+			Bytes:       len(out),
+		}
+		result.EntitiesAdded, result.EntitiesRemoved, result.EntitiesChanged = countEntityChanges(previousFeedMessage, feedMessage)
+		if options.phaseCallback != nil {
+			options.phaseCallback(durations)
+		}
+		if options.skippedCallback != nil {
+			options.skippedCallback(skipped)
+		}
+		if metrics != nil {
+			metrics.recordUpdate(result, durations, skipped)
+		}
+		recentErrors = appendRecentErrors(recentErrors, start, requestErrs)
+		health = health.record(start, staticData.stations, failedStations)
+		if options.derivedFrom != nil {
+			// The data is as fresh as the data of the feed it is derived from.
+			from := options.derivedFrom.get().health
+			health.lastDataUpdate = from.lastDataUpdate
+			health.lastSuccessfulUpdate = from.lastSuccessfulUpdate
+		}
+		// Until an update gets data from the source API, the feed would be empty. Consumers must not
+		// cache an empty feed, so the feed is not served or published; a persisted feed that was
+		// loaded keeps being served.
+		if health.lastDataUpdate.IsZero() {
+			fmt.Fprintln(options.logOutput, "Warning: no data from the source API yet; not serving the feed")
+			f.notify(callback, result)
+			return result, requestErrs
+		}
+		previousMsg := previousFeedMessage
+		previousFeedMessage = feedMessage
+		trains := make(map[sourceapi.Station][]Train, len(realtimeData))
+		for station, stationTrains := range realtimeData {
+			trains[station] = stationTrains
+		}
+		f.set(snapshot{
+			msg:               feedMessage,
+			gtfs:              out,
+			differentialMsg:   differentialFeedMessage,
+			differentialGtfs:  differentialOut,
+			sourceLastUpdated: latestLastUpdated(realtimeData),
+			trains:            trains,
+			previousMsg:       previousMsg,
+			updated:           start,
+			recentErrors:      recentErrors,
+			health:            health,
+			fresh:             health.lastDataUpdate,
+		})
+		builtOnce.Do(func() { close(f.built) })
+		if options.outputPath != "" {
+			if err := writeFileAtomically(options.outputPath, f.Get()); err != nil {
+				fmt.Fprintf(options.logOutput, "Warning: failed to write feed to %s: %s\n", options.outputPath, err)
+			}
+		}
+		if options.persistPath != "" {
+			if err := writeFileAtomically(options.persistPath, out); err != nil {
+				fmt.Fprintf(options.logOutput, "Warning: failed to persist feed to %s: %s\n", options.persistPath, err)
+			}
+		}
+		f.notify(callback, result)
+		fmt.Fprintf(options.logOutput, "Finished updating (request ID %s)\n", requestId)
+		return result, requestErrs
 	}
 
-	errs := updateFunc()
-	if len(errs) > 0 {
-		return nil, fmt.Errorf("failed to initialize realtime data: %v", errs)
+	// If a persisted feed was loaded, it is served while the first update runs in the background.
+	// A derived feed is not built until the feed it is derived from is, which may be later.
+	if !restored {
+		_, errs := updateFunc(NewRequestId())
+		if len(errs) > 0 && options.derivedFrom == nil {
+			cancel()
+			return nil, fmt.Errorf("failed to initialize realtime data: %v", errs)
+		}
+	}
+	for _, publisher := range options.publishers {
+		snapshots, unsubscribe := f.subscribe()
+		f.goroutines.Add(1)
+		go func(publisher feedPublisher) {
+			defer f.goroutines.Done()
+			f.runPublisher(ctx, publisher, snapshots, unsubscribe)
+		}(publisher)
 	}
+	f.goroutines.Add(1)
+	go func() {
+		defer f.goroutines.Done()
+		<-ctx.Done()
+		f.cancelUpdates()
+	}()
 	// We ensure the ticker is constructed before the function is returned; otherwise,
 	// there is a race condition between initializing the ticker and incrementing the
 	// time in the unit testing which results in a deadlock.
 	ticker := clock.Ticker(updatePeriod)
+	f.ticker = ticker
+	f.markProgress()
+	f.goroutines.Add(1)
 	go func() {
+		defer f.goroutines.Done()
 		defer ticker.Stop()
+		if restored {
+			updateFunc(NewRequestId())
+			f.markProgress()
+		}
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				updateFunc()
+				if !f.Paused() && options.derivedFrom == nil {
+					updateFunc(NewRequestId())
+				}
+			case r := <-f.refreshes:
+				r.result, _ = updateFunc(r.requestId)
+				close(r.done)
 			}
+			f.markProgress()
 		}
 	}()
 	return &f, nil
 }
 
+// A request to update the feed outside of the regular schedule.
+type refresh struct {
+	requestId string
+	// Set by the update before done is closed.
+	result UpdateResult
+	done   chan struct{}
+}
+
+// Refresh updates the feed immediately, outside of the regular schedule; e.g., right after a known
+// incident or when debugging stale data. It returns once the update has completed, or with the
+// context's error if the context is cancelled first. The regular schedule is not changed. The
+// update uses the request ID of the context, if there is one; see ContextWithRequestId.
+func (f *Feed) Refresh(ctx context.Context) error {
+	_, err := f.ForceUpdate(ctx)
+	return err
+}
+
+// ForceUpdate updates the feed like Refresh, and returns the result of the update, which contains
+// the errors that occurred when getting realtime data from the source API; e.g., so that an
+// embedder can check that the source API is reachable again right after reconnecting to it.
+func (f *Feed) ForceUpdate(ctx context.Context) (UpdateResult, error) {
+	r := &refresh{requestId: RequestIdFromContext(ctx), done: make(chan struct{})}
+	if r.requestId == "" {
+		r.requestId = NewRequestId()
+	}
+	select {
+	case f.refreshes <- r:
+	case <-ctx.Done():
+		return UpdateResult{}, ctx.Err()
+	case <-f.done:
+		return UpdateResult{}, ErrFeedClosed
+	}
+	select {
+	case <-r.done:
+		return r.result, nil
+	case <-ctx.Done():
+		return UpdateResult{}, ctx.Err()
+	}
+}
+
+// Close stops the regular updates of the feed and its publishers, and waits for them to finish.
+//
+// The subscriptions of the channels returned by Updates are cancelled and the channels are closed
+// before waiting, so a subscriber that stops reading does not block Close. An update in progress
+// completes first, including its callbacks: Close does not return while a callback passed to the
+// constructor or to Subscribe is blocked. The most recent feed continues to be served, and Refresh
+// returns ErrFeedClosed. Cancelling the context passed to the constructor has the same effect,
+// including closing the channels, except that it does not wait.
+func (f *Feed) Close() error {
+	f.cancel()
+	f.cancelUpdates()
+	f.goroutines.Wait()
+	return nil
+}
+
+// Pause stops the regular updates of the feed, so that the source API is not requested; e.g.,
+// during upstream maintenance. The most recent feed continues to be served while paused. Refresh
+// still updates the feed.
+func (f *Feed) Pause() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.paused = true
+}
+
+// Resume restarts the regular updates of the feed after Pause. The next update happens at the
+// next scheduled time.
+func (f *Feed) Resume() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.paused = false
+}
+
+// Paused returns whether the regular updates of the feed are paused.
+func (f *Feed) Paused() bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.paused
+}
+
+// SetUpdatePeriod changes how often the feed is updated without interrupting the feed being
+// served. The next update happens one new update period after the call. As in NewFeed, a period
+// below the minimum update period is replaced by the minimum.
+func (f *Feed) SetUpdatePeriod(updatePeriod time.Duration) {
+	if updatePeriod < f.minUpdatePeriod {
+		fmt.Fprintf(f.logOutput, "Warning: update period %s is below the minimum of %s; using the minimum\n", updatePeriod, f.minUpdatePeriod)
+		updatePeriod = f.minUpdatePeriod
+	}
+	f.mutex.Lock()
+	f.updatePeriod = updatePeriod
+	f.mutex.Unlock()
+	f.ticker.Reset(updatePeriod)
+}
+
+func (f *Feed) getUpdatePeriod() time.Duration {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.updatePeriod
+}
+
+// SetPlatformStopIds replaces the platform-level stop IDs set using WithPlatformStopIds without
+// interrupting the feed being served. The new stop IDs are used from the next update.
+func (f *Feed) SetPlatformStopIds(platformToStopId map[Platform]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.platformToStopId = platformToStopId
+}
+
+func (f *Feed) getPlatformStopIds() map[Platform]string {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.platformToStopId
+}
+
 // Get returns the most recent GTFS realtime data.
 func (f *Feed) Get() []byte {
+	return f.feedBytes(f.get())
+}
+
+// Returns the feed in the snapshot that Get returns.
+func (f *Feed) feedBytes(s snapshot) []byte {
+	if f.differential {
+		return s.differentialGtfs
+	}
+	return s.gtfs
+}
+
+// GetDifferential returns the most recent GTFS realtime data in DIFFERENTIAL mode; i.e., only the
+// entities that were added or changed in the most recent update, along with deletions for
+// entities that were removed.
+func (f *Feed) GetDifferential() []byte {
+	return f.get().differentialGtfs
+}
+
+// GetMessage returns the message that Get returns serialized, or nil if the feed has not been
+// built yet. The message is a copy that the caller may modify.
+func (f *Feed) GetMessage() *gtfs.FeedMessage {
+	s := f.get()
+	msg := s.msg
+	if f.differential {
+		msg = s.differentialMsg
+	}
+	if msg == nil {
+		return nil
+	}
+	return proto.Clone(msg).(*gtfs.FeedMessage)
+}
+
+// GetTimestamp returns the timestamp in the header of the most recent message, or the zero time if
+// the feed has not been built yet.
+func (f *Feed) GetTimestamp() time.Time {
+	msg := f.get().msg
+	if msg.GetHeader().GetTimestamp() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(msg.GetHeader().GetTimestamp()), 0)
+}
+
+func (f *Feed) get() snapshot {
 	f.mutex.RLock()
 	defer f.mutex.RUnlock()
-	return f.gtfs
+	return f.snapshot
+}
+
+func (f *Feed) set(s snapshot) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.snapshot = s
+	if f.historySize > 0 {
+		f.history = append(f.history, s)
+		if len(f.history) > f.historySize {
+			f.history = f.history[len(f.history)-f.historySize:]
+		}
+	}
+	for ch := range f.subscribers {
+		// Subscribers that have not yet received the previous snapshot only get the latest one.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s
+	}
+}
+
+// Subscribe to the snapshots produced by subsequent updates of the feed. The returned function
+// cancels the subscription and must be called once the subscriber is done.
+func (f *Feed) subscribe() (<-chan snapshot, func()) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.subscribers == nil {
+		f.subscribers = map[chan snapshot]struct{}{}
+	}
+	ch := make(chan snapshot, 1)
+	f.subscribers[ch] = struct{}{}
+	return ch, func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		delete(f.subscribers, ch)
+	}
 }
 
-func (f *Feed) set(b []byte) {
+// Subscribe adds a callback that the feed runs after each subsequent update, after the callback
+// passed to the constructor and the callbacks added before it. The returned function removes the
+// callback.
+//
+// This allows independent consumers, such as metrics recorders, archivers and webhooks, to be
+// notified of updates.
+func (f *Feed) Subscribe(callback UpdateCallback) (unsubscribe func()) {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
-	f.gtfs = b
+	id := f.nextCallbackId
+	f.nextCallbackId++
+	f.callbacks = append(f.callbacks, subscribedCallback{id: id, callback: callback})
+	return func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		for i, c := range f.callbacks {
+			if c.id == id {
+				f.callbacks = append(f.callbacks[:i:i], f.callbacks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Runs the callback passed to the constructor, if any, and the callbacks added using Subscribe.
+func (f *Feed) notify(callback UpdateCallback, result UpdateResult) {
+	if callback != nil {
+		callback(result)
+	}
+	f.mutex.RLock()
+	callbacks := f.callbacks
+	f.mutex.RUnlock()
+	// Callbacks run without the lock held, so they may use the feed, including Subscribe.
+	for _, c := range callbacks {
+		c.callback(result)
+	}
+}
+
+// Built returns a channel that is closed once the feed has been built from data from the source
+// API. Until then the feed is not served, unless a persisted feed was loaded; see WithPersistence.
+// HTTP servers can wait on it before routing traffic to the feed.
+func (f *Feed) Built() <-chan struct{} {
+	return f.built
+}
+
+// SourceLastUpdated returns the most recent last updated time reported by the source API
+// across all trains in the most recent update.
+func (f *Feed) SourceLastUpdated() time.Time {
+	return f.get().sourceLastUpdated
 }
 
 // ServeHTTP responds to all requests with the most recent GTFS realtime data.
+//
+// If the request has an Accept header of application/json, or a format=json query parameter,
+// the data is rendered as JSON rather than as a binary protobuf.
+//
+// The X-Source-Last-Updated response header contains the most recent last updated time
+// reported by the source API, which helps distinguish a stale source from a stale feed.
+//
+// Until the first version of the feed has been built, it responds with 503 Service Unavailable
+// and a Retry-After header set to the update period. It responds in the same way when the feed is
+// stale; see WithMaxStaleness.
+//
+// If the feed was constructed with WithDifferentialIncrementality, it responds in the same way as
+// the DifferentialHandler.
 func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	_, err := w.Write(f.Get())
+	s := f.get()
+	if f.differential {
+		f.serve(w, r, s, s.differentialMsg, s.differentialGtfs)
+		return
+	}
+	f.serve(w, r, s, s.msg, s.gtfs)
+}
+
+// DifferentialHandler returns a handler that responds to all requests with the most recent
+// GTFS realtime data in DIFFERENTIAL mode, as returned by GetDifferential.
+//
+// Consumers of this handler need to request the feed at least once per update period, as any
+// changes in a missed update are not repeated.
+func (f *Feed) DifferentialHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := f.get()
+		f.serve(w, r, s, s.differentialMsg, s.differentialGtfs)
+	})
+}
+
+func (f *Feed) serve(w http.ResponseWriter, r *http.Request, s snapshot, msg *gtfs.FeedMessage, b []byte) {
+	if b == nil {
+		setRetryAfter(w, f.getUpdatePeriod())
+		http.Error(w, "feed is warming up", http.StatusServiceUnavailable)
+		return
+	}
+	if f.maxStaleness > 0 {
+		if age := f.clock.Since(s.fresh); age > f.maxStaleness {
+			setRetryAfter(w, f.getUpdatePeriod())
+			http.Error(w, fmt.Sprintf("feed is stale: no fresh data from the source API for %s", age.Truncate(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if !s.sourceLastUpdated.IsZero() {
+		w.Header().Set("X-Source-Last-Updated", s.sourceLastUpdated.UTC().Format(http.TimeFormat))
+	}
+	if wantsJson(r) {
+		var err error
+		b, err = protojson.Marshal(msg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	}
+	_, err := w.Write(b)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// Serves a serialized feed that was not built by this process, such as one read from an archive or
+// a shared store, in the same way as Feed.ServeHTTP. A nil feed is reported as warming up.
+func serveFeedBytes(w http.ResponseWriter, r *http.Request, b []byte, retryAfter time.Duration) {
+	if b == nil {
+		setRetryAfter(w, retryAfter)
+		http.Error(w, "feed is warming up", http.StatusServiceUnavailable)
+		return
+	}
+	if wantsJson(r) {
+		var msg gtfs.FeedMessage
+		if err := proto.Unmarshal(b, &msg); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var err error
+		b, err = protojson.Marshal(&msg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(b)
+}
+
+// Sets the Retry-After header to the provided duration, rounded up to a whole number of seconds.
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// Returns true if the request asks for the feed in JSON format, either using the Accept header
+// or the format=json query parameter.
+func wantsJson(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// StaticDataDrift returns how the static data retrieved from the source API at start up differs
+// from the snapshot built into this package.
+func (f *Feed) StaticDataDrift() StaticDataDrift {
+	return f.staticDataDrift
+}
+
+// StatusTextHandler returns a handler that responds with a plain text summary of the most recent
+// GTFS realtime data, suitable for simple uptime checks:
+//
+//	entities: 42
+//	age_seconds: 3
+//
+// The age is the time since the feed was built.
+func (f *Feed) StatusTextHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := f.get().msg
+		if msg == nil {
+			http.Error(w, "feed is warming up", http.StatusServiceUnavailable)
+			return
+		}
+		age := f.clock.Now().Unix() - int64(msg.GetHeader().GetTimestamp())
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "entities: %d\nage_seconds: %d\n", len(msg.GetEntity()), age)
+	})
+}
+
 // A container for the static data retrieved at the start.
 type staticData struct {
 	stations        []sourceapi.Station
@@ -153,11 +1065,47 @@ func getStaticData(ctx context.Context, sourceClient SourceClient) (staticData,
 	return s, nil
 }
 
+// The backoff between attempts to get the static data; see WithStaticDataRetries.
+const (
+	initialStaticDataBackoff = time.Second
+	maxStaticDataBackoff     = 30 * time.Second
+)
+
+// Gets the static data, retrying with exponential backoff until the provided duration has passed.
+func getStaticDataWithRetries(ctx context.Context, clock clock.Clock, sourceClient SourceClient, maxWait time.Duration, log io.Writer) (staticData, error) {
+	deadline := clock.Now().Add(maxWait)
+	backoff := initialStaticDataBackoff
+	for {
+		s, err := getStaticData(ctx, sourceClient)
+		if err == nil {
+			return s, nil
+		}
+		remaining := deadline.Sub(clock.Now())
+		if remaining <= 0 {
+			return staticData{}, err
+		}
+		wait := backoff
+		if wait > remaining {
+			wait = remaining
+		}
+		fmt.Fprintf(log, "Warning: failed to get static data from the source API, retrying in %s: %s\n", wait, err)
+		select {
+		case <-ctx.Done():
+			return staticData{}, ctx.Err()
+		case <-clock.After(wait):
+		}
+		backoff *= 2
+		if backoff > maxStaticDataBackoff {
+			backoff = maxStaticDataBackoff
+		}
+	}
+}
+
 // Updates the realtime data using the source API.
 //
 // If data for one or more stations cannot be retrieved, the pre-existing realtime data is conservered
-// and corresponding number of errors are returned.
-func updateRealtimeData(ctx context.Context, data map[sourceapi.Station][]Train, sourceClient SourceClient, staticData staticData) []error {
+// and corresponding number of errors are returned, along with the error for each station.
+func updateRealtimeData(ctx context.Context, data map[sourceapi.Station][]Train, sourceClient SourceClient, staticData staticData, log io.Writer) ([]error, map[sourceapi.Station]error) {
 	type trainsAtStation struct {
 		Station sourceapi.Station
 		Trains  []Train
@@ -173,88 +1121,158 @@ func updateRealtimeData(ctx context.Context, data map[sourceapi.Station][]Train,
 		}()
 	}
 	var errs []error
+	failed := map[sourceapi.Station]error{}
 	for range staticData.stationToStopId {
 		trainsAtStation := <-allTrainsAtStations
 		if trainsAtStation.Err != nil {
-			errs = append(errs, trainsAtStation.Err)
-			fmt.Println("There was an error when retrieving data for station",
-				staticData.stationToStopId[trainsAtStation.Station])
+			err := newStationFetchError(trainsAtStation.Station, "", trainsAtStation.Err)
+			errs = append(errs, err)
+			failed[trainsAtStation.Station] = err
+			fmt.Fprintf(log, "There was an error when retrieving data for station %s (request ID %s): %s\n",
+				staticData.stationToStopId[trainsAtStation.Station], RequestIdFromContext(ctx), err)
 			continue
 		}
 		data[trainsAtStation.Station] = trainsAtStation.Trains
 	}
-	return errs
+	return errs, failed
 }
 
-// Build a GTFS Realtime message from a snapshot of the current data.
-func buildGtfsRealtimeFeedMessage(clock clock.Clock, staticData staticData, realtimeData map[sourceapi.Station][]Train) *gtfs.FeedMessage {
-	directionToBoolean := func(direction sourceapi.Direction) *uint32 {
-		var result uint32
-		if direction == sourceapi.Direction_TO_NY {
-			result = 1
-		} else if direction == sourceapi.Direction_TO_NJ {
-			result = 0
+// Returns the most recent last updated time across all trains in the realtime data.
+func latestLastUpdated(realtimeData map[sourceapi.Station][]Train) time.Time {
+	var latest time.Time
+	for _, trains := range realtimeData {
+		for _, train := range trains {
+			if train.LastUpdated == nil {
+				continue
+			}
+			if lastUpdated := train.LastUpdated.AsTime(); lastUpdated.After(latest) {
+				latest = lastUpdated
+			}
 		}
-		return &result
 	}
-	timestamppbToInt64 := func(t *timestamppb.Timestamp) *int64 {
-		if t != nil {
-			return ptr(t.Seconds)
-		}
-		return nil
+	return latest
+}
+
+// Build a GTFS Realtime message from a snapshot of the current data.
+func buildGtfsRealtimeFeedMessage(clock clock.Clock, staticData staticData, realtimeData map[sourceapi.Station][]Train, options feedOptions) *gtfs.FeedMessage {
+	observations := buildTripObservations(staticData, realtimeData, options)
+	if options.tripStitching {
+		observations = stitchTripObservations(options.routePatterns, observations)
 	}
-	timestamppbToUint64 := func(t *timestamppb.Timestamp) *uint64 {
-		if t != nil {
-			return ptr(uint64(t.Seconds))
+	var entities []*gtfs.FeedEntity
+	for i := range observations {
+		o := &observations[i]
+		lastArrival := o.update.StopTimeUpdate[len(o.update.StopTimeUpdate)-1].GetArrival().GetTime()
+		o.update.StopTimeUpdate = append(o.update.StopTimeUpdate, buildDownstreamStopTimeUpdates(options.routePatterns,
+			o.update.Trip.GetRouteId(), o.update.Trip.GetDirectionId(), o.stationStopId, lastArrival)...)
+		if options.departures {
+			setDepartures(o.update, options)
 		}
-		return nil
+		entities = append(entities, &gtfs.FeedEntity{
+			Id:         &o.entityId,
+			TripUpdate: o.update,
+		})
 	}
-	var entities []*gtfs.FeedEntity
+	return buildFeedMessage(clock, entities, options)
+}
+
+// Build a trip observation for each train at each station, in the order of the stations.
+func buildTripObservations(staticData staticData, realtimeData map[sourceapi.Station][]Train, options feedOptions) []tripObservation {
+	var observations []tripObservation
 	for _, apiStationId := range staticData.stations {
 		trains := realtimeData[apiStationId]
 		for _, train := range trains {
-			routeID, ok := staticData.routeToRouteId[train.Route]
+			update, entityId, ok := buildTripUpdate(staticData, apiStationId, train, options)
 			if !ok {
 				continue
 			}
-			if train.Direction != sourceapi.Direction_TO_NJ && train.Direction != sourceapi.Direction_TO_NY {
-				continue
-			}
-			if train.ProjectedArrival == nil {
-				continue
-			}
-			if train.LastUpdated == nil {
-				continue
-			}
-			update := &gtfs.TripUpdate{
-				Trip: &gtfs.TripDescriptor{
-					RouteId:     &routeID,
-					DirectionId: directionToBoolean(train.Direction),
-				},
-				StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{
-					{
-						StopId: ptr(staticData.stationToStopId[apiStationId]),
-						Arrival: &gtfs.TripUpdate_StopTimeEvent{
-							Time: timestamppbToInt64(train.ProjectedArrival),
-						},
-					},
+			observations = append(observations, tripObservation{
+				update:        update,
+				entityId:      entityId,
+				stationStopId: staticData.stationToStopId[apiStationId],
+			})
+		}
+	}
+	if options.schedule != nil {
+		observations = assignScheduledTrips(observations, options)
+	}
+	deduplicateEntityIds(observations)
+	return observations
+}
+
+// Build a GTFS Realtime trip update for a train arriving at a station, along with an ID for the
+// entity containing it. The entity ID is the synthesized trip ID, even if the trip was matched
+// against the static schedule.
+//
+// Returns false if the train is missing data needed to build the trip update.
+func buildTripUpdate(staticData staticData, apiStationId sourceapi.Station, train Train, options feedOptions) (*gtfs.TripUpdate, string, bool) {
+	if checkTrainData(staticData, train) != noMissingData {
+		return nil, "", false
+	}
+	routeID := staticData.routeToRouteId[train.Route]
+	update := &gtfs.TripUpdate{
+		Trip: &gtfs.TripDescriptor{
+			RouteId:     &routeID,
+			DirectionId: directionToBoolean(train.Direction),
+		},
+		StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{
+			{
+				StopId: ptr(stopId(staticData, apiStationId, train, options)),
+				Arrival: &gtfs.TripUpdate_StopTimeEvent{
+					Time: timestamppbToInt64(train.ProjectedArrival),
 				},
-				Timestamp: timestamppbToUint64(train.LastUpdated),
-			}
-			b, err := json.Marshal(update)
-			if err != nil {
-				panic(err)
+			},
+		},
+		Timestamp: timestamppbToUint64(train.LastUpdated),
+	}
+	tripId := synthesizeTripId(routeID, *update.Trip.DirectionId, staticData.stationToStopId[apiStationId], train.ProjectedArrival.Seconds)
+	if options.rawRouteCodes {
+		tripId = train.Route.String() + ":" + tripId
+	}
+	update.Trip.TripId = &tripId
+	if label := trainLabel(train); label != "" {
+		update.Vehicle = &gtfs.VehicleDescriptor{Label: &label}
+	}
+	if options.relationship != nil {
+		update.Trip.ScheduleRelationship = options.relationship.Enum()
+	}
+	if options.schedule != nil {
+		match, ok := options.schedule.match(staticData.stationToStopId[apiStationId], routeID, *update.Trip.DirectionId, train.ProjectedArrival.AsTime())
+		if ok {
+			update.Trip.TripId = &match.tripId
+			update.Trip.StartDate = &match.startDate
+			delay := int32(train.ProjectedArrival.AsTime().Sub(match.arrival).Seconds())
+			update.Delay = &delay
+			update.StopTimeUpdate[0].Arrival.Delay = &delay
+			if options.relationship != nil {
+				update.Trip.ScheduleRelationship = gtfs.TripDescriptor_SCHEDULED.Enum()
 			}
-			update.Trip.TripId = ptr(fmt.Sprintf("%x", md5.Sum(b)))
-			entities = append(entities, &gtfs.FeedEntity{
-				Id:         update.Trip.TripId,
-				TripUpdate: update,
-			})
 		}
 	}
+	return update, tripId, true
+}
+
+// Set the departure time of each stop time update using the dwell times in the options.
+func setDepartures(update *gtfs.TripUpdate, options feedOptions) {
+	for _, stopTimeUpdate := range update.StopTimeUpdate {
+		if stopTimeUpdate.Arrival == nil {
+			continue
+		}
+		dwell, ok := options.stopIdToDwell[stopTimeUpdate.GetStopId()]
+		if !ok {
+			dwell = options.defaultDwell
+		}
+		stopTimeUpdate.Departure = &gtfs.TripUpdate_StopTimeEvent{
+			Time: ptr(stopTimeUpdate.Arrival.GetTime() + int64(dwell.Seconds())),
+		}
+	}
+}
+
+// Build a FULL_DATASET GTFS Realtime message containing the provided entities.
+func buildFeedMessage(clock clock.Clock, entities []*gtfs.FeedEntity, options feedOptions) *gtfs.FeedMessage {
 	return &gtfs.FeedMessage{
 		Header: &gtfs.FeedHeader{
-			GtfsRealtimeVersion: ptr("0.2"),
+			GtfsRealtimeVersion: ptr(options.version),
 			Incrementality:      gtfs.FeedHeader_FULL_DATASET.Enum(),
 			Timestamp:           ptr(uint64(clock.Now().Unix())),
 		},
@@ -262,6 +1280,161 @@ func buildGtfsRealtimeFeedMessage(clock clock.Clock, staticData staticData, real
 	}
 }
 
+// The width of the projected arrival buckets used to synthesize trip IDs.
+const tripIdArrivalBucket = 5 * time.Minute
+
+// Synthesize a trip ID for a train arriving at a station.
+//
+// The ID is derived from the route, direction, station and the bucket containing the projected
+// arrival, so that the same train keeps the same ID across updates as long as its projected
+// arrival stays within the same bucket.
+func synthesizeTripId(routeId string, directionId uint32, stationStopId string, arrival int64) string {
+	bucket := arrival / int64(tripIdArrivalBucket.Seconds())
+	return fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s/%d/%s/%d", routeId, directionId, stationStopId, bucket))))
+}
+
+// Ensure each scheduled trip is assigned to at most one trip update. Observations matched to the
+// same scheduled trip at different stations are merged into the first of them. If several
+// observations at a station are matched to the same scheduled trip, the one with the smallest delay
+// keeps it and the others revert to their synthesized trip IDs.
+func assignScheduledTrips(observations []tripObservation, options feedOptions) []tripObservation {
+	type scheduledTripKey struct {
+		tripId    string
+		startDate string
+	}
+	type stationKey struct {
+		scheduledTripKey
+		stationStopId string
+	}
+	abs := func(d int32) int32 {
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	// The observation assigned the scheduled trip at each station.
+	assigned := map[stationKey]int{}
+	for i, o := range observations {
+		if o.update.Trip.StartDate == nil {
+			continue
+		}
+		key := stationKey{
+			scheduledTripKey: scheduledTripKey{tripId: o.update.Trip.GetTripId(), startDate: o.update.Trip.GetStartDate()},
+			stationStopId:    o.stationStopId,
+		}
+		j, ok := assigned[key]
+		if !ok {
+			assigned[key] = i
+			continue
+		}
+		if abs(o.update.GetDelay()) < abs(observations[j].update.GetDelay()) {
+			assigned[key] = i
+			unassignScheduledTrip(observations[j], options)
+		} else {
+			unassignScheduledTrip(o, options)
+		}
+	}
+	keyToMerged := map[scheduledTripKey]int{}
+	var result []tripObservation
+	for _, o := range observations {
+		if o.update.Trip.StartDate == nil {
+			result = append(result, o)
+			continue
+		}
+		key := scheduledTripKey{tripId: o.update.Trip.GetTripId(), startDate: o.update.Trip.GetStartDate()}
+		i, ok := keyToMerged[key]
+		if !ok {
+			keyToMerged[key] = len(result)
+			result = append(result, o)
+			continue
+		}
+		merged := &result[i]
+		if observationArrival(o) > observationArrival(*merged) {
+			merged.stationStopId = o.stationStopId
+		}
+		merged.update.StopTimeUpdate = append(merged.update.StopTimeUpdate, o.update.StopTimeUpdate...)
+		sort.SliceStable(merged.update.StopTimeUpdate, func(i, j int) bool {
+			return merged.update.StopTimeUpdate[i].GetArrival().GetTime() < merged.update.StopTimeUpdate[j].GetArrival().GetTime()
+		})
+		if o.update.GetTimestamp() > merged.update.GetTimestamp() {
+			merged.update.Timestamp = o.update.Timestamp
+		}
+	}
+	return result
+}
+
+// Revert an observation matched against the static schedule to its synthesized trip ID.
+func unassignScheduledTrip(o tripObservation, options feedOptions) {
+	o.update.Trip.TripId = ptr(o.entityId)
+	o.update.Trip.StartDate = nil
+	o.update.Delay = nil
+	for _, stopTimeUpdate := range o.update.StopTimeUpdate {
+		stopTimeUpdate.Arrival.Delay = nil
+	}
+	o.update.Trip.ScheduleRelationship = nil
+	if options.relationship != nil {
+		o.update.Trip.ScheduleRelationship = options.relationship.Enum()
+	}
+}
+
+// Make entity IDs unique by suffixing repeated IDs with a counter. Synthesized trip IDs can repeat
+// when two trains on the same route arrive at a station in the same bucket.
+func deduplicateEntityIds(observations []tripObservation) {
+	seen := map[string]int{}
+	for i := range observations {
+		o := &observations[i]
+		seen[o.entityId]++
+		if n := seen[o.entityId]; n > 1 {
+			if o.update.Trip.GetTripId() == o.entityId {
+				o.update.Trip.TripId = ptr(fmt.Sprintf("%s-%d", o.entityId, n))
+			}
+			o.entityId = fmt.Sprintf("%s-%d", o.entityId, n)
+		}
+	}
+}
+
+// Returns a label for the train suitable for display to riders; e.g., "33rd Street via Hoboken".
+func trainLabel(train Train) string {
+	if train.Headsign != "" {
+		return train.Headsign
+	}
+	return train.LineName
+}
+
+// Returns the stop ID of the stop time update for the station where the train was observed; see
+// WithPlatformStopIds. The stationStopId of observations is always the parent station's stop ID.
+func stopId(staticData staticData, station sourceapi.Station, train Train, options feedOptions) string {
+	platform := Platform{Station: station, Route: train.Route, Direction: train.Direction}
+	if platformStopId, ok := options.platformToStopId[platform]; ok {
+		return platformStopId
+	}
+	return staticData.stationToStopId[station]
+}
+
+func directionToBoolean(direction sourceapi.Direction) *uint32 {
+	var result uint32
+	if direction == sourceapi.Direction_TO_NY {
+		result = 1
+	} else if direction == sourceapi.Direction_TO_NJ {
+		result = 0
+	}
+	return &result
+}
+
+func timestamppbToInt64(t *timestamppb.Timestamp) *int64 {
+	if t != nil {
+		return ptr(t.Seconds)
+	}
+	return nil
+}
+
+func timestamppbToUint64(t *timestamppb.Timestamp) *uint64 {
+	if t != nil {
+		return ptr(uint64(t.Seconds))
+	}
+	return nil
+}
+
 func ptr[T any](t T) *T {
 	return &t
 }
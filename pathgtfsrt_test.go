@@ -3,6 +3,10 @@ package pathgtfsrt
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
 	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -18,12 +23,14 @@ import (
 const (
 	stopID14St    = "stopID1"
 	stopIDHoboken = "stopID2"
+	stopIDNewport = "stopID3"
 	routeID1      = "routeID1"
 )
 
 func TestFeed(t *testing.T) {
 	for _, tc := range []struct {
 		name    string
+		opts    []FeedOption
 		updates []update
 	}{
 		{
@@ -167,41 +174,59 @@ func TestFeed(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "platform stop IDs",
+			opts: []FeedOption{
+				WithPlatformStopIds(map[Platform]string{
+					{Station: sourceapi.Station_HOBOKEN, Route: sourceapi.Route_HOB_33, Direction: sourceapi.Direction_TO_NY}: "platformStopID1",
+				}),
+			},
+			updates: []update{
+				{
+					data: map[sourceapi.Station][]Train{
+						sourceapi.Station_HOBOKEN: {
+							sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+							sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 5),
+						},
+						sourceapi.Station_FOURTEENTH_STREET: {
+							sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 5),
+						},
+					},
+					wantErrs: 0,
+					wantFeedEntities: []*gtfsrt.FeedEntity{
+						wantFeedEntity(routeID1, 1, "platformStopID1", 15, 10),
+						wantFeedEntity(routeID1, 0, stopIDHoboken, 20, 5),
+						wantFeedEntity(routeID1, 0, stopID14St, 20, 5),
+					},
+				},
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			client := mockSourceClient{
-				stationToStopID: map[sourceapi.Station]string{
-					sourceapi.Station_FOURTEENTH_STREET: stopID14St,
-					sourceapi.Station_HOBOKEN:           stopIDHoboken,
-				},
-				routeToRouteID: map[sourceapi.Route]string{
-					sourceapi.Route_HOB_33: routeID1,
-				},
-				stationToTrains: map[sourceapi.Station][]Train{
-					sourceapi.Station_FOURTEENTH_STREET: nil,
-					sourceapi.Station_HOBOKEN:           nil,
-				},
-			}
+			client := newTestSourceClient(map[sourceapi.Station][]Train{
+				sourceapi.Station_FOURTEENTH_STREET: nil,
+				sourceapi.Station_HOBOKEN:           nil,
+			})
 			ctx := context.Background()
-			updateSignal := make(chan []error, 1)
+			updateSignal := make(chan UpdateResult, 1)
 
 			c := clock.NewMock()
-			feed, err := NewFeed(ctx, c, 5*time.Second, &client, func(msg *gtfsrt.FeedMessage, requestErrs []error) {
-				updateSignal <- requestErrs
-			})
+			feed, err := NewFeed(ctx, c, 5*time.Second, client, func(result UpdateResult) {
+				updateSignal <- result
+			}, tc.opts...)
 			if err != nil {
 				t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
 			}
-			requestErrs := <-updateSignal
-			if numErrs := len(requestErrs); numErrs != 0 {
+			result := <-updateSignal
+			if numErrs := len(result.StationErrs); numErrs != 0 {
 				t.Errorf("callback errs got=%d, want=0", numErrs)
 			}
 
 			for _, update := range tc.updates {
 				client.stationToTrains = update.data
 				c.Add(5 * time.Second)
-				requestErrs = <-updateSignal
-				if numErrs := len(requestErrs); numErrs != update.wantErrs {
+				result = <-updateSignal
+				if numErrs := len(result.StationErrs); numErrs != update.wantErrs {
 					t.Errorf("callback errs got=%d, want=%d", numErrs, update.wantErrs)
 				}
 				b := feed.Get()
@@ -212,7 +237,7 @@ func TestFeed(t *testing.T) {
 				now := uint64(c.Now().Unix())
 				wantMsg := gtfsrt.FeedMessage{
 					Header: &gtfsrt.FeedHeader{
-						GtfsRealtimeVersion: ptr("0.2"),
+						GtfsRealtimeVersion: ptr("2.0"),
 						Incrementality:      gtfsrt.FeedHeader_FULL_DATASET.Enum(),
 						Timestamp:           &now,
 					},
@@ -230,6 +255,1225 @@ func TestFeed(t *testing.T) {
 	}
 }
 
+func TestFeedClampsUpdatePeriod(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		updatePeriod     time.Duration
+		opts             []FeedOption
+		wantUpdatePeriod time.Duration
+	}{
+		{
+			name:             "default minimum",
+			updatePeriod:     100 * time.Millisecond,
+			wantUpdatePeriod: DefaultMinUpdatePeriod,
+		},
+		{
+			name:             "custom minimum",
+			updatePeriod:     2 * time.Second,
+			opts:             []FeedOption{WithMinUpdatePeriod(3 * time.Second)},
+			wantUpdatePeriod: 3 * time.Second,
+		},
+		{
+			name:             "above minimum",
+			updatePeriod:     5 * time.Second,
+			wantUpdatePeriod: 5 * time.Second,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestSourceClient(nil)
+			feed, err := NewFeed(context.Background(), clock.NewMock(), tc.updatePeriod, client,
+				func(UpdateResult) {}, tc.opts...)
+			if err != nil {
+				t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+			}
+			if feed.updatePeriod != tc.wantUpdatePeriod {
+				t.Errorf("update period got=%s, want=%s", feed.updatePeriod, tc.wantUpdatePeriod)
+			}
+		})
+	}
+}
+
+func TestFeedWithLogOutput(t *testing.T) {
+	var out strings.Builder
+	client := newTestSourceClient(nil)
+	_, err := NewFeed(context.Background(), clock.NewMock(), 100*time.Millisecond, client,
+		func(UpdateResult) {}, WithLogOutput(&out))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	for _, want := range []string{"Starting up", "Warning: update period 100ms is below the minimum"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log output got=%q, want to contain %q", out.String(), want)
+		}
+	}
+}
+
+func TestFeedWithStaticDataRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "recovers", failures: 3, wantAttempts: 4},
+		// Attempts at 0s, 1s, 3s, 7s and 10s, when the maximum wait is reached.
+		{name: "gives up", failures: 100, wantAttempts: 5, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := clock.NewMock()
+			client := &flakyStaticDataSourceClient{
+				mockSourceClient: *newTestSourceClient(map[sourceapi.Station][]Train{
+					sourceapi.Station_HOBOKEN: {},
+				}),
+				failures: tc.failures,
+			}
+			result := make(chan error, 1)
+			go func() {
+				_, err := NewFeed(context.Background(), c, 5*time.Second, client,
+					func(UpdateResult) {}, WithStaticDataRetries(10*time.Second))
+				result <- err
+			}()
+			var err error
+		wait:
+			for {
+				select {
+				case err = <-result:
+					break wait
+				default:
+					c.Add(100 * time.Millisecond)
+				}
+			}
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("NewFeed() err got=%v, want error=%t", err, tc.wantErr)
+			}
+			if got := client.getAttempts(); got != tc.wantAttempts {
+				t.Errorf("attempts got=%d, want=%d", got, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+// A source client that fails to return the static data a number of times.
+type flakyStaticDataSourceClient struct {
+	mockSourceClient
+	failures int
+	attempts int
+	mutex    sync.Mutex
+}
+
+func (m *flakyStaticDataSourceClient) GetRouteToRouteId(ctx context.Context) (map[sourceapi.Route]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.attempts++
+	if m.attempts <= m.failures {
+		return nil, fmt.Errorf("source API unavailable")
+	}
+	return m.mockSourceClient.GetRouteToRouteId(ctx)
+}
+
+func (m *flakyStaticDataSourceClient) getAttempts() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.attempts
+}
+
+func TestFeedSetUpdatePeriod(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(nil)
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+
+	f.SetUpdatePeriod(20 * time.Second)
+
+	c.Add(15 * time.Second)
+	select {
+	case <-updateSignal:
+		t.Errorf("feed updated before the new update period elapsed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Add(5 * time.Second)
+	<-updateSignal
+	if got := f.getUpdatePeriod(); got != 20*time.Second {
+		t.Errorf("update period got=%s, want=%s", got, 20*time.Second)
+	}
+
+	f.SetUpdatePeriod(time.Millisecond)
+	if got := f.getUpdatePeriod(); got != DefaultMinUpdatePeriod {
+		t.Errorf("update period below the minimum got=%s, want=%s", got, DefaultMinUpdatePeriod)
+	}
+}
+
+func TestFeedSetPlatformStopIds(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	updateSignal := make(chan *gtfsrt.FeedMessage, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(result UpdateResult) {
+			updateSignal <- result.Msg
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	stopID := func(msg *gtfsrt.FeedMessage) string {
+		return msg.GetEntity()[0].GetTripUpdate().GetStopTimeUpdate()[0].GetStopId()
+	}
+	if got := stopID(<-updateSignal); got != stopIDHoboken {
+		t.Errorf("stop ID got=%s, want=%s", got, stopIDHoboken)
+	}
+
+	f.SetPlatformStopIds(map[Platform]string{
+		{Station: sourceapi.Station_HOBOKEN, Route: sourceapi.Route_HOB_33, Direction: sourceapi.Direction_TO_NY}: "platformStopID1",
+	})
+	c.Add(5 * time.Second)
+	if got := stopID(<-updateSignal); got != "platformStopID1" {
+		t.Errorf("stop ID after SetPlatformStopIds() got=%s, want=platformStopID1", got)
+	}
+}
+
+func TestFeedRefresh(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {},
+	})
+	numUpdates := 0
+	f, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(UpdateResult) {
+			numUpdates++
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	client.stationToTrains[sourceapi.Station_HOBOKEN] = []Train{
+		sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+	}
+
+	if err := f.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() err got=%v, want=<nil>", err)
+	}
+
+	if numUpdates != 2 {
+		t.Errorf("number of updates got=%d, want=2", numUpdates)
+	}
+	if got := len(f.get().msg.GetEntity()); got != 1 {
+		t.Errorf("number of entities after refresh got=%d, want=1", got)
+	}
+}
+
+func TestFeedGetMessage(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	c := clock.NewMock()
+	c.Add(time.Hour)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client, nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	var want gtfsrt.FeedMessage
+	if err := proto.Unmarshal(f.Get(), &want); err != nil {
+		t.Fatalf("proto.Unmarshal() err got=%v, want=<nil>", err)
+	}
+	got := f.GetMessage()
+	if diff := cmp.Diff(got, &want, protocmp.Transform()); diff != "" {
+		t.Errorf("GetMessage() got != want, diff=%s", diff)
+	}
+	// The returned message is a copy.
+	got.Entity = nil
+	if n := len(f.GetMessage().GetEntity()); n != 1 {
+		t.Errorf("number of entities after modifying the returned message got=%d, want=1", n)
+	}
+	if got := f.GetTimestamp(); !got.Equal(c.Now()) {
+		t.Errorf("GetTimestamp() got=%s, want=%s", got, c.Now())
+	}
+}
+
+func TestFeedGetMessage_NotBuilt(t *testing.T) {
+	var f Feed
+	if got := f.GetMessage(); got != nil {
+		t.Errorf("GetMessage() got=%v, want=<nil>", got)
+	}
+	if got := f.GetTimestamp(); !got.IsZero() {
+		t.Errorf("GetTimestamp() got=%s, want=<zero>", got)
+	}
+}
+
+func TestFeedForceUpdate(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN:           {},
+		sourceapi.Station_FOURTEENTH_STREET: {},
+	})
+	f, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client, nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	client.stationToTrains = map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	}
+
+	result, err := f.ForceUpdate(context.Background())
+	if err != nil {
+		t.Fatalf("ForceUpdate() err got=%v, want=<nil>", err)
+	}
+	if _, ok := result.StationErrs[sourceapi.Station_FOURTEENTH_STREET]; !ok || len(result.StationErrs) != 1 {
+		t.Errorf("station errors got=%v, want an error for FOURTEENTH_STREET only", result.StationErrs)
+	}
+	if got := len(result.Msg.GetEntity()); got != 1 {
+		t.Errorf("number of entities got=%d, want=1", got)
+	}
+}
+
+func TestFeedPause(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(nil)
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+	want := f.Get()
+
+	f.Pause()
+
+	if !f.Paused() {
+		t.Errorf("Paused() got=false, want=true")
+	}
+	c.Add(5 * time.Second)
+	select {
+	case <-updateSignal:
+		t.Errorf("feed updated while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := f.Get(); string(got) != string(want) {
+		t.Errorf("Get() while paused got=%v, want=%v", got, want)
+	}
+
+	f.Resume()
+
+	if f.Paused() {
+		t.Errorf("Paused() got=true, want=false")
+	}
+	c.Add(5 * time.Second)
+	<-updateSignal
+}
+
+func TestFeedServeHTTPWarmingUp(t *testing.T) {
+	f := &Feed{updatePeriod: 5 * time.Second}
+
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code before first update got=%d, want=%d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After header got=%q, want=%q", got, "5")
+	}
+
+	msg := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: ptr("0.2")},
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("proto.Marshal() err got=%v, want=<nil>", err)
+	}
+	f.set(snapshot{msg: msg, gtfs: b})
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status code after first update got=%d, want=%d", w.Code, http.StatusOK)
+	}
+	var gotMsg gtfsrt.FeedMessage
+	if err := proto.Unmarshal(w.Body.Bytes(), &gotMsg); err != nil {
+		t.Errorf("proto.Unmarshal() err got=%v, want=<nil>", err)
+	}
+	if got := gotMsg.GetHeader().GetGtfsRealtimeVersion(); got != "0.2" {
+		t.Errorf("GTFS realtime version got=%q, want=%q", got, "0.2")
+	}
+}
+
+func TestFeedWithMaxStaleness(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		},
+		WithMaxStaleness(12*time.Second))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+
+	delete(client.stationToTrains, sourceapi.Station_HOBOKEN)
+	for i := 0; i < 2; i++ {
+		c.Add(5 * time.Second)
+		<-updateSignal
+	}
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status code within the max staleness got=%d, want=%d", w.Code, http.StatusOK)
+	}
+
+	c.Add(5 * time.Second)
+	<-updateSignal
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code beyond the max staleness got=%d, want=%d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After header got=%q, want=%q", got, "5")
+	}
+
+	client.stationToTrains[sourceapi.Station_HOBOKEN] = []Train{}
+	c.Add(5 * time.Second)
+	<-updateSignal
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status code after fresh data got=%d, want=%d", w.Code, http.StatusOK)
+	}
+}
+
+func TestFeedServeHTTPSourceLastUpdated(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 12),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 25, 5),
+		},
+	})
+	feed, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	w := httptest.NewRecorder()
+	feed.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	want := makeTime(12).Format(http.TimeFormat)
+	if got := w.Header().Get("X-Source-Last-Updated"); got != want {
+		t.Errorf("X-Source-Last-Updated header got=%q, want=%q", got, want)
+	}
+}
+
+func TestFeedStatusTextHandler(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 5),
+		},
+	})
+	c := clock.NewMock()
+	feed, err := NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	c.Add(3 * time.Second)
+
+	w := httptest.NewRecorder()
+	feed.StatusTextHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status code got=%d, want=%d", w.Code, http.StatusOK)
+	}
+	want := "entities: 2\nage_seconds: 3\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body got=%q, want=%q", got, want)
+	}
+}
+
+func TestFeedWithRawRouteCodesInTripIds(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	for _, tc := range []struct {
+		name      string
+		opts      []FeedOption
+		wantRoute sourceapi.Route
+		wantOk    bool
+	}{
+		{
+			name:      "default",
+			wantRoute: sourceapi.Route_ROUTE_UNSPECIFIED,
+			wantOk:    false,
+		},
+		{
+			name:      "enabled",
+			opts:      []FeedOption{WithRawRouteCodesInTripIds()},
+			wantRoute: sourceapi.Route_HOB_33,
+			wantOk:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotMsg *gtfsrt.FeedMessage
+			_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+				func(result UpdateResult) {
+					gotMsg = result.Msg
+				}, tc.opts...)
+			if err != nil {
+				t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+			}
+			if numEntities := len(gotMsg.GetEntity()); numEntities != 1 {
+				t.Fatalf("number of entities got=%d, want=1", numEntities)
+			}
+			tripID := gotMsg.GetEntity()[0].GetTripUpdate().GetTrip().GetTripId()
+			gotRoute, gotOk := RawRouteCodeFromTripId(tripID)
+			if gotRoute != tc.wantRoute || gotOk != tc.wantOk {
+				t.Errorf("RawRouteCodeFromTripId(%q) got=(%s, %t), want=(%s, %t)", tripID, gotRoute, gotOk, tc.wantRoute, tc.wantOk)
+			}
+		})
+	}
+}
+
+func TestFeedVehicleLabel(t *testing.T) {
+	withHeadsign := sourceTrain(sourceapi.Route_JSQ_33_HOB, sourceapi.Direction_TO_NY, 15, 10)
+	withHeadsign.Headsign = "33rd Street via Hoboken"
+	withHeadsign.LineName = "33rd Street"
+	withLineName := sourceTrain(sourceapi.Route_JSQ_33_HOB, sourceapi.Direction_TO_NY, 16, 10)
+	withLineName.LineName = "33rd Street via Hoboken"
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			withHeadsign,
+			withLineName,
+			sourceTrain(sourceapi.Route_JSQ_33_HOB, sourceapi.Direction_TO_NY, 17, 10),
+		},
+	})
+	client.routeToRouteID = map[sourceapi.Route]string{
+		sourceapi.Route_JSQ_33_HOB: routeID1,
+	}
+	var gotMsg *gtfsrt.FeedMessage
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	var got []*gtfsrt.VehicleDescriptor
+	for _, entity := range gotMsg.GetEntity() {
+		got = append(got, entity.GetTripUpdate().GetVehicle())
+	}
+	want := []*gtfsrt.VehicleDescriptor{
+		{Label: ptr("33rd Street via Hoboken")},
+		{Label: ptr("33rd Street via Hoboken")},
+		nil,
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("vehicle descriptors got != want, diff=%s", diff)
+	}
+}
+
+func TestFeedWithDepartures(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 10),
+		},
+	})
+	var gotMsg *gtfsrt.FeedMessage
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		}, WithDepartures(0, map[string]time.Duration{stopID14St: 2 * time.Minute}))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	var got []int64
+	for _, entity := range gotMsg.GetEntity() {
+		got = append(got, entity.GetTripUpdate().GetStopTimeUpdate()[0].GetDeparture().GetTime())
+	}
+	want := []int64{*makeUnix(15), *makeUnix(22)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("departure times got != want, diff=%s", diff)
+	}
+}
+
+func TestFeedStableTripIds(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 21, 10),
+		},
+	})
+	updateSignal := make(chan *gtfsrt.FeedMessage, 1)
+	c := clock.NewMock()
+	_, err := NewFeed(context.Background(), c, 5*time.Second, client, func(result UpdateResult) {
+		updateSignal <- result.Msg
+	})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	tripIDs := func(msg *gtfsrt.FeedMessage) []string {
+		var ids []string
+		for _, entity := range msg.GetEntity() {
+			ids = append(ids, entity.GetTripUpdate().GetTrip().GetTripId())
+		}
+		return ids
+	}
+	initialIDs := tripIDs(<-updateSignal)
+
+	// The projected arrivals and last updated times change, but stay within the same buckets.
+	// A third train arrives in the same bucket as the first.
+	client.stationToTrains = map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 16, 11),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 22, 11),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 17, 11),
+		},
+	}
+	c.Add(5 * time.Second)
+	gotIDs := tripIDs(<-updateSignal)
+
+	if diff := cmp.Diff(initialIDs, gotIDs[:2]); diff != "" {
+		t.Errorf("trip IDs got != want, diff=%s", diff)
+	}
+	if want := initialIDs[0] + "-2"; gotIDs[2] != want {
+		t.Errorf("repeated trip ID got=%s, want=%s", gotIDs[2], want)
+	}
+}
+
+func TestFeedWithGtfsRealtimeVersion(t *testing.T) {
+	client := newTestSourceClient(nil)
+	for _, tc := range []struct {
+		name string
+		opts []FeedOption
+		want string
+	}{
+		{
+			name: "default",
+			want: "2.0",
+		},
+		{
+			name: "pinned",
+			opts: []FeedOption{WithGtfsRealtimeVersion("0.2")},
+			want: "0.2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotMsg *gtfsrt.FeedMessage
+			_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+				func(result UpdateResult) {
+					gotMsg = result.Msg
+				}, tc.opts...)
+			if err != nil {
+				t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+			}
+			if got := gotMsg.GetHeader().GetGtfsRealtimeVersion(); got != tc.want {
+				t.Errorf("GTFS realtime version got=%q, want=%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFeedStaticDataDrift(t *testing.T) {
+	newStation := sourceapi.Station(100)
+	client := newTestSourceClient(map[sourceapi.Station][]Train{})
+	for station, stopID := range sourceStationToGtfsStopId {
+		client.stationToStopID[station] = stopID
+		client.stationToTrains[station] = nil
+	}
+	client.stationToStopID[newStation] = "newStopID"
+	client.stationToTrains[newStation] = nil
+	for route, routeID := range sourceRouteToGtfsRouteId {
+		client.routeToRouteID[route] = routeID
+	}
+	delete(client.routeToRouteID, sourceapi.Route_HOB_33)
+	client.routeToRouteID[sourceapi.Route_NWK_WTC] = "changedRouteID"
+
+	feed, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	want := StaticDataDrift{
+		AddedStations: []sourceapi.Station{newStation},
+		RemovedRoutes: []sourceapi.Route{sourceapi.Route_HOB_33},
+		ChangedRoutes: []sourceapi.Route{sourceapi.Route_NWK_WTC},
+	}
+	if diff := cmp.Diff(feed.StaticDataDrift(), want); diff != "" {
+		t.Errorf("StaticDataDrift() got != want, diff=%s", diff)
+	}
+}
+
+func TestFeedDifferentialHandler(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 5),
+		},
+	})
+	updateSignal := make(chan *gtfsrt.FeedMessage, 1)
+	c := clock.NewMock()
+	feed, err := NewFeed(context.Background(), c, 5*time.Second, client, func(result UpdateResult) {
+		updateSignal <- result.Msg
+	})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	initialMsg := <-updateSignal
+	var removedEntityID string
+	for _, entity := range initialMsg.GetEntity() {
+		if entity.GetTripUpdate().GetStopTimeUpdate()[0].GetStopId() == stopID14St {
+			removedEntityID = entity.GetId()
+		}
+	}
+
+	client.stationToTrains = map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 25, 6),
+		},
+	}
+	c.Add(5 * time.Second)
+	<-updateSignal
+
+	for _, tc := range []struct {
+		name               string
+		handler            http.Handler
+		wantIncrementality gtfsrt.FeedHeader_Incrementality
+		wantEntities       []*gtfsrt.FeedEntity
+		wantDeletedIDs     []string
+	}{
+		{
+			name:               "full dataset",
+			handler:            feed,
+			wantIncrementality: gtfsrt.FeedHeader_FULL_DATASET,
+			wantEntities: []*gtfsrt.FeedEntity{
+				wantFeedEntity(routeID1, 1, stopIDHoboken, 15, 10),
+				wantFeedEntity(routeID1, 0, stopID14St, 25, 6),
+			},
+		},
+		{
+			name:               "differential",
+			handler:            feed.DifferentialHandler(),
+			wantIncrementality: gtfsrt.FeedHeader_DIFFERENTIAL,
+			wantEntities: []*gtfsrt.FeedEntity{
+				wantFeedEntity(routeID1, 0, stopID14St, 25, 6),
+				{IsDeleted: ptr(true)},
+			},
+			wantDeletedIDs: []string{removedEntityID},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+			var gotMsg gtfsrt.FeedMessage
+			if err := proto.Unmarshal(w.Body.Bytes(), &gotMsg); err != nil {
+				t.Fatalf("proto.Unmarshal() err got=%v, want=<nil>", err)
+			}
+			if got := gotMsg.GetHeader().GetIncrementality(); got != tc.wantIncrementality {
+				t.Errorf("incrementality got=%s, want=%s", got, tc.wantIncrementality)
+			}
+			if diff := cmp.Diff(gotMsg.GetEntity(), tc.wantEntities,
+				protocmp.Transform(),
+				protocmp.IgnoreFields(&gtfsrt.FeedEntity{}, "id"),
+				protocmp.IgnoreFields(&gtfsrt.TripDescriptor{}, "trip_id"),
+			); diff != "" {
+				t.Errorf("GTFS realtime entities got != want, diff=%s", diff)
+			}
+			var gotDeletedIDs []string
+			for _, entity := range gotMsg.GetEntity() {
+				if entity.GetIsDeleted() {
+					gotDeletedIDs = append(gotDeletedIDs, entity.GetId())
+				}
+			}
+			if diff := cmp.Diff(gotDeletedIDs, tc.wantDeletedIDs); diff != "" {
+				t.Errorf("deleted entity IDs got != want, diff=%s", diff)
+			}
+		})
+	}
+}
+
+func TestFeedWithDifferentialIncrementality(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	var callbackMsg *gtfsrt.FeedMessage
+	feed, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client, func(result UpdateResult) {
+		callbackMsg = result.Msg
+	}, WithDifferentialIncrementality())
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	if got := callbackMsg.GetHeader().GetIncrementality(); got != gtfsrt.FeedHeader_FULL_DATASET {
+		t.Errorf("callback incrementality got=%s, want=%s", got, gtfsrt.FeedHeader_FULL_DATASET)
+	}
+	if diff := cmp.Diff(feed.Get(), feed.GetDifferential()); diff != "" {
+		t.Errorf("Get() got != GetDifferential(), diff=%s", diff)
+	}
+	w := httptest.NewRecorder()
+	feed.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	var gotMsg gtfsrt.FeedMessage
+	if err := proto.Unmarshal(w.Body.Bytes(), &gotMsg); err != nil {
+		t.Fatalf("proto.Unmarshal() err got=%v, want=<nil>", err)
+	}
+	if got := gotMsg.GetHeader().GetIncrementality(); got != gtfsrt.FeedHeader_DIFFERENTIAL {
+		t.Errorf("incrementality got=%s, want=%s", got, gtfsrt.FeedHeader_DIFFERENTIAL)
+	}
+}
+
+func TestFeedUpdatePhaseDurations(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	client.onGetTrains = func() {
+		// Simulate a slow source API
+		c.Add(2 * time.Second)
+	}
+	var got []UpdatePhaseDurations
+	_, err := NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {},
+		WithUpdatePhaseDurationsCallback(func(d UpdatePhaseDurations) {
+			got = append(got, d)
+		}))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	want := []UpdatePhaseDurations{{Fetch: 2 * time.Second}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("phase durations got != want, diff=%s", diff)
+	}
+}
+
+func TestFeedServeHTTPJson(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	var wantMsg *gtfsrt.FeedMessage
+	feed, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client, func(result UpdateResult) {
+		wantMsg = result.Msg
+	})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		target string
+		accept string
+	}{
+		{
+			name:   "accept header",
+			target: "/gtfsrt",
+			accept: "application/json",
+		},
+		{
+			name:   "query parameter",
+			target: "/gtfsrt?format=json",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			feed.ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type got=%q, want=%q", got, "application/json")
+			}
+			var gotMsg gtfsrt.FeedMessage
+			if err := protojson.Unmarshal(w.Body.Bytes(), &gotMsg); err != nil {
+				t.Fatalf("protojson.Unmarshal() err got=%v, want=<nil>", err)
+			}
+			if diff := cmp.Diff(&gotMsg, wantMsg, protocmp.Transform()); diff != "" {
+				t.Errorf("GTFS realtime feed got != want, diff=%s", diff)
+			}
+		})
+	}
+}
+
+func TestVehiclePositionFeed(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 8),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 12, 8),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 5, 4),
+		},
+	})
+	clock := clock.NewMock()
+	clock.Set(makeTime(10))
+
+	var tripUpdatesMsg *gtfsrt.FeedMessage
+	tripUpdatesFeed, err := NewFeed(context.Background(), clock, 5*time.Second, client,
+		func(result UpdateResult) {
+			tripUpdatesMsg = result.Msg
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	tripIDs := map[string]bool{}
+	for _, entity := range tripUpdatesMsg.GetEntity() {
+		tripIDs[entity.GetTripUpdate().GetTrip().GetTripId()] = true
+	}
+
+	var gotMsg *gtfsrt.FeedMessage
+	_, err = NewVehiclePositionFeed(context.Background(), clock, tripUpdatesFeed,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		})
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+
+	wantEntities := []*gtfsrt.FeedEntity{
+		wantVehiclePosition(routeID1, 0, stopIDHoboken, gtfsrt.VehiclePosition_STOPPED_AT, 4),
+		wantVehiclePosition(routeID1, 1, stopIDHoboken, gtfsrt.VehiclePosition_INCOMING_AT, 8),
+	}
+	if diff := cmp.Diff(wantEntities, gotMsg.GetEntity(), protocmp.Transform(),
+		protocmp.IgnoreFields(&gtfsrt.FeedEntity{}, "id"),
+		protocmp.IgnoreFields(&gtfsrt.TripDescriptor{}, "trip_id")); diff != "" {
+		t.Errorf("entities got != want, diff=%s", diff)
+	}
+	for _, entity := range gotMsg.GetEntity() {
+		tripID := entity.GetVehicle().GetTrip().GetTripId()
+		if entity.GetId() != tripID {
+			t.Errorf("entity ID got=%q, want=%q", entity.GetId(), tripID)
+		}
+		if !tripIDs[tripID] {
+			t.Errorf("trip ID %q not present in the trip updates feed", tripID)
+		}
+	}
+}
+
+func TestVehiclePositionFeed_FollowsTripUpdatesFeed(t *testing.T) {
+	requests := 0
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: nil,
+	})
+	client.onGetTrains = func() {
+		requests++
+	}
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	ctx := context.Background()
+	tripUpdatesFeed, err := NewFeed(ctx, c, 5*time.Second, client, nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	updateSignal := make(chan UpdateResult, 1)
+	_, err = NewVehiclePositionFeed(ctx, c, tripUpdatesFeed, func(result UpdateResult) {
+		updateSignal <- result
+	})
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+	if result := <-updateSignal; len(result.Msg.GetEntity()) != 0 {
+		t.Errorf("entities got=%d, want=0", len(result.Msg.GetEntity()))
+	}
+
+	client.stationToTrains = map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 12, 8),
+		},
+	}
+	c.Add(5 * time.Second)
+	result := <-updateSignal
+
+	wantEntities := []*gtfsrt.FeedEntity{
+		wantVehiclePosition(routeID1, 1, stopIDHoboken, gtfsrt.VehiclePosition_INCOMING_AT, 8),
+	}
+	if diff := cmp.Diff(wantEntities, result.Msg.GetEntity(), protocmp.Transform(),
+		protocmp.IgnoreFields(&gtfsrt.FeedEntity{}, "id"),
+		protocmp.IgnoreFields(&gtfsrt.TripDescriptor{}, "trip_id")); diff != "" {
+		t.Errorf("entities got != want, diff=%s", diff)
+	}
+	// Only the trip updates feed requests the source API.
+	if requests != 2 {
+		t.Errorf("source API requests got=%d, want=2", requests)
+	}
+}
+
+func TestVehiclePositionFeed_TripUpdatesFeedErrors(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 12, 8),
+		},
+	})
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	ctx := context.Background()
+	tripUpdatesFeed, err := NewFeed(ctx, c, 5*time.Second, client, nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	updateSignal := make(chan UpdateResult, 1)
+	f, err := NewVehiclePositionFeed(ctx, c, tripUpdatesFeed, func(result UpdateResult) {
+		updateSignal <- result
+	})
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+
+	delete(client.stationToTrains, sourceapi.Station_HOBOKEN)
+	c.Add(5 * time.Second)
+	if result := <-updateSignal; len(result.StationErrs) != 1 {
+		t.Errorf("errors got=%v, want 1 error", result.StationErrs)
+	}
+	// The vehicle positions are no fresher than the trip updates.
+	if err := f.CheckReady(time.Second); err == nil {
+		t.Errorf("CheckReady() err got=<nil>, want error")
+	}
+}
+
+func TestVehiclePositionFeed_Paused(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: nil,
+	})
+	c := clock.NewMock()
+	ctx := context.Background()
+	tripUpdatesFeed, err := NewFeed(ctx, c, 5*time.Second, client, nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	numUpdates := 0
+	f, err := NewVehiclePositionFeed(ctx, c, tripUpdatesFeed, func(UpdateResult) {
+		numUpdates++
+	})
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+	// Runs after the vehicle positions feed has handled each update of the trip updates feed.
+	updateSignal := make(chan struct{}, 1)
+	tripUpdatesFeed.Subscribe(func(UpdateResult) {
+		updateSignal <- struct{}{}
+	})
+
+	f.Pause()
+	c.Add(5 * time.Second)
+	<-updateSignal
+	if numUpdates != 1 {
+		t.Errorf("number of updates while paused got=%d, want=1", numUpdates)
+	}
+	f.Resume()
+	c.Add(5 * time.Second)
+	<-updateSignal
+	if numUpdates != 2 {
+		t.Errorf("number of updates after resuming got=%d, want=2", numUpdates)
+	}
+}
+
+func TestVehiclePositionFeed_OneVehiclePerTrip(t *testing.T) {
+	patterns := []RoutePattern{
+		{
+			RouteId:     routeID1,
+			DirectionId: 1,
+			Stops: []PatternStop{
+				{StopId: stopIDNewport, OffsetSeconds: 0},
+				{StopId: stopIDHoboken, OffsetSeconds: 120},
+				{StopId: stopID14St, OffsetSeconds: 600},
+			},
+		},
+	}
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_NEWPORT: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 12, 5),
+		},
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 14, 6),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 22, 7),
+		},
+	})
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	tripUpdatesFeed, err := NewFeed(context.Background(), c, 5*time.Second, client, nil,
+		WithRoutePatterns(patterns), WithTripStitching())
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	var gotMsg *gtfsrt.FeedMessage
+	_, err = NewVehiclePositionFeed(context.Background(), c, tripUpdatesFeed,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		}, WithRoutePatterns(patterns))
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+
+	// The train is observed at three stations, and is reported once, at the next station.
+	wantEntities := []*gtfsrt.FeedEntity{
+		wantVehiclePosition(routeID1, 1, stopIDNewport, gtfsrt.VehiclePosition_INCOMING_AT, 7),
+	}
+	if diff := cmp.Diff(wantEntities, gotMsg.GetEntity(), protocmp.Transform(),
+		protocmp.IgnoreFields(&gtfsrt.FeedEntity{}, "id"),
+		protocmp.IgnoreFields(&gtfsrt.TripDescriptor{}, "trip_id")); diff != "" {
+		t.Errorf("entities got != want, diff=%s", diff)
+	}
+	var tripUpdatesMsg gtfsrt.FeedMessage
+	if err := proto.Unmarshal(tripUpdatesFeed.Get(), &tripUpdatesMsg); err != nil {
+		t.Fatalf("proto.Unmarshal() err got=%v, want=<nil>", err)
+	}
+	if got, want := gotMsg.GetEntity()[0].GetVehicle().GetTrip().GetTripId(),
+		tripUpdatesMsg.GetEntity()[0].GetTripUpdate().GetTrip().GetTripId(); got != want {
+		t.Errorf("trip ID got=%q, want=%q", got, want)
+	}
+}
+
+func wantVehiclePosition(routeID string, directionID uint32, stopID string, status gtfsrt.VehiclePosition_VehicleStopStatus, lastUpdated int) *gtfsrt.FeedEntity {
+	u := uint64(*makeUnix(lastUpdated))
+	return &gtfsrt.FeedEntity{
+		Vehicle: &gtfsrt.VehiclePosition{
+			Trip: &gtfsrt.TripDescriptor{
+				RouteId:     &routeID,
+				DirectionId: &directionID,
+			},
+			StopId:        &stopID,
+			CurrentStatus: status.Enum(),
+			Timestamp:     &u,
+		},
+	}
+}
+
+func TestFeedClose(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+		},
+	})
+	c := clock.NewMock()
+	numUpdates := 0
+	feed, err := NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {
+		numUpdates++
+	})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	want := feed.Get()
+
+	if err := feed.Close(); err != nil {
+		t.Errorf("Close() err got=%v, want=<nil>", err)
+	}
+	// Close waits for the update goroutine to return, so no update can run after it.
+	c.Add(time.Minute)
+	if numUpdates != 1 {
+		t.Errorf("number of updates got=%d, want=1", numUpdates)
+	}
+	if err := feed.Refresh(context.Background()); err != ErrFeedClosed {
+		t.Errorf("Refresh() err got=%v, want=%v", err, ErrFeedClosed)
+	}
+	if got := feed.Get(); string(got) != string(want) {
+		t.Errorf("Get() after Close() got=%v, want=%v", got, want)
+	}
+}
+
+func TestFeedSubscribe(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+		},
+	})
+	c := clock.NewMock()
+	feed, err := NewFeed(context.Background(), c, 5*time.Second, client, nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	updateSignal1 := make(chan UpdateResult, 1)
+	unsubscribe1 := feed.Subscribe(func(result UpdateResult) {
+		updateSignal1 <- result
+	})
+	updateSignal2 := make(chan UpdateResult, 1)
+	feed.Subscribe(func(result UpdateResult) {
+		updateSignal2 <- result
+	})
+
+	c.Add(5 * time.Second)
+	<-updateSignal1
+	<-updateSignal2
+
+	unsubscribe1()
+	c.Add(5 * time.Second)
+	<-updateSignal2
+	select {
+	case <-updateSignal1:
+		t.Errorf("unsubscribed callback was run")
+	default:
+	}
+}
+
+func TestFeedUpdateResult(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 15, 5),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {},
+	})
+	updateSignal := make(chan UpdateResult, 1)
+	c := clock.NewMock()
+	_, err := NewFeed(context.Background(), c, 5*time.Second, client, func(result UpdateResult) {
+		updateSignal <- result
+	})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	result := <-updateSignal
+	if result.EntitiesAdded != 2 || result.EntitiesRemoved != 0 || result.EntitiesChanged != 0 {
+		t.Errorf("first update entities added, removed, changed got=%d, %d, %d, want=2, 0, 0",
+			result.EntitiesAdded, result.EntitiesRemoved, result.EntitiesChanged)
+	}
+	if want := proto.Size(result.Msg); result.Bytes != want {
+		t.Errorf("first update bytes got=%d, want=%d", result.Bytes, want)
+	}
+
+	client.stationToTrains = map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			// The same train with a new last updated time.
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 6),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 40, 6),
+		},
+	}
+	c.Add(5 * time.Second)
+	result = <-updateSignal
+	if result.EntitiesAdded != 1 || result.EntitiesRemoved != 1 || result.EntitiesChanged != 1 {
+		t.Errorf("second update entities added, removed, changed got=%d, %d, %d, want=1, 1, 1",
+			result.EntitiesAdded, result.EntitiesRemoved, result.EntitiesChanged)
+	}
+	if _, ok := result.StationErrs[sourceapi.Station_FOURTEENTH_STREET]; !ok || len(result.StationErrs) != 1 {
+		t.Errorf("second update station errors got=%v, want an error for FOURTEENTH_STREET only", result.StationErrs)
+	}
+}
+
 func sourceTrain(route sourceapi.Route, direction sourceapi.Direction, projectedArrival int, lastUpdated int) Train {
 	return Train(&sourceapi.GetUpcomingTrainsResponse_UpcomingTrain{
 		Route:            route,
@@ -283,6 +1527,31 @@ type mockSourceClient struct {
 	stationToStopID map[sourceapi.Station]string
 	routeToRouteID  map[sourceapi.Route]string
 	stationToTrains map[sourceapi.Station][]Train
+	onGetTrains     func()
+}
+
+// The stop IDs of the stations that test source clients have upcoming trains at; see
+// newTestSourceClient.
+var testStationToStopID = map[sourceapi.Station]string{
+	sourceapi.Station_FOURTEENTH_STREET: stopID14St,
+	sourceapi.Station_HOBOKEN:           stopIDHoboken,
+	sourceapi.Station_NEWPORT:           stopIDNewport,
+}
+
+// Returns a source client with the provided upcoming trains at each station. The stop ID of each
+// station is taken from testStationToStopID, and HOB_33 is the only route, with ID routeID1.
+func newTestSourceClient(stationToTrains map[sourceapi.Station][]Train) *mockSourceClient {
+	client := &mockSourceClient{
+		stationToStopID: map[sourceapi.Station]string{},
+		routeToRouteID: map[sourceapi.Route]string{
+			sourceapi.Route_HOB_33: routeID1,
+		},
+		stationToTrains: stationToTrains,
+	}
+	for station := range stationToTrains {
+		client.stationToStopID[station] = testStationToStopID[station]
+	}
+	return client
 }
 
 func (m *mockSourceClient) GetStationToStopId(context.Context) (map[sourceapi.Station]string, error) {
@@ -294,6 +1563,9 @@ func (m *mockSourceClient) GetRouteToRouteId(context.Context) (map[sourceapi.Rou
 }
 
 func (m *mockSourceClient) GetTrainsAtStation(_ context.Context, s sourceapi.Station) ([]Train, error) {
+	if m.onGetTrains != nil {
+		m.onGetTrains()
+	}
 	trains, ok := m.stationToTrains[s]
 	if !ok {
 		return nil, fmt.Errorf("error getting trains at station %s", s)
@@ -0,0 +1,177 @@
+// Package pathgtfsrttest provides test doubles for programs that embed the pathgtfsrt package, so
+// they can test their use of feeds without requesting a real source API.
+package pathgtfsrttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	pathgtfsrt "github.com/jamespfennell/path-train-gtfs-realtime"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FakeSourceClient is a pathgtfsrt.SourceClient whose responses are configured by the test. It is
+// safe for concurrent use, so responses can be changed while a feed is using the client.
+//
+// By default the static data is the built-in snapshot of the PATH GTFS static stop and route IDs,
+// and there are no upcoming trains at any station.
+type FakeSourceClient struct {
+	clock           clock.Clock
+	mutex           sync.Mutex
+	stationToStopId map[sourceapi.Station]string
+	routeToRouteId  map[sourceapi.Route]string
+	staticDataErr   error
+	responses       map[sourceapi.Station]Response
+	scripted        map[sourceapi.Station][]Response
+	latency         time.Duration
+	requests        map[sourceapi.Station]int
+}
+
+// Response is the response of a FakeSourceClient to a request for the upcoming trains at a station.
+type Response struct {
+	Trains []pathgtfsrt.Train
+	// If set, the request fails with this error and Trains is ignored.
+	Err error
+}
+
+// NewFakeSourceClient creates a fake source client. The clock is used to simulate latencies; see
+// SetLatency.
+func NewFakeSourceClient(clock clock.Clock) *FakeSourceClient {
+	// The PANYNJ client has no static data endpoint and returns the built-in snapshot.
+	var panynj pathgtfsrt.PaNyNjClient
+	stationToStopId, _ := panynj.GetStationToStopId(context.Background())
+	routeToRouteId, _ := panynj.GetRouteToRouteId(context.Background())
+	c := &FakeSourceClient{
+		clock:     clock,
+		responses: map[sourceapi.Station]Response{},
+		scripted:  map[sourceapi.Station][]Response{},
+		requests:  map[sourceapi.Station]int{},
+	}
+	c.SetStaticData(stationToStopId, routeToRouteId)
+	return c
+}
+
+// SetStaticData sets the maps from source API stations and routes to GTFS static stop and route
+// IDs. The feed only requests the upcoming trains of the stations in the map.
+func (c *FakeSourceClient) SetStaticData(stationToStopId map[sourceapi.Station]string, routeToRouteId map[sourceapi.Route]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stationToStopId = map[sourceapi.Station]string{}
+	for station, stopId := range stationToStopId {
+		c.stationToStopId[station] = stopId
+	}
+	c.routeToRouteId = map[sourceapi.Route]string{}
+	for route, routeId := range routeToRouteId {
+		c.routeToRouteId[route] = routeId
+	}
+}
+
+// SetStaticDataError makes the requests for static data fail with the provided error, or succeed
+// again if it is nil.
+func (c *FakeSourceClient) SetStaticDataError(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.staticDataErr = err
+}
+
+// SetTrains sets the upcoming trains at a station, which are returned by every subsequent request
+// for the station once the scripted responses, if any, have been returned.
+func (c *FakeSourceClient) SetTrains(station sourceapi.Station, trains ...pathgtfsrt.Train) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.responses[station] = Response{Trains: trains}
+}
+
+// SetError makes every subsequent request for the upcoming trains at a station fail with the
+// provided error, once the scripted responses, if any, have been returned.
+func (c *FakeSourceClient) SetError(station sourceapi.Station, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.responses[station] = Response{Err: err}
+}
+
+// Script queues responses for a station, which are returned in order by the next requests for its
+// upcoming trains; e.g., to simulate a station that fails once and then recovers.
+func (c *FakeSourceClient) Script(station sourceapi.Station, responses ...Response) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.scripted[station] = append(c.scripted[station], responses...)
+}
+
+// SetLatency delays the responses to the requests for upcoming trains by the provided duration, as
+// measured by the client's clock. With a mock clock, the test must advance the clock for the
+// requests to complete.
+func (c *FakeSourceClient) SetLatency(latency time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.latency = latency
+}
+
+// Requests returns the number of requests for the upcoming trains at a station so far.
+func (c *FakeSourceClient) Requests(station sourceapi.Station) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.requests[station]
+}
+
+func (c *FakeSourceClient) GetStationToStopId(context.Context) (map[sourceapi.Station]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.staticDataErr != nil {
+		return nil, c.staticDataErr
+	}
+	stationToStopId := map[sourceapi.Station]string{}
+	for station, stopId := range c.stationToStopId {
+		stationToStopId[station] = stopId
+	}
+	return stationToStopId, nil
+}
+
+func (c *FakeSourceClient) GetRouteToRouteId(context.Context) (map[sourceapi.Route]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.staticDataErr != nil {
+		return nil, c.staticDataErr
+	}
+	routeToRouteId := map[sourceapi.Route]string{}
+	for route, routeId := range c.routeToRouteId {
+		routeToRouteId[route] = routeId
+	}
+	return routeToRouteId, nil
+}
+
+func (c *FakeSourceClient) GetTrainsAtStation(ctx context.Context, station sourceapi.Station) ([]pathgtfsrt.Train, error) {
+	c.mutex.Lock()
+	c.requests[station]++
+	response := c.responses[station]
+	if scripted := c.scripted[station]; len(scripted) > 0 {
+		response = scripted[0]
+		c.scripted[station] = scripted[1:]
+	}
+	latency := c.latency
+	c.mutex.Unlock()
+	if latency > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.clock.After(latency):
+		}
+	}
+	if response.Err != nil {
+		return nil, response.Err
+	}
+	return response.Trains, nil
+}
+
+// NewTrain returns an upcoming train with the provided data, as returned by a source API.
+func NewTrain(route sourceapi.Route, direction sourceapi.Direction, projectedArrival, lastUpdated time.Time) pathgtfsrt.Train {
+	return &sourceapi.GetUpcomingTrainsResponse_UpcomingTrain{
+		Route:            route,
+		Direction:        direction,
+		ProjectedArrival: timestamppb.New(projectedArrival),
+		LastUpdated:      timestamppb.New(lastUpdated),
+	}
+}
@@ -0,0 +1,83 @@
+package pathgtfsrttest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	pathgtfsrt "github.com/jamespfennell/path-train-gtfs-realtime"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFakeSourceClient(t *testing.T) {
+	c := clock.NewMock()
+	client := NewFakeSourceClient(c)
+	client.SetTrains(sourceapi.Station_HOBOKEN,
+		NewTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, c.Now().Add(5*time.Minute), c.Now()))
+	errUnavailable := errors.New("unavailable")
+	client.Script(sourceapi.Station_NEWARK, Response{}, Response{Err: errUnavailable})
+
+	f, err := pathgtfsrt.NewFeed(context.Background(), c, 5*time.Second, client, nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	if drift := f.StaticDataDrift(); !drift.Empty() {
+		t.Errorf("StaticDataDrift() got=%+v, want no drift", drift)
+	}
+	if n := len(f.GetMessage().GetEntity()); n != 1 {
+		t.Errorf("number of entities got=%d, want=1", n)
+	}
+
+	// The second scripted response for Newark is an error, after which the station recovers.
+	for i, wantErr := range []bool{true, false} {
+		result, err := f.ForceUpdate(context.Background())
+		if err != nil {
+			t.Fatalf("ForceUpdate() err got=%v, want=<nil>", err)
+		}
+		gotErr := result.StationErrs[sourceapi.Station_NEWARK]
+		if (gotErr != nil) != wantErr || (wantErr && !errors.Is(gotErr, errUnavailable)) {
+			t.Errorf("update %d error for NEWARK got=%v, want error=%t", i, gotErr, wantErr)
+		}
+	}
+	if got := client.Requests(sourceapi.Station_NEWARK); got != 3 {
+		t.Errorf("Requests(NEWARK) got=%d, want=3", got)
+	}
+}
+
+func TestFakeSourceClientLatency(t *testing.T) {
+	c := clock.NewMock()
+	client := NewFakeSourceClient(c)
+	client.SetLatency(time.Second)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetTrainsAtStation(context.Background(), sourceapi.Station_HOBOKEN)
+		done <- err
+	}()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("GetTrainsAtStation() err got=%v, want=<nil>", err)
+			}
+			return
+		default:
+			c.Add(100 * time.Millisecond)
+		}
+	}
+}
+
+func TestFakeSourceClientStaticDataError(t *testing.T) {
+	client := NewFakeSourceClient(clock.NewMock())
+	errUnavailable := errors.New("unavailable")
+	client.SetStaticDataError(errUnavailable)
+	if _, err := client.GetStationToStopId(context.Background()); err != errUnavailable {
+		t.Errorf("GetStationToStopId() err got=%v, want=%v", err, errUnavailable)
+	}
+	client.SetStaticDataError(nil)
+	if _, err := client.GetRouteToRouteId(context.Background()); err != nil {
+		t.Errorf("GetRouteToRouteId() err got=%v, want=<nil>", err)
+	}
+}
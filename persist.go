@@ -0,0 +1,67 @@
+package pathgtfsrt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithPersistence writes the feed to the provided path after every update and, when the feed is
+// constructed, loads the feed previously written there. This lets the feed serve slightly stale
+// data immediately after a restart.
+//
+// If a feed is loaded, NewFeed returns as soon as the static data has been retrieved, without
+// waiting for the first update; the loaded feed is served until the first update completes. Errors
+// in that update are then logged rather than returned. Feeds older than maxAge, according to
+// their header timestamp, are not loaded; a maxAge of 0 loads feeds of any age.
+//
+// Unlike WithFileOutput, the full feed is written even if the feed is constructed with
+// WithDifferentialIncrementality.
+func WithPersistence(path string, maxAge time.Duration) FeedOption {
+	return func(o *feedOptions) {
+		o.persistPath = path
+		o.persistMaxAge = maxAge
+	}
+}
+
+// Loads a persisted feed as a snapshot. Returns false if there is no persisted feed, or if it is
+// too old.
+func loadPersistedSnapshot(clock clock.Clock, path string, maxAge time.Duration, log io.Writer) (snapshot, bool, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return snapshot{}, false, nil
+	}
+	if err != nil {
+		return snapshot{}, false, err
+	}
+	var msg gtfs.FeedMessage
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return snapshot{}, false, fmt.Errorf("failed to parse persisted feed %s: %w", path, err)
+	}
+	updated := time.Unix(int64(msg.GetHeader().GetTimestamp()), 0)
+	if maxAge > 0 && clock.Now().Sub(updated) > maxAge {
+		fmt.Fprintf(log, "Not loading persisted feed %s: it was built at %s, more than %s ago\n", path, updated.UTC().Format(time.RFC3339), maxAge)
+		return snapshot{}, false, nil
+	}
+	differentialMsg := buildDifferentialFeedMessage(nil, &msg)
+	differentialOut, err := proto.Marshal(differentialMsg)
+	if err != nil {
+		return snapshot{}, false, err
+	}
+	return snapshot{
+		msg:              &msg,
+		gtfs:             b,
+		differentialMsg:  differentialMsg,
+		differentialGtfs: differentialOut,
+		updated:          updated,
+		fresh:            updated,
+		restored:         true,
+	}, true, nil
+}
@@ -0,0 +1,226 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedWithPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gtfsrt.pb")
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	newClient := func() *mockSourceClient {
+		return newTestSourceClient(map[sourceapi.Station][]Train{
+			sourceapi.Station_HOBOKEN: {
+				sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			},
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, err := NewFeed(ctx, c, 5*time.Second, newClient(), func(UpdateResult) {},
+		WithPersistence(path, time.Hour))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	persisted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read persisted feed: %v", err)
+	}
+	if string(persisted) != string(f.Get()) {
+		t.Errorf("persisted feed got=%v, want=%v", persisted, f.Get())
+	}
+	cancel()
+
+	// After a restart, the persisted feed is served until the first update completes, even if the
+	// source API is failing. A new clock is used so that the previous feed does not update.
+	c = clock.NewMock()
+	c.Set(makeTime(11))
+	client := newClient()
+	delete(client.stationToTrains, sourceapi.Station_HOBOKEN)
+	getTrains := make(chan struct{})
+	client.onGetTrains = func() { <-getTrains }
+	updateSignal := make(chan UpdateResult, 1)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	f, err = NewFeed(ctx, c, 5*time.Second, client,
+		func(result UpdateResult) {
+			updateSignal <- result
+		}, WithPersistence(path, time.Hour))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	if string(f.Get()) != string(persisted) {
+		t.Errorf("feed after restart got=%v, want=%v", f.Get(), persisted)
+	}
+	close(getTrains)
+	if result := <-updateSignal; len(result.StationErrs) != 1 {
+		t.Errorf("errors in first update got=%v, want 1 error", result.StationErrs)
+	}
+	// The empty feed built by an update without data from the source API is not served.
+	if string(f.Get()) != string(persisted) {
+		t.Errorf("feed after failed update got=%v, want=%v", f.Get(), persisted)
+	}
+	select {
+	case <-f.Built():
+		t.Errorf("Built() after failed update is closed, want open")
+	default:
+	}
+	client.stationToTrains[sourceapi.Station_HOBOKEN] = []Train{}
+	c.Add(5 * time.Second)
+	<-updateSignal
+	<-f.Built()
+	if string(f.Get()) == string(persisted) {
+		t.Errorf("feed after successful update got=<persisted feed>, want new feed")
+	}
+
+	// Persisted feeds older than the maximum age are not loaded.
+	cancel()
+	delete(client.stationToTrains, sourceapi.Station_HOBOKEN)
+	c = clock.NewMock()
+	c.Set(makeTime(11).Add(2 * time.Hour))
+	_, err = NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {},
+		WithPersistence(path, time.Hour))
+	if err == nil {
+		t.Errorf("NewFeed() with stale persisted feed err got=<nil>, want error")
+	}
+}
+
+func TestVehiclePositionFeedWithPersistence(t *testing.T) {
+	dir := t.TempDir()
+	tripUpdatesPath := filepath.Join(dir, "gtfsrt.pb")
+	vehiclePositionsPath := filepath.Join(dir, "vehicle_positions.pb")
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	newClient := func() *mockSourceClient {
+		return newTestSourceClient(map[sourceapi.Station][]Train{
+			sourceapi.Station_HOBOKEN: {
+				sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			},
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tripUpdatesFeed, err := NewFeed(ctx, c, 5*time.Second, newClient(), nil,
+		WithPersistence(tripUpdatesPath, time.Hour))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	_, err = NewVehiclePositionFeed(ctx, c, tripUpdatesFeed, nil,
+		WithPersistence(vehiclePositionsPath, time.Hour))
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+	persisted, err := os.ReadFile(vehiclePositionsPath)
+	if err != nil {
+		t.Fatalf("failed to read persisted feed: %v", err)
+	}
+	cancel()
+
+	// After a restart, the persisted vehicle positions are served until the trip updates feed has
+	// been built from the source API.
+	c = clock.NewMock()
+	c.Set(makeTime(11))
+	client := newClient()
+	getTrains := make(chan struct{})
+	client.onGetTrains = func() { <-getTrains }
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	tripUpdatesFeed, err = NewFeed(ctx, c, 5*time.Second, client, nil,
+		WithPersistence(tripUpdatesPath, time.Hour))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	updateSignal := make(chan UpdateResult, 1)
+	f, err := NewVehiclePositionFeed(ctx, c, tripUpdatesFeed,
+		func(result UpdateResult) {
+			updateSignal <- result
+		}, WithPersistence(vehiclePositionsPath, time.Hour))
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+	if result := <-updateSignal; len(result.StationErrs) != 1 {
+		t.Errorf("errors in first update got=%v, want 1 error", result.StationErrs)
+	}
+	if string(f.Get()) != string(persisted) {
+		t.Errorf("feed after restart got=%v, want=%v", f.Get(), persisted)
+	}
+	if b, err := os.ReadFile(vehiclePositionsPath); err != nil || string(b) != string(persisted) {
+		t.Errorf("persisted feed after restart got=%v (err=%v), want=%v", b, err, persisted)
+	}
+	if err := f.CheckReady(time.Hour); err == nil {
+		t.Errorf("CheckReady() before the trip updates feed is built err got=<nil>, want error")
+	}
+
+	close(getTrains)
+	<-updateSignal
+	<-f.Built()
+	if err := f.CheckReady(time.Hour); err != nil {
+		t.Errorf("CheckReady() err got=%v, want=<nil>", err)
+	}
+}
+
+type publisherFunc func(ctx context.Context, feed []byte) error
+
+func (p publisherFunc) Publish(ctx context.Context, feed []byte) error {
+	return p(ctx, feed)
+}
+
+func TestVehiclePositionFeedWithPersistence_PublisherWaitsForBuild(t *testing.T) {
+	tripUpdatesPath := filepath.Join(t.TempDir(), "gtfsrt.pb")
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	newClient := func() *mockSourceClient {
+		return newTestSourceClient(map[sourceapi.Station][]Train{
+			sourceapi.Station_HOBOKEN: {
+				sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			},
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := NewFeed(ctx, c, 5*time.Second, newClient(), nil,
+		WithPersistence(tripUpdatesPath, time.Hour)); err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	cancel()
+
+	// After a restart, the vehicle positions feed, which was not persisted, is not published until
+	// it has been built.
+	client := newClient()
+	getTrains := make(chan struct{})
+	client.onGetTrains = func() { <-getTrains }
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	tripUpdatesFeed, err := NewFeed(ctx, c, 5*time.Second, client, nil,
+		WithPersistence(tripUpdatesPath, time.Hour))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	published := make(chan []byte, 10)
+	f, err := NewVehiclePositionFeed(ctx, c, tripUpdatesFeed, nil,
+		WithPublisher(publisherFunc(func(_ context.Context, feed []byte) error {
+			published <- feed
+			return nil
+		})))
+	if err != nil {
+		t.Fatalf("NewVehiclePositionFeed() err got=%v, want=<nil>", err)
+	}
+	select {
+	case feed := <-published:
+		t.Errorf("published feed before the first build got=%v, want none", feed)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(getTrains)
+	<-f.Built()
+	if feed := <-published; len(feed) == 0 || string(feed) != string(f.Get()) {
+		t.Errorf("published feed got=%v, want=%v", feed, f.Get())
+	}
+}
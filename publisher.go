@@ -0,0 +1,67 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"fmt"
+)
+
+// Publisher pushes the feed somewhere after every update, such as to an object store.
+type Publisher interface {
+	// Publish the feed, as returned by Feed.Get.
+	Publish(ctx context.Context, feed []byte) error
+}
+
+// WithPublisher publishes the feed using the provided publisher after the first update and every
+// subsequent update. Each publisher runs in its own goroutine so that a slow publisher does not
+// delay updates; if a publisher is still busy when more than one update completes, it skips to the
+// most recent one. Errors are logged and do not stop the feed.
+func WithPublisher(publisher Publisher) FeedOption {
+	return func(o *feedOptions) {
+		o.publishers = append(o.publishers, feedPublisher{publisher: publisher})
+	}
+}
+
+// WithDifferentialPublisher is like WithPublisher, but the publisher receives the feed in
+// DIFFERENTIAL mode, as returned by GetDifferential; i.e., only the entities that changed in each
+// update. This is intended for streaming consumers that process each change once.
+func WithDifferentialPublisher(publisher Publisher) FeedOption {
+	return func(o *feedOptions) {
+		o.publishers = append(o.publishers, feedPublisher{publisher: publisher, differential: true})
+	}
+}
+
+type feedPublisher struct {
+	publisher    Publisher
+	differential bool
+}
+
+// Runs the publisher until the context is cancelled.
+func (f *Feed) runPublisher(ctx context.Context, publisher feedPublisher, snapshots <-chan snapshot, cancel func()) {
+	defer cancel()
+	publish := func(s snapshot) {
+		// A derived feed may not have been built yet; e.g., while the feed it is derived from serves
+		// a persisted feed. Publishing nothing would replace the published feed with an empty one.
+		if s.gtfs == nil {
+			return
+		}
+		feed := f.feedBytes(s)
+		if publisher.differential {
+			feed = s.differentialGtfs
+		}
+		if err := publisher.publisher.Publish(ctx, feed); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(f.logOutput, "Warning: failed to publish feed: %s\n", err)
+		}
+	}
+	// A feed loaded by WithPersistence was already published before the restart.
+	if s := f.get(); !s.restored {
+		publish(s)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-snapshots:
+			publish(s)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package pathgtfsrt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/benbjohnson/clock"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Recorder writes raw responses from the source API to files in a directory, so that parsing bugs
+// can be reproduced from real data and the responses used in tests. Files are placed in a
+// subdirectory per day and named after the time the response was received and the request; e.g.,
+// <dir>/2023-02-26/20230226T101500.000Z-000001-bin_portauthority_ridepath.json.
+type Recorder struct {
+	clock   clock.Clock
+	dir     string
+	seq     uint64
+	options recorderOptions
+}
+
+// RecorderOption configures optional behavior of the recorder.
+type RecorderOption func(*recorderOptions)
+
+type recorderOptions struct {
+	logOutput io.Writer
+}
+
+// WithRecorderLogOutput makes the recorder write warnings about responses that could not be
+// recorded to the provided writer rather than to stdout.
+func WithRecorderLogOutput(w io.Writer) RecorderOption {
+	return func(o *recorderOptions) {
+		o.logOutput = w
+	}
+}
+
+// NewRecorder creates a recorder that writes files to the provided directory.
+func NewRecorder(clock clock.Clock, dir string, opts ...RecorderOption) *Recorder {
+	options := recorderOptions{logOutput: os.Stdout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Recorder{clock: clock, dir: dir, options: options}
+}
+
+// Record writes a response to a file. The name describes the request and becomes part of the file
+// name.
+func (r *Recorder) Record(name string, response []byte) error {
+	now := r.clock.Now().UTC()
+	dayDir := filepath.Join(r.dir, now.Format("2006-01-02"))
+	if err := os.MkdirAll(dayDir, 0755); err != nil {
+		return err
+	}
+	// The sequence number distinguishes responses received in the same millisecond.
+	seq := atomic.AddUint64(&r.seq, 1)
+	fileName := fmt.Sprintf("%s-%06d-%s", now.Format(archiveTimeFormat), seq, sanitizeFileName(name))
+	return writeFileAtomically(filepath.Join(dayDir, fileName), response)
+}
+
+func (r *Recorder) record(name string, response []byte) {
+	if err := r.Record(name, response); err != nil {
+		fmt.Fprintf(r.options.logOutput, "Warning: failed to record source API response: %s\n", err)
+	}
+}
+
+// HttpClient wraps an HTTP client used by a source client so that the body of every response is
+// recorded. The file is named after the request URL's path; e.g., v1_stations_hoboken_realtime.
+func (r *Recorder) HttpClient(httpClient HttpClient) HttpClient {
+	return &recordingHttpClient{recorder: r, httpClient: httpClient}
+}
+
+type recordingHttpClient struct {
+	recorder   *Recorder
+	httpClient HttpClient
+}
+
+func (c *recordingHttpClient) Get(url string) (*http.Response, error) {
+	resp, err := c.httpClient.Get(url)
+	return c.recordResponse(url, resp, err)
+}
+
+// Do is implemented so that the User-Agent is still set; see httpGet.
+func (c *recordingHttpClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := httpGetRequest(c.httpClient, req)
+	return c.recordResponse(req.URL.String(), resp, err)
+}
+
+func (c *recordingHttpClient) recordResponse(rawUrl string, resp *http.Response, err error) (*http.Response, error) {
+	if err != nil {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	name := "response"
+	if u, err := url.Parse(rawUrl); err == nil {
+		name = strings.TrimPrefix(u.Path, "/")
+	}
+	if resp.StatusCode != http.StatusOK {
+		name = fmt.Sprintf("%s-%d", name, resp.StatusCode)
+	}
+	c.recorder.record(name, body)
+	return resp, nil
+}
+
+// Sends the request using the client's Do method if it has one, and otherwise its Get method.
+func httpGetRequest(httpClient HttpClient, req *http.Request) (*http.Response, error) {
+	if doer, ok := httpClient.(interface {
+		Do(req *http.Request) (*http.Response, error)
+	}); ok {
+		return doer.Do(req)
+	}
+	return httpClient.Get(req.URL.String())
+}
+
+// GrpcDialOption returns an option for NewGrpcSourceClient that records every gRPC response,
+// along with its request, as JSON. The file is named after the method.
+func (r *Recorder) GrpcDialOption() grpc.DialOption {
+	return grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		reqMsg, reqOk := req.(proto.Message)
+		replyMsg, replyOk := reply.(proto.Message)
+		if !reqOk || !replyOk {
+			return nil
+		}
+		b, err := marshalGrpcRecording(method, reqMsg, replyMsg)
+		if err != nil {
+			fmt.Fprintf(r.options.logOutput, "Warning: failed to record source API response: %s\n", err)
+			return nil
+		}
+		r.record(path.Base(method)+".json", b)
+		return nil
+	})
+}
+
+func marshalGrpcRecording(method string, req, reply proto.Message) ([]byte, error) {
+	reqJson, err := protojson.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	replyJson, err := protojson.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(struct {
+		Method   string          `json:"method"`
+		Request  json.RawMessage `json:"request"`
+		Response json.RawMessage `json:"response"`
+	}{method, reqJson, replyJson}, "", "  ")
+}
+
+// Replaces characters that are not safe in file names.
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
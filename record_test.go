@@ -0,0 +1,62 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestRecorder_HttpClient(t *testing.T) {
+	dir := t.TempDir()
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	recorder := NewRecorder(c, dir)
+	mockHttp := MockHTTPClient{JSONFilePath: "mock_data/ridepath_01.json", Clock: c}
+	client := NewPaNyNjSourceClient(recorder.HttpClient(&mockHttp), c)
+
+	trains, err := client.GetTrainsAtStation(context.Background(), sourceapi.Station_FOURTEENTH_STREET)
+	if err != nil {
+		t.Fatalf("GetTrainsAtStation() err got=%v, want=<nil>", err)
+	}
+	if len(trains) == 0 {
+		t.Errorf("GetTrainsAtStation() got no trains, want trains")
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "2023-02-26", "20230226T101000.000Z-000001-bin_portauthority_ridepath.json"))
+	if err != nil {
+		t.Fatalf("failed to read recorded response: %v", err)
+	}
+	want, _ := os.ReadFile("mock_data/ridepath_01.json")
+	if string(got) != string(want) {
+		t.Errorf("recorded response got=%s, want=%s", got, want)
+	}
+}
+
+func TestRecorder_HttpClientSetsUserAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("User-Agent")))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	recorder := NewRecorder(clock.NewMock(), dir)
+
+	resp, err := httpGet(context.Background(), recorder.HttpClient(server.Client()), server.URL+"/v1/routes", "agent")
+	if err != nil {
+		t.Fatalf("httpGet() err got=%v, want=<nil>", err)
+	}
+	resp.Body.Close()
+
+	got, err := os.ReadFile(filepath.Join(dir, "1970-01-01", "19700101T000000.000Z-000001-v1_routes"))
+	if err != nil {
+		t.Fatalf("failed to read recorded response: %v", err)
+	}
+	if string(got) != "agent" {
+		t.Errorf("recorded User-Agent got=%s, want=agent", got)
+	}
+}
@@ -0,0 +1,319 @@
+package pathgtfsrt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// A minimal Redis client that speaks the RESP protocol over plain TCP and supports the commands
+// needed to share feeds between replicas. The connection is opened on the first command and
+// reopened on the next command if it fails.
+type redisClient struct {
+	address  string
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Returned by command when the reply is a nil bulk string; e.g., when GET finds no key.
+var errRedisNil = errors.New("redis: nil")
+
+// Parses a URL of the form redis://[[username]:password@]host[:port][/db].
+func newRedisClient(redisURL string, timeout time.Duration) (*redisClient, error) {
+	if !strings.Contains(redisURL, "://") {
+		redisURL = "redis://" + redisURL
+	}
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL %q: %w", redisURL, err)
+	}
+	if u.Scheme == "rediss" {
+		return nil, fmt.Errorf("unsupported Redis URL scheme %q: TLS is not supported", u.Scheme)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported Redis URL scheme %q", u.Scheme)
+	}
+	c := &redisClient{address: u.Host, timeout: timeout}
+	if u.Port() == "" {
+		c.address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// Runs a command and returns its reply, which is a string for simple and bulk string replies and
+// an int64 for integer replies.
+func (c *redisClient) command(ctx context.Context, args ...string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(ctx, args)
+	var redisErr redisError
+	if err != nil && err != errRedisNil && !errors.As(err, &redisErr) {
+		c.close()
+	}
+	return reply, err
+}
+
+func (c *redisClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.close()
+}
+
+func (c *redisClient) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	c.reader = nil
+	return err
+}
+
+func (c *redisClient) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	conn, err := dialer.DialContext(dialCtx, "tcp", c.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Redis server %s: %w", c.address, err)
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, err := c.roundTrip(ctx, args); err != nil {
+			c.close()
+			return fmt.Errorf("failed to connect to Redis server %s: %s failed: %w", c.address, args[0], err)
+		}
+	}
+	return nil
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (c *redisClient) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	c.conn.SetDeadline(deadline(ctx, c.timeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisClient) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk string length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	default:
+		return nil, fmt.Errorf("redis: unsupported reply %q", line)
+	}
+}
+
+// RedisPublisher is a publisher that stores the feed under a key in Redis, so that replicas
+// created with NewRedisFeed can serve it without each polling the source API.
+type RedisPublisher struct {
+	client *redisClient
+	key    string
+	ttl    time.Duration
+}
+
+// NewRedisPublisher creates a publisher that stores the feed under the provided key on the Redis
+// server at the provided URL, of the form redis://[[username]:password@]host[:port][/db]. If the
+// TTL is positive the key expires after the TTL, so that replicas stop serving the feed if this
+// instance stops updating it. TLS connections are not supported.
+func NewRedisPublisher(redisURL, key string, ttl, timeout time.Duration) (*RedisPublisher, error) {
+	client, err := newRedisClient(redisURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisPublisher{client: client, key: key, ttl: ttl}, nil
+}
+
+// Publish stores the feed.
+func (p *RedisPublisher) Publish(ctx context.Context, feed []byte) error {
+	args := []string{"SET", p.key, string(feed)}
+	if p.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(p.ttl.Milliseconds(), 10))
+	}
+	if _, err := p.client.command(ctx, args...); err != nil {
+		return fmt.Errorf("failed to store feed in Redis key %s: %w", p.key, err)
+	}
+	return nil
+}
+
+// Close closes the connection to the Redis server, if open.
+func (p *RedisPublisher) Close() error {
+	return p.client.Close()
+}
+
+// RedisFeed serves a feed stored in Redis by a RedisPublisher. It polls Redis for the feed
+// periodically, rather than on each request, so the load on Redis does not depend on traffic.
+type RedisFeed struct {
+	client       *redisClient
+	key          string
+	updatePeriod time.Duration
+
+	mutex sync.RWMutex
+	feed  []byte
+}
+
+// RedisFeedOption configures optional behavior of a RedisFeed.
+type RedisFeedOption func(*redisFeedOptions)
+
+type redisFeedOptions struct {
+	logOutput io.Writer
+}
+
+// WithRedisFeedLogOutput makes the feed write warnings about failures to read the feed to the
+// provided writer rather than to stdout.
+func WithRedisFeedLogOutput(w io.Writer) RedisFeedOption {
+	return func(o *redisFeedOptions) {
+		o.logOutput = w
+	}
+}
+
+// NewRedisFeed creates a feed that serves the feed stored under the provided key on the Redis
+// server at the provided URL; see NewRedisPublisher. The feed is read before this function returns,
+// and then in the background following the provided update period until the context is cancelled.
+// Errors reading the feed in the background are logged, and the previous feed continues to be
+// served, unless the key no longer exists.
+func NewRedisFeed(ctx context.Context, clock clock.Clock, redisURL, key string, updatePeriod, timeout time.Duration, opts ...RedisFeedOption) (*RedisFeed, error) {
+	options := redisFeedOptions{logOutput: os.Stdout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	client, err := newRedisClient(redisURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	f := &RedisFeed{client: client, key: key, updatePeriod: updatePeriod}
+	if err := f.update(ctx); err != nil {
+		return nil, err
+	}
+	ticker := clock.Ticker(updatePeriod)
+	go func() {
+		defer ticker.Stop()
+		defer client.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := f.update(ctx); err != nil && ctx.Err() == nil {
+					fmt.Fprintf(options.logOutput, "Warning: failed to read feed from Redis key %s: %s\n", key, err)
+				}
+			}
+		}
+	}()
+	return f, nil
+}
+
+func (f *RedisFeed) update(ctx context.Context) error {
+	reply, err := f.client.command(ctx, "GET", f.key)
+	var feed []byte
+	if err == nil {
+		s, ok := reply.(string)
+		if !ok {
+			return fmt.Errorf("unexpected reply %v", reply)
+		}
+		// An empty value is not a feed, and is treated like a missing key.
+		if s != "" {
+			feed = []byte(s)
+		}
+	} else if err != errRedisNil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.feed = feed
+	return nil
+}
+
+// Get returns the most recent feed read from Redis, or nil if the key does not exist or is empty.
+func (f *RedisFeed) Get() []byte {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.feed
+}
+
+// ServeHTTP responds to all requests with the most recent feed read from Redis, in the same way as
+// Feed.ServeHTTP. If the key does not exist or is empty, it responds with 503 Service Unavailable.
+func (f *RedisFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveFeedBytes(w, r, f.Get(), f.updatePeriod)
+}
@@ -0,0 +1,205 @@
+package pathgtfsrt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+)
+
+// A fake Redis server that supports AUTH, SELECT, SET, GET and the EVAL scripts of the leader
+// elector, and records the commands it receives. Keys do not expire.
+type fakeRedisServer struct {
+	mutex    sync.Mutex
+	values   map[string]string
+	commands [][]string
+	// If set, the error that all commands fail with.
+	errReply string
+}
+
+func runFakeRedisServer(t *testing.T) (string, *fakeRedisServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &fakeRedisServer{values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return listener.Addr().String(), s
+}
+
+func (s *fakeRedisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		var n int
+		if _, err := fmt.Fscanf(reader, "*%d\r\n", &n); err != nil {
+			return
+		}
+		args := make([]string, n)
+		for i := range args {
+			var length int
+			if _, err := fmt.Fscanf(reader, "$%d\r\n", &length); err != nil {
+				return
+			}
+			buf := make([]byte, length+2)
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:length])
+		}
+		s.mutex.Lock()
+		s.commands = append(s.commands, args)
+		if s.errReply != "" {
+			fmt.Fprintf(conn, "-%s\r\n", s.errReply)
+			s.mutex.Unlock()
+			continue
+		}
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if args[len(args)-1] == "secret" {
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid username-password pair\r\n")
+			}
+		case "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "SET":
+			if _, ok := s.values[args[1]]; ok && len(args) > 3 && args[3] == "NX" {
+				fmt.Fprint(conn, "$-1\r\n")
+				break
+			}
+			s.values[args[1]] = args[2]
+			fmt.Fprint(conn, "+OK\r\n")
+		case "EVAL":
+			// Only the leader lease scripts are supported: they renew or release the key if it has
+			// the provided value.
+			if s.values[args[3]] != args[4] {
+				fmt.Fprint(conn, ":0\r\n")
+				break
+			}
+			if strings.Contains(args[1], "del") {
+				delete(s.values, args[3])
+			}
+			fmt.Fprint(conn, ":1\r\n")
+		case "GET":
+			if value, ok := s.values[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func TestRedisPublisherAndFeed(t *testing.T) {
+	address, server := runFakeRedisServer(t)
+	redisURL := "redis://:secret@" + address + "/2"
+	publisher, err := NewRedisPublisher(redisURL, "pathgtfsrt:gtfsrt", time.Minute, time.Second)
+	if err != nil {
+		t.Fatalf("NewRedisPublisher() err got=%v, want=<nil>", err)
+	}
+	defer publisher.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := clock.NewMock()
+	f, err := NewRedisFeed(ctx, c, redisURL, "pathgtfsrt:gtfsrt", 5*time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("NewRedisFeed() err got=%v, want=<nil>", err)
+	}
+
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code before publishing got=%d, want=%d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	// An empty value is treated like a missing key.
+	server.mutex.Lock()
+	server.values["pathgtfsrt:gtfsrt"] = ""
+	server.mutex.Unlock()
+	if err := f.update(context.Background()); err != nil {
+		t.Fatalf("update() err got=%v, want=<nil>", err)
+	}
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code for an empty value got=%d, want=%d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	// The feed contains bytes that are not valid in RESP simple strings.
+	feed := "\r\nfeed\x00"
+	if err := publisher.Publish(context.Background(), []byte(feed)); err != nil {
+		t.Fatalf("Publish() err got=%v, want=<nil>", err)
+	}
+	if err := f.update(context.Background()); err != nil {
+		t.Fatalf("update() err got=%v, want=<nil>", err)
+	}
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt", nil))
+	if got := w.Body.String(); got != feed {
+		t.Errorf("feed got=%q, want=%q", got, feed)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	wantSet := []string{"SET", "pathgtfsrt:gtfsrt", feed, "PX", strconv.Itoa(60000)}
+	var gotSet []string
+	for _, command := range server.commands {
+		if command[0] == "SET" {
+			gotSet = command
+		}
+	}
+	if diff := cmp.Diff(wantSet, gotSet); diff != "" {
+		t.Errorf("SET command got != want, diff=%s", diff)
+	}
+	wantFirstCommands := [][]string{{"AUTH", "secret"}, {"SELECT", "2"}}
+	if diff := cmp.Diff(wantFirstCommands, server.commands[:2]); diff != "" {
+		t.Errorf("connection set up got != want, diff=%s", diff)
+	}
+}
+
+func TestRedisPublisher_AuthError(t *testing.T) {
+	address, _ := runFakeRedisServer(t)
+	publisher, err := NewRedisPublisher("redis://:wrong@"+address, "key", 0, time.Second)
+	if err != nil {
+		t.Fatalf("NewRedisPublisher() err got=%v, want=<nil>", err)
+	}
+	defer publisher.Close()
+
+	err = publisher.Publish(context.Background(), []byte("feed"))
+
+	if err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Publish() err got=%v, want WRONGPASS error", err)
+	}
+}
+
+func TestNewRedisPublisher_UnsupportedURL(t *testing.T) {
+	for _, redisURL := range []string{"rediss://localhost:6380", "http://localhost:6379"} {
+		if _, err := NewRedisPublisher(redisURL, "key", 0, time.Second); err == nil {
+			t.Errorf("NewRedisPublisher(%q) err got=<nil>, want error", redisURL)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package pathgtfsrt
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// ReplayFeed serves archived versions of a feed as if they were being generated live, for testing
+// downstream consumers against historical data. Replay starts when the ReplayFeed is created: each
+// archived feed is served from the time it was originally archived, relative to the first feed.
+type ReplayFeed struct {
+	clock   clock.Clock
+	start   time.Time
+	feeds   []ArchivedFeed
+	options replayOptions
+}
+
+// ReplayOption configures optional behavior of the replay feed.
+type ReplayOption func(*replayOptions)
+
+type replayOptions struct {
+	speed float64
+	loop  bool
+}
+
+// WithReplaySpeed replays the feeds faster or slower than they were originally generated; e.g., a
+// speed of 2 replays an hour of archived feeds in 30 minutes. The default speed is 1.
+func WithReplaySpeed(speed float64) ReplayOption {
+	return func(o *replayOptions) {
+		o.speed = speed
+	}
+}
+
+// WithReplayLoop restarts the replay from the first feed once the last feed has been served for
+// the interval between the last two feeds. By default the last feed is served indefinitely.
+func WithReplayLoop() ReplayOption {
+	return func(o *replayOptions) {
+		o.loop = true
+	}
+}
+
+// NewReplayFeed creates a feed that replays the provided archived feeds.
+func NewReplayFeed(clock clock.Clock, feeds []ArchivedFeed, opts ...ReplayOption) (*ReplayFeed, error) {
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("no archived feeds to replay")
+	}
+	options := replayOptions{speed: 1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.speed <= 0 {
+		return nil, fmt.Errorf("replay speed must be positive, got %v", options.speed)
+	}
+	feeds = append([]ArchivedFeed{}, feeds...)
+	sort.SliceStable(feeds, func(i, j int) bool {
+		return feeds[i].Time.Before(feeds[j].Time)
+	})
+	return &ReplayFeed{clock: clock, start: clock.Now(), feeds: feeds, options: options}, nil
+}
+
+// Get returns the archived feed that is currently being replayed.
+func (f *ReplayFeed) Get() []byte {
+	return f.Current().Feed
+}
+
+// Current returns the archived feed that is currently being replayed, including the time it was
+// originally archived.
+func (f *ReplayFeed) Current() ArchivedFeed {
+	first, last := f.feeds[0].Time, f.feeds[len(f.feeds)-1].Time
+	elapsed := time.Duration(float64(f.clock.Now().Sub(f.start)) * f.options.speed)
+	if f.options.loop && len(f.feeds) > 1 {
+		length := last.Sub(first) + last.Sub(f.feeds[len(f.feeds)-2].Time)
+		if length > 0 {
+			elapsed %= length
+		}
+	}
+	i := sort.Search(len(f.feeds), func(i int) bool {
+		return f.feeds[i].Time.Sub(first) > elapsed
+	})
+	return f.feeds[i-1]
+}
+
+// ServeHTTP responds to all requests with the archived feed that is currently being replayed. As
+// with Feed, the feed is rendered as JSON if requested using the Accept header or the format=json
+// query parameter.
+func (f *ReplayFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current := f.Current()
+	w.Header().Set("X-Replay-Archived-Time", current.Time.UTC().Format(time.RFC3339))
+	serveFeedBytes(w, r, current.Feed, 0)
+}
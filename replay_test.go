@@ -0,0 +1,70 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+func TestReplayFeed(t *testing.T) {
+	dir := t.TempDir()
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	archiver := NewArchiver(c, dir, "gtfsrt")
+	for _, feed := range []string{"feed1", "feed2", "feed3"} {
+		if err := archiver.Publish(context.Background(), []byte(feed)); err != nil {
+			t.Fatalf("Publish() err got=%v, want=<nil>", err)
+		}
+		c.Add(10 * time.Second)
+	}
+	feeds, err := LoadArchive(dir, "gtfsrt")
+	if err != nil {
+		t.Fatalf("LoadArchive() err got=%v, want=<nil>", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		opts    []ReplayOption
+		elapsed []time.Duration
+		want    []string
+	}{
+		{
+			name:    "real time",
+			elapsed: []time.Duration{0, 9 * time.Second, 10 * time.Second, 25 * time.Second, time.Hour},
+			want:    []string{"feed1", "feed1", "feed2", "feed3", "feed3"},
+		},
+		{
+			name:    "double speed",
+			opts:    []ReplayOption{WithReplaySpeed(2)},
+			elapsed: []time.Duration{0, 5 * time.Second, 10 * time.Second, time.Hour},
+			want:    []string{"feed1", "feed2", "feed3", "feed3"},
+		},
+		{
+			name:    "loop",
+			opts:    []ReplayOption{WithReplayLoop()},
+			elapsed: []time.Duration{20 * time.Second, 30 * time.Second, 40 * time.Second},
+			want:    []string{"feed3", "feed1", "feed2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := clock.NewMock()
+			f, err := NewReplayFeed(c, feeds, tc.opts...)
+			if err != nil {
+				t.Fatalf("NewReplayFeed() err got=%v, want=<nil>", err)
+			}
+			for i, elapsed := range tc.elapsed {
+				c.Set(time.Unix(0, 0).Add(elapsed))
+
+				w := httptest.NewRecorder()
+				f.ServeHTTP(w, httptest.NewRequest("GET", "/gtfsrt", nil))
+
+				if got := w.Body.String(); got != tc.want[i] {
+					t.Errorf("feed after %s got=%s, want=%s", elapsed, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIdHeader is the HTTP header that carries request IDs, both on requests to the HTTP source
+// APIs and on requests to and responses from the HTTP server. In gRPC metadata the key is in lower
+// case.
+const RequestIdHeader = "X-Request-Id"
+
+type requestIdKey struct{}
+
+// NewRequestId returns a new random request ID.
+func NewRequestId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ContextWithRequestId returns a context carrying the provided request ID. Source clients send the
+// request ID of the context with each request to the source API, so that a request can be traced
+// to the update or inbound HTTP request that caused it.
+func ContextWithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestIdFromContext returns the request ID carried by the context, or the empty string if there
+// is none.
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// A gRPC interceptor that adds the request ID of the context to the outgoing metadata.
+func requestIdUnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if requestId := RequestIdFromContext(ctx); requestId != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, RequestIdHeader, requestId)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
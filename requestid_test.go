@@ -0,0 +1,38 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIdFromContext(t *testing.T) {
+	if got := RequestIdFromContext(context.Background()); got != "" {
+		t.Errorf("RequestIdFromContext() without request ID got=%q, want=%q", got, "")
+	}
+	requestId := NewRequestId()
+	if got := RequestIdFromContext(ContextWithRequestId(context.Background(), requestId)); got != requestId {
+		t.Errorf("RequestIdFromContext() got=%q, want=%q", got, requestId)
+	}
+	if other := NewRequestId(); other == requestId {
+		t.Errorf("NewRequestId() returned %q twice", requestId)
+	}
+}
+
+func TestRequestIdUnaryClientInterceptor(t *testing.T) {
+	var got []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		got = md.Get("x-request-id")
+		return nil
+	}
+	ctx := ContextWithRequestId(context.Background(), "abc123")
+	if err := requestIdUnaryClientInterceptor(ctx, "/Stations/GetUpcomingTrains", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("requestIdUnaryClientInterceptor() err got=%v, want=<nil>", err)
+	}
+	if len(got) != 1 || got[0] != "abc123" {
+		t.Errorf("x-request-id metadata got=%v, want=[abc123]", got)
+	}
+}
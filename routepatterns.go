@@ -0,0 +1,119 @@
+package pathgtfsrt
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+)
+
+// RoutePattern is the sequence of stations that trains on a route visit when traveling in one
+// direction, along with the travel time from the first station to each station.
+//
+// Route and stop IDs are GTFS IDs, as in the feed.
+type RoutePattern struct {
+	RouteId     string        `json:"route_id"`
+	DirectionId uint32        `json:"direction_id"`
+	Stops       []PatternStop `json:"stops"`
+}
+
+// PatternStop is a station in a route pattern.
+type PatternStop struct {
+	StopId string `json:"stop_id"`
+	// OffsetSeconds is the travel time in seconds from the first station in the pattern.
+	OffsetSeconds int64 `json:"offset_seconds"`
+}
+
+type routePatternKey struct {
+	routeId     string
+	directionId uint32
+}
+
+// LoadRoutePatterns reads route patterns from a JSON array; for example:
+//
+//	[
+//	  {
+//	    "route_id": "859",
+//	    "direction_id": 1,
+//	    "stops": [
+//	      {"stop_id": "26730", "offset_seconds": 0},
+//	      {"stop_id": "26726", "offset_seconds": 480}
+//	    ]
+//	  }
+//	]
+func LoadRoutePatterns(r io.Reader) ([]RoutePattern, error) {
+	var patterns []RoutePattern
+	if err := json.NewDecoder(r).Decode(&patterns); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// RoutePatterns derives route patterns from the static schedule. For each route and direction,
+// the pattern is given by the scheduled trip that visits the most stations.
+func (s *StaticSchedule) RoutePatterns() []RoutePattern {
+	type tripStop struct {
+		stopId  string
+		arrival time.Duration
+	}
+	tripToKey := map[string]routePatternKey{}
+	tripToStops := map[string][]tripStop{}
+	for stopId, stopTimes := range s.stationToStopTimes {
+		for _, stopTime := range stopTimes {
+			tripToKey[stopTime.tripId] = routePatternKey{routeId: stopTime.routeId, directionId: stopTime.directionId}
+			tripToStops[stopTime.tripId] = append(tripToStops[stopTime.tripId], tripStop{stopId: stopId, arrival: stopTime.arrival})
+		}
+	}
+	keyToTripId := map[routePatternKey]string{}
+	for tripId, key := range tripToKey {
+		bestTripId, ok := keyToTripId[key]
+		if !ok || len(tripToStops[tripId]) > len(tripToStops[bestTripId]) ||
+			(len(tripToStops[tripId]) == len(tripToStops[bestTripId]) && tripId < bestTripId) {
+			keyToTripId[key] = tripId
+		}
+	}
+	var patterns []RoutePattern
+	for key, tripId := range keyToTripId {
+		stops := tripToStops[tripId]
+		sort.Slice(stops, func(i, j int) bool { return stops[i].arrival < stops[j].arrival })
+		pattern := RoutePattern{RouteId: key.routeId, DirectionId: key.directionId}
+		for _, stop := range stops {
+			pattern.Stops = append(pattern.Stops, PatternStop{
+				StopId:        stop.stopId,
+				OffsetSeconds: int64((stop.arrival - stops[0].arrival).Seconds()),
+			})
+		}
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].RouteId != patterns[j].RouteId {
+			return patterns[i].RouteId < patterns[j].RouteId
+		}
+		return patterns[i].DirectionId < patterns[j].DirectionId
+	})
+	return patterns
+}
+
+// Build predicted stop time updates for the stations after the provided station in the route
+// pattern, based on the projected arrival at the provided station.
+func buildDownstreamStopTimeUpdates(patterns map[routePatternKey][]PatternStop, routeId string, directionId uint32, stationStopId string, arrival int64) []*gtfs.TripUpdate_StopTimeUpdate {
+	stops := patterns[routePatternKey{routeId: routeId, directionId: directionId}]
+	var updates []*gtfs.TripUpdate_StopTimeUpdate
+	for i, stop := range stops {
+		if stop.StopId != stationStopId {
+			continue
+		}
+		for _, downstreamStop := range stops[i+1:] {
+			updates = append(updates, &gtfs.TripUpdate_StopTimeUpdate{
+				StopId: ptr(downstreamStop.StopId),
+				Arrival: &gtfs.TripUpdate_StopTimeEvent{
+					Time: ptr(arrival + downstreamStop.OffsetSeconds - stop.OffsetSeconds),
+				},
+			})
+		}
+		break
+	}
+	return updates
+}
@@ -0,0 +1,109 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestFeedWithRoutePatterns(t *testing.T) {
+	patterns, err := LoadRoutePatterns(strings.NewReader(`[
+		{
+			"route_id": "routeID1",
+			"direction_id": 1,
+			"stops": [
+				{"stop_id": "stopID3", "offset_seconds": 0},
+				{"stop_id": "stopID2", "offset_seconds": 120},
+				{"stop_id": "stopID1", "offset_seconds": 600}
+			]
+		}
+	]`))
+	if err != nil {
+		t.Fatalf("LoadRoutePatterns() err got=%v, want=<nil>", err)
+	}
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 15, 10),
+		},
+	})
+	var gotMsg *gtfsrt.FeedMessage
+	_, err = NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		}, WithRoutePatterns(patterns))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	withDownstream := wantFeedEntity(routeID1, 1, stopIDHoboken, 15, 10)
+	withDownstream.TripUpdate.StopTimeUpdate = append(withDownstream.TripUpdate.StopTimeUpdate,
+		&gtfsrt.TripUpdate_StopTimeUpdate{
+			StopId: ptr(stopID14St),
+			Arrival: &gtfsrt.TripUpdate_StopTimeEvent{
+				Time: makeUnix(23),
+			},
+		})
+	wantEntities := []*gtfsrt.FeedEntity{
+		withDownstream,
+		// There is no route pattern for this direction.
+		wantFeedEntity(routeID1, 0, stopIDHoboken, 15, 10),
+	}
+	if diff := cmp.Diff(wantEntities, gotMsg.GetEntity(), protocmp.Transform(),
+		protocmp.IgnoreFields(&gtfsrt.FeedEntity{}, "id"),
+		protocmp.IgnoreFields(&gtfsrt.TripDescriptor{}, "trip_id")); diff != "" {
+		t.Errorf("entities got != want, diff=%s", diff)
+	}
+}
+
+func TestStaticScheduleRoutePatterns(t *testing.T) {
+	schedule := loadTestStaticSchedule(t, map[string]string{
+		"stops.txt": "stop_id,stop_name,parent_station\n" +
+			"stopID1,14th Street,\n" +
+			"stopID2,Hoboken,\n" +
+			"platform,Hoboken Platform 1,stopID2\n",
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"DAILY,1,1,1,1,1,1,1,20230101,20231231\n",
+		"trips.txt": "route_id,service_id,trip_id,direction_id\n" +
+			"routeID1,DAILY,short,1\n" +
+			"routeID1,DAILY,long,1\n" +
+			"routeID1,DAILY,reverse,0\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"short,05:00:00,05:00:00,stopID2,1\n" +
+			"long,24:58:00,24:58:00,stopID3,1\n" +
+			"long,25:00:00,25:00:00,platform,2\n" +
+			"long,25:08:00,25:08:00,stopID1,3\n" +
+			"reverse,06:00:00,06:00:00,stopID1,1\n" +
+			"reverse,06:08:00,06:08:00,stopID2,2\n",
+	})
+
+	want := []RoutePattern{
+		{
+			RouteId:     routeID1,
+			DirectionId: 0,
+			Stops: []PatternStop{
+				{StopId: stopID14St, OffsetSeconds: 0},
+				{StopId: stopIDHoboken, OffsetSeconds: 480},
+			},
+		},
+		{
+			RouteId:     routeID1,
+			DirectionId: 1,
+			Stops: []PatternStop{
+				{StopId: "stopID3", OffsetSeconds: 0},
+				{StopId: stopIDHoboken, OffsetSeconds: 120},
+				{StopId: stopID14St, OffsetSeconds: 600},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, schedule.RoutePatterns()); diff != "" {
+		t.Errorf("RoutePatterns() got != want, diff=%s", diff)
+	}
+}
@@ -0,0 +1,194 @@
+package pathgtfsrt
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// S3Publisher is a publisher that uploads the feed to a bucket in an S3-compatible object store,
+// such as Amazon S3 or Google Cloud Storage using its XML API and HMAC keys. Requests are signed
+// using AWS Signature Version 4 and use path-style URLs; i.e., <endpoint>/<bucket>/<key>.
+type S3Publisher struct {
+	httpClient      *http.Client
+	clock           clock.Clock
+	endpoint        string
+	bucket          string
+	key             string
+	accessKeyId     string
+	secretAccessKey string
+	options         s3PublisherOptions
+}
+
+// S3PublisherOption configures optional behavior of the S3 publisher.
+type S3PublisherOption func(*s3PublisherOptions)
+
+type s3PublisherOptions struct {
+	region       string
+	contentType  string
+	cacheControl string
+}
+
+// WithS3Region sets the region used to sign requests. The default is us-east-1. Google Cloud
+// Storage accepts the region auto.
+func WithS3Region(region string) S3PublisherOption {
+	return func(o *s3PublisherOptions) {
+		o.region = region
+	}
+}
+
+// WithS3ContentType sets the Content-Type of the uploaded object. The default is
+// application/x-protobuf.
+func WithS3ContentType(contentType string) S3PublisherOption {
+	return func(o *s3PublisherOptions) {
+		o.contentType = contentType
+	}
+}
+
+// WithS3CacheControl sets the Cache-Control of the uploaded object, which CDNs in front of the
+// bucket use to decide how long to cache the feed. By default it is not set.
+func WithS3CacheControl(cacheControl string) S3PublisherOption {
+	return func(o *s3PublisherOptions) {
+		o.cacheControl = cacheControl
+	}
+}
+
+// NewS3Publisher creates a publisher that uploads the feed to the provided bucket and key. The
+// endpoint is the base URL of the object store; e.g., https://s3.us-east-1.amazonaws.com or
+// https://storage.googleapis.com.
+func NewS3Publisher(httpClient *http.Client, clock clock.Clock, endpoint, bucket, key, accessKeyId, secretAccessKey string, opts ...S3PublisherOption) *S3Publisher {
+	options := s3PublisherOptions{region: "us-east-1", contentType: "application/x-protobuf"}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &S3Publisher{
+		httpClient:      httpClient,
+		clock:           clock,
+		endpoint:        strings.TrimSuffix(endpoint, "/"),
+		bucket:          bucket,
+		key:             strings.TrimPrefix(key, "/"),
+		accessKeyId:     accessKeyId,
+		secretAccessKey: secretAccessKey,
+		options:         options,
+	}
+}
+
+// Publish uploads the feed.
+func (p *S3Publisher) Publish(ctx context.Context, feed []byte) error {
+	req, err := p.newRequest(ctx, feed)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s uploading to %s: %s", resp.Status, req.URL, body)
+	}
+	return nil
+}
+
+// Builds a signed PUT request for the object.
+func (p *S3Publisher) newRequest(ctx context.Context, feed []byte) (*http.Request, error) {
+	path := "/" + s3EscapePath(p.bucket) + "/" + s3EscapePath(p.key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.endpoint+path, bytes.NewReader(feed))
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := sha256.Sum256(feed)
+	now := p.clock.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	headers := map[string]string{
+		"content-type":         p.options.contentType,
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": hex.EncodeToString(payloadHash[:]),
+		"x-amz-date":           amzDate,
+	}
+	if p.options.cacheControl != "" {
+		headers["cache-control"] = p.options.cacheControl
+	}
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	scope := date + "/" + p.options.region + "/s3/aws4_request"
+	signedHeaders, signature := signatureV4(p.secretAccessKey, p.options.region, "s3", now, http.MethodPut, path, headers)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKeyId, scope, signedHeaders, signature))
+	return req, nil
+}
+
+// Computes an AWS Signature Version 4 signature for a request without a query string. The headers
+// must have lowercase names and include the host and x-amz-date headers; the payload hash is the
+// x-amz-content-sha256 header if present, and otherwise the hash of an empty payload.
+func signatureV4(secretAccessKey, region, service string, t time.Time, method, path string, headers map[string]string) (signedHeaders, signature string) {
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+	payloadHash, ok := headers["x-amz-content-sha256"]
+	if !ok {
+		emptyHash := sha256.Sum256(nil)
+		payloadHash = hex.EncodeToString(emptyHash[:])
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	date := t.UTC().Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.UTC().Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+	signingKey := hmacSha256([]byte("AWS4"+secretAccessKey), date)
+	signingKey = hmacSha256(signingKey, region)
+	signingKey = hmacSha256(signingKey, service)
+	signingKey = hmacSha256(signingKey, "aws4_request")
+	return signedHeaders, hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Escapes each segment of an object path as required by Signature Version 4: every byte except
+// the unreserved characters is percent-encoded.
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || c == '-' || c == '.' || c == '_' || c == '~' ||
+			(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestSignatureV4(t *testing.T) {
+	// The get-vanilla case from the AWS Signature Version 4 test suite.
+	signedHeaders, signature := signatureV4("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC), http.MethodGet, "/",
+		map[string]string{
+			"host":       "example.amazonaws.com",
+			"x-amz-date": "20150830T123600Z",
+		})
+
+	if want := "host;x-amz-date"; signedHeaders != want {
+		t.Errorf("signed headers got=%s, want=%s", signedHeaders, want)
+	}
+	if want := "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"; signature != want {
+		t.Errorf("signature got=%s, want=%s", signature, want)
+	}
+}
+
+func TestFeedWithS3Publisher(t *testing.T) {
+	type upload struct {
+		path          string
+		contentType   string
+		authorization string
+		body          []byte
+	}
+	uploads := make(chan upload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("method got=%s, want=%s", r.Method, http.MethodPut)
+		}
+		body, _ := io.ReadAll(r.Body)
+		uploads <- upload{
+			path:          r.URL.EscapedPath(),
+			contentType:   r.Header.Get("Content-Type"),
+			authorization: r.Header.Get("Authorization"),
+			body:          body,
+		}
+	}))
+	defer server.Close()
+
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	publisher := NewS3Publisher(server.Client(), c, server.URL+"/", "bucket", "feeds/path gtfsrt", "AKID", "secret",
+		WithS3Region("auto"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, err := NewFeed(ctx, c, 5*time.Second, client, func(UpdateResult) {}, WithPublisher(publisher))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	got := <-uploads
+	if want := "/bucket/feeds/path%20gtfsrt"; got.path != want {
+		t.Errorf("path got=%s, want=%s", got.path, want)
+	}
+	if want := "application/x-protobuf"; got.contentType != want {
+		t.Errorf("Content-Type got=%s, want=%s", got.contentType, want)
+	}
+	wantAuthorizationPrefix := "AWS4-HMAC-SHA256 Credential=AKID/20230226/auto/s3/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(got.authorization, wantAuthorizationPrefix) {
+		t.Errorf("Authorization got=%s, want prefix=%s", got.authorization, wantAuthorizationPrefix)
+	}
+	if string(got.body) != string(f.Get()) {
+		t.Errorf("body got=%v, want=%v", got.body, f.Get())
+	}
+}
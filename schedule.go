@@ -0,0 +1,268 @@
+package pathgtfsrt
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The maximum difference between the projected arrival of a train and the scheduled arrival of
+// a trip for the two to be matched.
+const scheduleMatchTolerance = 10 * time.Minute
+
+// StaticSchedule is a static GTFS schedule that realtime arrivals can be matched against.
+type StaticSchedule struct {
+	location *time.Location
+	// Scheduled stop times keyed by the stop ID of the station. Stop times at platforms are keyed
+	// by the stop ID of the parent station.
+	stationToStopTimes map[string][]scheduledStopTime
+	services           map[string]*scheduledService
+}
+
+type scheduledStopTime struct {
+	tripId      string
+	routeId     string
+	directionId uint32
+	serviceId   string
+	// Time since noon minus 12 hours on the service date, as defined in the GTFS spec.
+	arrival time.Duration
+}
+
+type scheduledService struct {
+	weekdays  [7]bool
+	startDate string
+	endDate   string
+	added     map[string]bool
+	removed   map[string]bool
+}
+
+// The result of matching a realtime arrival against the static schedule.
+type scheduledTripMatch struct {
+	tripId    string
+	startDate string
+	arrival   time.Time
+}
+
+// LoadStaticSchedule reads a static GTFS zip. The zip must contain trips.txt and stop_times.txt.
+// Service dates are read from calendar.txt and calendar_dates.txt. If present, agency.txt is used
+// to determine the timezone of the schedule, and stops.txt is used to match stop times at
+// platforms to stations.
+func LoadStaticSchedule(r io.ReaderAt, size int64) (*StaticSchedule, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	s := &StaticSchedule{
+		location:           time.UTC,
+		stationToStopTimes: map[string][]scheduledStopTime{},
+		services:           map[string]*scheduledService{},
+	}
+	err = readGtfsFile(z, "agency.txt", false, func(row gtfsRow) error {
+		location, err := time.LoadLocation(row.get("agency_timezone"))
+		if err != nil {
+			return err
+		}
+		s.location = location
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stopToStation := map[string]string{}
+	err = readGtfsFile(z, "stops.txt", false, func(row gtfsRow) error {
+		if parent := row.get("parent_station"); parent != "" {
+			stopToStation[row.get("stop_id")] = parent
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	trips := map[string]scheduledStopTime{}
+	err = readGtfsFile(z, "trips.txt", true, func(row gtfsRow) error {
+		directionId, _ := strconv.ParseUint(row.get("direction_id"), 10, 32)
+		trips[row.get("trip_id")] = scheduledStopTime{
+			tripId:      row.get("trip_id"),
+			routeId:     row.get("route_id"),
+			directionId: uint32(directionId),
+			serviceId:   row.get("service_id"),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = readGtfsFile(z, "stop_times.txt", true, func(row gtfsRow) error {
+		trip, ok := trips[row.get("trip_id")]
+		if !ok {
+			return nil
+		}
+		rawArrival := row.get("arrival_time")
+		if rawArrival == "" {
+			rawArrival = row.get("departure_time")
+		}
+		if rawArrival == "" {
+			return nil
+		}
+		arrival, err := parseGtfsTime(rawArrival)
+		if err != nil {
+			return err
+		}
+		stationId := row.get("stop_id")
+		if parent, ok := stopToStation[stationId]; ok {
+			stationId = parent
+		}
+		trip.arrival = arrival
+		s.stationToStopTimes[stationId] = append(s.stationToStopTimes[stationId], trip)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	service := func(serviceId string) *scheduledService {
+		if _, ok := s.services[serviceId]; !ok {
+			s.services[serviceId] = &scheduledService{added: map[string]bool{}, removed: map[string]bool{}}
+		}
+		return s.services[serviceId]
+	}
+	err = readGtfsFile(z, "calendar.txt", false, func(row gtfsRow) error {
+		svc := service(row.get("service_id"))
+		for i, day := range []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"} {
+			svc.weekdays[i] = row.get(day) == "1"
+		}
+		svc.startDate = row.get("start_date")
+		svc.endDate = row.get("end_date")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = readGtfsFile(z, "calendar_dates.txt", false, func(row gtfsRow) error {
+		svc := service(row.get("service_id"))
+		switch row.get("exception_type") {
+		case "1":
+			svc.added[row.get("date")] = true
+		case "2":
+			svc.removed[row.get("date")] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Match a realtime arrival at a station against the schedule. The scheduled trip with the
+// same route and direction whose arrival at the station is closest to the projected arrival
+// is returned, provided the difference is within the tolerance.
+func (s *StaticSchedule) match(stationStopId string, routeId string, directionId uint32, arrival time.Time) (scheduledTripMatch, bool) {
+	var best scheduledTripMatch
+	var bestDiff time.Duration
+	found := false
+	localArrival := arrival.In(s.location)
+	// Trips on the previous service date may run past midnight.
+	for _, date := range []time.Time{localArrival.AddDate(0, 0, -1), localArrival} {
+		serviceDate := date.Format("20060102")
+		serviceDayStart := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, s.location).Add(-12 * time.Hour)
+		for _, stopTime := range s.stationToStopTimes[stationStopId] {
+			if stopTime.routeId != routeId || stopTime.directionId != directionId {
+				continue
+			}
+			scheduledArrival := serviceDayStart.Add(stopTime.arrival)
+			diff := arrival.Sub(scheduledArrival)
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > scheduleMatchTolerance || (found && diff >= bestDiff) {
+				continue
+			}
+			if !s.services[stopTime.serviceId].activeOn(serviceDate, date.Weekday()) {
+				continue
+			}
+			best = scheduledTripMatch{tripId: stopTime.tripId, startDate: serviceDate, arrival: scheduledArrival}
+			bestDiff = diff
+			found = true
+		}
+	}
+	return best, found
+}
+
+func (svc *scheduledService) activeOn(date string, weekday time.Weekday) bool {
+	if svc == nil || svc.removed[date] {
+		return false
+	}
+	if svc.added[date] {
+		return true
+	}
+	return svc.weekdays[weekday] && svc.startDate <= date && date <= svc.endDate
+}
+
+// Parse a GTFS time of the form HH:MM:SS, where the hours may exceed 24.
+func parseGtfsTime(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid GTFS time %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid GTFS time %q", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// A row in a GTFS CSV file.
+type gtfsRow struct {
+	header map[string]int
+	record []string
+}
+
+func (r gtfsRow) get(column string) string {
+	i, ok := r.header[column]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+	return strings.TrimSpace(r.record[i])
+}
+
+// Read each row of a CSV file in a GTFS zip.
+func readGtfsFile(z *zip.Reader, name string, required bool, f func(gtfsRow) error) error {
+	file, err := z.Open(name)
+	if err != nil {
+		if !required {
+			return nil
+		}
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	headerRecord, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header of %s: %w", name, err)
+	}
+	header := map[string]int{}
+	for i, column := range headerRecord {
+		header[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := f(gtfsRow{header: header, record: record}); err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+}
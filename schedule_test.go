@@ -0,0 +1,274 @@
+package pathgtfsrt
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedWithStaticSchedule(t *testing.T) {
+	// All times are in America/New_York; makeTime(15) is 05:15 on Sunday 2023-02-26.
+	schedule := loadTestStaticSchedule(t, map[string]string{
+		"agency.txt": "agency_id,agency_name,agency_url,agency_timezone\n" +
+			"PATH,PATH,https://www.panynj.gov/path/,America/New_York\n",
+		"stops.txt": "stop_id,stop_name,parent_station\n" +
+			stopIDHoboken + ",Hoboken,\n" +
+			"platform,Hoboken Platform 1," + stopIDHoboken + "\n",
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"WEEKDAY,1,1,1,1,1,0,0,20230101,20231231\n" +
+			"SATURDAY,0,0,0,0,0,1,0,20230101,20231231\n" +
+			"SUNDAY,0,0,0,0,0,0,1,20230101,20231231\n",
+		"calendar_dates.txt": "service_id,date,exception_type\n" +
+			"WEEKDAY,20230226,2\n",
+		"trips.txt": "route_id,service_id,trip_id,direction_id\n" +
+			routeID1 + ",WEEKDAY,weekday,1\n" +
+			routeID1 + ",SUNDAY,sunday_early,1\n" +
+			routeID1 + ",SUNDAY,sunday_late,1\n" +
+			routeID1 + ",SATURDAY,saturday_overnight,0\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"weekday,05:15:00,05:15:00,platform,1\n" +
+			"sunday_early,05:13:00,05:13:00,platform,1\n" +
+			"sunday_late,05:30:00,05:30:00," + stopIDHoboken + ",1\n" +
+			"saturday_overnight,29:16:00,29:16:00,platform,1\n",
+	})
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 15, 10),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 60, 10),
+		},
+	})
+	var gotMsg *gtfsrt.FeedMessage
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		}, WithStaticSchedule(schedule))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	type trip struct {
+		TripID       string
+		StartDate    string
+		Delay        *int32
+		ArrivalDelay *int32
+	}
+	var got []trip
+	for _, entity := range gotMsg.GetEntity() {
+		got = append(got, trip{
+			TripID:       entity.GetTripUpdate().GetTrip().GetTripId(),
+			StartDate:    entity.GetTripUpdate().GetTrip().GetStartDate(),
+			Delay:        entity.GetTripUpdate().Delay,
+			ArrivalDelay: entity.GetTripUpdate().GetStopTimeUpdate()[0].GetArrival().Delay,
+		})
+	}
+	want := []trip{
+		{TripID: "sunday_early", StartDate: "20230226", Delay: ptr(int32(120)), ArrivalDelay: ptr(int32(120))},
+		{TripID: "saturday_overnight", StartDate: "20230225", Delay: ptr(int32(-60)), ArrivalDelay: ptr(int32(-60))},
+		// No scheduled trip within the tolerance, so the trip ID is synthesized.
+		{TripID: gotMsg.GetEntity()[2].GetId()},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("trips got != want, diff=%s", diff)
+	}
+}
+
+func TestFeedWithScheduleRelationship(t *testing.T) {
+	schedule := loadTestStaticSchedule(t, map[string]string{
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"DAILY,1,1,1,1,1,1,1,20230101,20231231\n",
+		"trips.txt": "route_id,service_id,trip_id,direction_id\n" +
+			routeID1 + ",DAILY,trip,1\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"trip,10:15:00,10:15:00," + stopIDHoboken + ",1\n",
+	})
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 15, 10),
+		},
+	})
+	for _, tc := range []struct {
+		name string
+		opts []FeedOption
+		want []*gtfsrt.TripDescriptor_ScheduleRelationship
+	}{
+		{
+			name: "default",
+			opts: []FeedOption{WithStaticSchedule(schedule)},
+			want: []*gtfsrt.TripDescriptor_ScheduleRelationship{nil, nil},
+		},
+		{
+			name: "unscheduled",
+			opts: []FeedOption{WithStaticSchedule(schedule), WithScheduleRelationship(gtfsrt.TripDescriptor_UNSCHEDULED)},
+			want: []*gtfsrt.TripDescriptor_ScheduleRelationship{
+				gtfsrt.TripDescriptor_SCHEDULED.Enum(),
+				gtfsrt.TripDescriptor_UNSCHEDULED.Enum(),
+			},
+		},
+		{
+			name: "added without schedule",
+			opts: []FeedOption{WithScheduleRelationship(gtfsrt.TripDescriptor_ADDED)},
+			want: []*gtfsrt.TripDescriptor_ScheduleRelationship{
+				gtfsrt.TripDescriptor_ADDED.Enum(),
+				gtfsrt.TripDescriptor_ADDED.Enum(),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotMsg *gtfsrt.FeedMessage
+			_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+				func(result UpdateResult) {
+					gotMsg = result.Msg
+				}, tc.opts...)
+			if err != nil {
+				t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+			}
+			var got []*gtfsrt.TripDescriptor_ScheduleRelationship
+			for _, entity := range gotMsg.GetEntity() {
+				got = append(got, entity.GetTripUpdate().GetTrip().ScheduleRelationship)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("schedule relationships got != want, diff=%s", diff)
+			}
+		})
+	}
+}
+
+func TestFeedWithStaticSchedule_TrainAtTwoStations(t *testing.T) {
+	schedule := loadTestStaticSchedule(t, map[string]string{
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"DAILY,1,1,1,1,1,1,1,20230101,20231231\n",
+		"trips.txt": "route_id,service_id,trip_id,direction_id\n" +
+			routeID1 + ",DAILY,trip,1\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"trip,10:15:00,10:15:00," + stopIDHoboken + ",1\n" +
+			"trip,10:25:00,10:25:00," + stopID14St + ",2\n",
+	})
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 27, 12),
+		},
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 16, 10),
+		},
+	})
+	var gotMsg *gtfsrt.FeedMessage
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		}, WithStaticSchedule(schedule))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	// The arrivals at both stations are merged into one trip update, in the order of arrival.
+	if numEntities := len(gotMsg.GetEntity()); numEntities != 1 {
+		t.Fatalf("number of entities got=%d, want=1", numEntities)
+	}
+	update := gotMsg.GetEntity()[0].GetTripUpdate()
+	if tripID := update.GetTrip().GetTripId(); tripID != "trip" {
+		t.Errorf("trip ID got=%q, want=%q", tripID, "trip")
+	}
+	type stopTime struct {
+		StopID  string
+		Arrival int64
+		Delay   int32
+	}
+	var got []stopTime
+	for _, stopTimeUpdate := range update.GetStopTimeUpdate() {
+		got = append(got, stopTime{
+			StopID:  stopTimeUpdate.GetStopId(),
+			Arrival: stopTimeUpdate.GetArrival().GetTime(),
+			Delay:   stopTimeUpdate.GetArrival().GetDelay(),
+		})
+	}
+	want := []stopTime{
+		{StopID: stopIDHoboken, Arrival: *makeUnix(16), Delay: 60},
+		{StopID: stopID14St, Arrival: *makeUnix(27), Delay: 120},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stop time updates got != want, diff=%s", diff)
+	}
+	if timestamp := update.GetTimestamp(); timestamp != uint64(*makeUnix(12)) {
+		t.Errorf("timestamp got=%d, want=%d", timestamp, *makeUnix(12))
+	}
+}
+
+func TestFeedWithStaticSchedule_TwoTrainsNearOneTrip(t *testing.T) {
+	schedule := loadTestStaticSchedule(t, map[string]string{
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"DAILY,1,1,1,1,1,1,1,20230101,20231231\n",
+		"trips.txt": "route_id,service_id,trip_id,direction_id\n" +
+			routeID1 + ",DAILY,trip,1\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"trip,10:16:00,10:16:00," + stopIDHoboken + ",1\n",
+	})
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 18, 10),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	var gotMsg *gtfsrt.FeedMessage
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		}, WithStaticSchedule(schedule), WithScheduleRelationship(gtfsrt.TripDescriptor_UNSCHEDULED))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	type trip struct {
+		TripID       string
+		StartDate    string
+		Relationship gtfsrt.TripDescriptor_ScheduleRelationship
+		Delay        *int32
+	}
+	var got []trip
+	for _, entity := range gotMsg.GetEntity() {
+		got = append(got, trip{
+			TripID:       entity.GetTripUpdate().GetTrip().GetTripId(),
+			StartDate:    entity.GetTripUpdate().GetTrip().GetStartDate(),
+			Relationship: entity.GetTripUpdate().GetTrip().GetScheduleRelationship(),
+			Delay:        entity.GetTripUpdate().Delay,
+		})
+	}
+	want := []trip{
+		// The scheduled trip is assigned to the closer train, so this train has a synthesized trip ID.
+		{TripID: gotMsg.GetEntity()[0].GetId(), Relationship: gtfsrt.TripDescriptor_UNSCHEDULED},
+		{TripID: "trip", StartDate: "20230226", Relationship: gtfsrt.TripDescriptor_SCHEDULED, Delay: ptr(int32(-60))},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("trips got != want, diff=%s", diff)
+	}
+}
+
+func loadTestStaticSchedule(t *testing.T, files map[string]string) *StaticSchedule {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatalf("zip.Create(%s) err got=%v, want=<nil>", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("writing %s err got=%v, want=<nil>", name, err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("zip.Close() err got=%v, want=<nil>", err)
+	}
+	schedule, err := LoadStaticSchedule(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("LoadStaticSchedule() err got=%v, want=<nil>", err)
+	}
+	return schedule
+}
@@ -0,0 +1,135 @@
+package pathgtfsrt
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+)
+
+type siri struct {
+	XMLName         xml.Name            `xml:"http://www.siri.org.uk/siri Siri"`
+	Version         string              `xml:"version,attr"`
+	ServiceDelivery siriServiceDelivery `xml:"ServiceDelivery"`
+}
+
+type siriServiceDelivery struct {
+	ResponseTimestamp      string                     `xml:"ResponseTimestamp"`
+	StopMonitoringDelivery siriStopMonitoringDelivery `xml:"StopMonitoringDelivery"`
+}
+
+type siriStopMonitoringDelivery struct {
+	Version            string                   `xml:"version,attr"`
+	ResponseTimestamp  string                   `xml:"ResponseTimestamp"`
+	MonitoredStopVisit []siriMonitoredStopVisit `xml:"MonitoredStopVisit"`
+}
+
+type siriMonitoredStopVisit struct {
+	RecordedAtTime          string                      `xml:"RecordedAtTime,omitempty"`
+	MonitoringRef           string                      `xml:"MonitoringRef"`
+	MonitoredVehicleJourney siriMonitoredVehicleJourney `xml:"MonitoredVehicleJourney"`
+}
+
+type siriMonitoredVehicleJourney struct {
+	LineRef                 string                      `xml:"LineRef"`
+	DirectionRef            uint32                      `xml:"DirectionRef"`
+	FramedVehicleJourneyRef siriFramedVehicleJourneyRef `xml:"FramedVehicleJourneyRef"`
+	DestinationName         string                      `xml:"DestinationName,omitempty"`
+	MonitoredCall           siriMonitoredCall           `xml:"MonitoredCall"`
+}
+
+type siriFramedVehicleJourneyRef struct {
+	DataFrameRef           string `xml:"DataFrameRef"`
+	DatedVehicleJourneyRef string `xml:"DatedVehicleJourneyRef"`
+}
+
+type siriMonitoredCall struct {
+	StopPointRef          string `xml:"StopPointRef"`
+	ExpectedArrivalTime   string `xml:"ExpectedArrivalTime,omitempty"`
+	ExpectedDepartureTime string `xml:"ExpectedDepartureTime,omitempty"`
+}
+
+// SiriStopMonitoringHandler returns a handler that responds with the most recent trip updates
+// rendered as a SIRI 2.0 StopMonitoring delivery, for consumers that use SIRI rather than GTFS
+// realtime. There is one monitored stop visit for each stop time update.
+//
+// The optional MonitoringRef query parameter restricts the response to a single stop ID. The
+// data frame reference is the trip's start date if known, and otherwise the date of the feed.
+func (f *Feed) SiriStopMonitoringHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := f.get().msg
+		if msg == nil {
+			http.Error(w, "feed is warming up", http.StatusServiceUnavailable)
+			return
+		}
+		b, err := xml.MarshalIndent(buildSiriStopMonitoring(msg, r.URL.Query().Get("MonitoringRef")), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(xml.Header))
+		w.Write(b)
+	})
+}
+
+// Build a SIRI StopMonitoring delivery from a GTFS realtime message. If monitoringRef is not empty,
+// only visits to that stop are included.
+func buildSiriStopMonitoring(msg *gtfs.FeedMessage, monitoringRef string) *siri {
+	feedTime := time.Unix(int64(msg.GetHeader().GetTimestamp()), 0).UTC()
+	responseTimestamp := feedTime.Format(time.RFC3339)
+	delivery := siriStopMonitoringDelivery{
+		Version:           "2.0",
+		ResponseTimestamp: responseTimestamp,
+	}
+	for _, entity := range msg.GetEntity() {
+		update := entity.GetTripUpdate()
+		if update == nil {
+			continue
+		}
+		dataFrameRef := update.GetTrip().GetStartDate()
+		if dataFrameRef == "" {
+			dataFrameRef = feedTime.Format("2006-01-02")
+		} else if t, err := time.Parse("20060102", dataFrameRef); err == nil {
+			dataFrameRef = t.Format("2006-01-02")
+		}
+		var recordedAtTime string
+		if update.Timestamp != nil {
+			recordedAtTime = time.Unix(int64(update.GetTimestamp()), 0).UTC().Format(time.RFC3339)
+		}
+		for _, stopTimeUpdate := range update.GetStopTimeUpdate() {
+			if monitoringRef != "" && stopTimeUpdate.GetStopId() != monitoringRef {
+				continue
+			}
+			call := siriMonitoredCall{StopPointRef: stopTimeUpdate.GetStopId()}
+			if stopTimeUpdate.Arrival != nil {
+				call.ExpectedArrivalTime = time.Unix(stopTimeUpdate.GetArrival().GetTime(), 0).UTC().Format(time.RFC3339)
+			}
+			if stopTimeUpdate.Departure != nil {
+				call.ExpectedDepartureTime = time.Unix(stopTimeUpdate.GetDeparture().GetTime(), 0).UTC().Format(time.RFC3339)
+			}
+			delivery.MonitoredStopVisit = append(delivery.MonitoredStopVisit, siriMonitoredStopVisit{
+				RecordedAtTime: recordedAtTime,
+				MonitoringRef:  stopTimeUpdate.GetStopId(),
+				MonitoredVehicleJourney: siriMonitoredVehicleJourney{
+					LineRef:      update.GetTrip().GetRouteId(),
+					DirectionRef: update.GetTrip().GetDirectionId(),
+					FramedVehicleJourneyRef: siriFramedVehicleJourneyRef{
+						DataFrameRef:           dataFrameRef,
+						DatedVehicleJourneyRef: update.GetTrip().GetTripId(),
+					},
+					DestinationName: update.GetVehicle().GetLabel(),
+					MonitoredCall:   call,
+				},
+			})
+		}
+	}
+	return &siri{
+		Version: "2.0",
+		ServiceDelivery: siriServiceDelivery{
+			ResponseTimestamp:      responseTimestamp,
+			StopMonitoringDelivery: delivery,
+		},
+	}
+}
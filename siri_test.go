@@ -0,0 +1,66 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedSiriStopMonitoringHandler(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 12),
+		},
+	})
+	f, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	var hobokenTripId string
+	for _, entity := range f.get().msg.GetEntity() {
+		if entity.GetTripUpdate().GetStopTimeUpdate()[0].GetStopId() == stopIDHoboken {
+			hobokenTripId = entity.GetTripUpdate().GetTrip().GetTripId()
+		}
+	}
+
+	w := httptest.NewRecorder()
+	f.SiriStopMonitoringHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/siri/stop-monitoring?MonitoringRef="+stopIDHoboken, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code got=%d, want=%d", w.Code, http.StatusOK)
+	}
+	var got siri
+	if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("xml.Unmarshal() err got=%v, want=<nil>", err)
+	}
+	want := []siriMonitoredStopVisit{
+		{
+			RecordedAtTime: "2023-02-26T10:10:00Z",
+			MonitoringRef:  stopIDHoboken,
+			MonitoredVehicleJourney: siriMonitoredVehicleJourney{
+				LineRef:      routeID1,
+				DirectionRef: 1,
+				FramedVehicleJourneyRef: siriFramedVehicleJourneyRef{
+					DataFrameRef:           "1970-01-01",
+					DatedVehicleJourneyRef: hobokenTripId,
+				},
+				MonitoredCall: siriMonitoredCall{
+					StopPointRef:        stopIDHoboken,
+					ExpectedArrivalTime: "2023-02-26T10:15:00Z",
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got.ServiceDelivery.StopMonitoringDelivery.MonitoredStopVisit); diff != "" {
+		t.Errorf("monitored stop visits got != want, diff=%s", diff)
+	}
+}
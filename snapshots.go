@@ -0,0 +1,69 @@
+package pathgtfsrt
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// WithSnapshotHistory keeps the provided number of most recent versions of the feed in memory,
+// so that they can be retrieved using SnapshotsHandler.
+func WithSnapshotHistory(size int) FeedOption {
+	return func(o *feedOptions) {
+		o.historySize = size
+	}
+}
+
+type snapshotSummary struct {
+	N         int    `json:"n"`
+	Timestamp string `json:"timestamp"`
+	Entities  int    `json:"entities"`
+}
+
+// SnapshotsHandler returns a handler for the versions of the feed kept by WithSnapshotHistory, so
+// that consumers that missed an update, or operators debugging a discrepancy, can fetch recent
+// prior versions. The handler is intended to be mounted at a path ending in a slash, such as
+// /gtfsrt/snapshots/.
+//
+// A request for the path itself responds with a JSON list of the available versions. A request
+// for <path>/<n> responds with the nth most recent version, where 0 is the current version, in
+// the same way as the feed's ServeHTTP.
+func (f *Feed) SnapshotsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		history := f.getHistory()
+		name := path.Base(r.URL.Path)
+		if r.URL.Path == "" || r.URL.Path[len(r.URL.Path)-1] == '/' {
+			summaries := []snapshotSummary{}
+			for n := 0; n < len(history); n++ {
+				msg := history[len(history)-1-n].msg
+				summaries = append(summaries, snapshotSummary{
+					N:         n,
+					Timestamp: time.Unix(int64(msg.GetHeader().GetTimestamp()), 0).UTC().Format(time.RFC3339),
+					Entities:  len(msg.GetEntity()),
+				})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(summaries)
+			return
+		}
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 0 || n >= len(history) {
+			http.NotFound(w, r)
+			return
+		}
+		s := history[len(history)-1-n]
+		if f.differential {
+			f.serve(w, r, s, s.differentialMsg, s.differentialGtfs)
+			return
+		}
+		f.serve(w, r, s, s.msg, s.gtfs)
+	})
+}
+
+func (f *Feed) getHistory() []snapshot {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.history
+}
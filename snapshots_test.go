@@ -0,0 +1,83 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFeedSnapshotsHandler(t *testing.T) {
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+		},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		}, WithSnapshotHistory(2))
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+	for i := 0; i < 2; i++ {
+		client.stationToTrains[sourceapi.Station_HOBOKEN] = append(client.stationToTrains[sourceapi.Station_HOBOKEN],
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20+i, 5))
+		c.Add(5 * time.Second)
+		<-updateSignal
+	}
+
+	w := httptest.NewRecorder()
+	f.SnapshotsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfsrt/snapshots/", nil))
+	var got []snapshotSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() err got=%v, want=<nil>", err)
+	}
+	want := []snapshotSummary{
+		{N: 0, Timestamp: "2023-02-26T10:10:10Z", Entities: 3},
+		{N: 1, Timestamp: "2023-02-26T10:10:05Z", Entities: 2},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("snapshots got != want, diff=%s", diff)
+	}
+
+	for _, tc := range []struct {
+		path         string
+		wantCode     int
+		wantEntities int
+	}{
+		{"/gtfsrt/snapshots/0", http.StatusOK, 3},
+		{"/gtfsrt/snapshots/1", http.StatusOK, 2},
+		{"/gtfsrt/snapshots/2", http.StatusNotFound, 0},
+		{"/gtfsrt/snapshots/latest", http.StatusNotFound, 0},
+	} {
+		w := httptest.NewRecorder()
+		f.SnapshotsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.wantCode {
+			t.Errorf("%s status code got=%d, want=%d", tc.path, w.Code, tc.wantCode)
+			continue
+		}
+		if tc.wantCode != http.StatusOK {
+			continue
+		}
+		var msg gtfsrt.FeedMessage
+		if err := proto.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+			t.Fatalf("proto.Unmarshal() err got=%v, want=<nil>", err)
+		}
+		if len(msg.GetEntity()) != tc.wantEntities {
+			t.Errorf("%s entities got=%d, want=%d", tc.path, len(msg.GetEntity()), tc.wantEntities)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package pathgtfsrt
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+type stationInfo struct {
+	name string
+	lat  string
+	lon  string
+}
+
+// Snapshot from: https://transitfeeds.com/p/port-authority-of-new-york-and-new-jersey/384/latest/stops
+var sourceStationToStationInfo = map[sourceapi.Station]stationInfo{
+	sourceapi.Station_FOURTEENTH_STREET:   {"14th Street", "40.737375", "-73.996878"},
+	sourceapi.Station_TWENTY_THIRD_STREET: {"23rd Street", "40.742906", "-73.992822"},
+	sourceapi.Station_THIRTY_THIRD_STREET: {"33rd Street", "40.749121", "-73.988257"},
+	sourceapi.Station_NINTH_STREET:        {"9th Street", "40.734236", "-73.998922"},
+	sourceapi.Station_CHRISTOPHER_STREET:  {"Christopher Street", "40.732989", "-74.006911"},
+	sourceapi.Station_EXCHANGE_PLACE:      {"Exchange Place", "40.716738", "-74.032397"},
+	sourceapi.Station_GROVE_STREET:        {"Grove Street", "40.719609", "-74.042817"},
+	sourceapi.Station_HARRISON:            {"Harrison", "40.739072", "-74.155777"},
+	sourceapi.Station_HOBOKEN:             {"Hoboken", "40.735658", "-74.029067"},
+	sourceapi.Station_JOURNAL_SQUARE:      {"Journal Square", "40.732690", "-74.062886"},
+	sourceapi.Station_NEWPORT:             {"Newport", "40.726975", "-74.033918"},
+	sourceapi.Station_NEWARK:              {"Newark", "40.734680", "-74.164061"},
+	sourceapi.Station_WORLD_TRADE_CENTER:  {"World Trade Center", "40.712582", "-74.011123"},
+}
+
+type routeInfo struct {
+	name  string
+	color string
+}
+
+// Snapshot from: https://transitfeeds.com/p/port-authority-of-new-york-and-new-jersey/384/latest/routes
+var sourceRouteToRouteInfo = map[sourceapi.Route]routeInfo{
+	sourceapi.Route_HOB_33:     {"Hoboken - 33rd Street", "4D92FB"},
+	sourceapi.Route_HOB_WTC:    {"Hoboken - World Trade Center", "65C100"},
+	sourceapi.Route_JSQ_33:     {"Journal Square - 33rd Street", "FF9900"},
+	sourceapi.Route_NWK_WTC:    {"Newark - World Trade Center", "D93A30"},
+	sourceapi.Route_JSQ_33_HOB: {"Journal Square - 33rd Street (via Hoboken)", "FF9900"},
+}
+
+const (
+	staticGtfsAgencyId      = "PATH"
+	staticGtfsServiceId     = "PLACEHOLDER"
+	staticGtfsRouteTypeRail = "1"
+)
+
+// Builds a minimal static GTFS zip whose stop and route IDs match those in the realtime feed.
+//
+// The zip contains the agency, the stations (as stops with location type 1), the routes and a
+// placeholder calendar valid for one year from now. It contains no trips or stop times. Station
+// and route names come from the snapshots above; stations and routes that are not in the
+// snapshots are named using the source API identifier.
+func buildStaticGtfsZip(staticData staticData, now time.Time) ([]byte, error) {
+	var stations []sourceapi.Station
+	for station := range staticData.stationToStopId {
+		stations = append(stations, station)
+	}
+	sort.Slice(stations, func(i, j int) bool { return stations[i] < stations[j] })
+	var routes []sourceapi.Route
+	for route := range staticData.routeToRouteId {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i] < routes[j] })
+
+	agency := [][]string{
+		{"agency_id", "agency_name", "agency_url", "agency_timezone"},
+		{staticGtfsAgencyId, "Port Authority Trans-Hudson", "https://www.panynj.gov/path/", "America/New_York"},
+	}
+	stops := [][]string{{"stop_id", "stop_name", "stop_lat", "stop_lon", "location_type"}}
+	for _, station := range stations {
+		info, ok := sourceStationToStationInfo[station]
+		if !ok {
+			info = stationInfo{name: station.String()}
+		}
+		stops = append(stops, []string{staticData.stationToStopId[station], info.name, info.lat, info.lon, "1"})
+	}
+	routesTxt := [][]string{{"route_id", "agency_id", "route_long_name", "route_type", "route_color"}}
+	for _, route := range routes {
+		info, ok := sourceRouteToRouteInfo[route]
+		if !ok {
+			info = routeInfo{name: route.String()}
+		}
+		routesTxt = append(routesTxt, []string{staticData.routeToRouteId[route], staticGtfsAgencyId, info.name, staticGtfsRouteTypeRail, info.color})
+	}
+	calendar := [][]string{
+		{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"},
+		{staticGtfsServiceId, "1", "1", "1", "1", "1", "1", "1", now.Format("20060102"), now.AddDate(1, 0, 0).Format("20060102")},
+	}
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name    string
+		records [][]string
+	}{
+		{"agency.txt", agency},
+		{"stops.txt", stops},
+		{"routes.txt", routesTxt},
+		{"calendar.txt", calendar},
+	} {
+		w, err := z.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if err := csv.NewWriter(w).WriteAll(file.records); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// StaticGtfsHandler returns a handler that responds with a minimal static GTFS zip whose stop IDs
+// and route IDs are guaranteed to match those in the realtime feed. The zip is built from the
+// static data retrieved when the feed was created and contains agency.txt, stops.txt, routes.txt
+// and a placeholder calendar.txt. It is built on the first request, so that feeds that do not serve
+// it do not build it.
+func (f *Feed) StaticGtfsHandler() http.Handler {
+	var once sync.Once
+	var staticGtfs []byte
+	var err error
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			staticGtfs, err = buildStaticGtfsZip(f.staticData, f.clock.Now())
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to build static GTFS: %s", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="gtfs_static.zip"`)
+		w.Write(staticGtfs)
+	})
+}
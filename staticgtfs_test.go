@@ -0,0 +1,72 @@
+package pathgtfsrt
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedStaticGtfsHandler(t *testing.T) {
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_FOURTEENTH_STREET: {},
+		sourceapi.Station_HOBOKEN:           {},
+	})
+	c := clock.NewMock()
+	c.Set(makeTime(0))
+	feed, err := NewFeed(context.Background(), c, 5*time.Second, client, func(UpdateResult) {})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	w := httptest.NewRecorder()
+	feed.StaticGtfsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gtfs_static.zip", nil))
+	if got := w.Header().Get("Content-Type"); got != "application/zip" {
+		t.Errorf("Content-Type got=%q, want=%q", got, "application/zip")
+	}
+	z, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() err got=%v, want=<nil>", err)
+	}
+	got := map[string][][]string{}
+	for _, file := range z.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatalf("Open(%s) err got=%v, want=<nil>", file.Name, err)
+		}
+		got[file.Name], err = csv.NewReader(r).ReadAll()
+		if err != nil {
+			t.Fatalf("reading %s err got=%v, want=<nil>", file.Name, err)
+		}
+		r.Close()
+	}
+	want := map[string][][]string{
+		"agency.txt": {
+			{"agency_id", "agency_name", "agency_url", "agency_timezone"},
+			{"PATH", "Port Authority Trans-Hudson", "https://www.panynj.gov/path/", "America/New_York"},
+		},
+		"stops.txt": {
+			{"stop_id", "stop_name", "stop_lat", "stop_lon", "location_type"},
+			{stopIDHoboken, "Hoboken", "40.735658", "-74.029067", "1"},
+			{stopID14St, "14th Street", "40.737375", "-73.996878", "1"},
+		},
+		"routes.txt": {
+			{"route_id", "agency_id", "route_long_name", "route_type", "route_color"},
+			{routeID1, "PATH", "Hoboken - 33rd Street", "1", "4D92FB"},
+		},
+		"calendar.txt": {
+			{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"},
+			{"PLACEHOLDER", "1", "1", "1", "1", "1", "1", "1", "20230226", "20240226"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("static GTFS got != want, diff=%s", diff)
+	}
+}
@@ -0,0 +1,175 @@
+package pathgtfsrt
+
+import (
+	"time"
+
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+// The maximum number of source API errors kept for the status API.
+const maxRecentErrors = 20
+
+// An error from the source API and when the update it occurred in started.
+type recordedError struct {
+	time time.Time
+	err  error
+}
+
+// Appends the errors from an update to the recent errors, dropping the oldest errors beyond the
+// maximum. The result is a new slice so that earlier snapshots are unaffected.
+func appendRecentErrors(recentErrors []recordedError, t time.Time, errs []error) []recordedError {
+	if len(errs) == 0 {
+		return recentErrors
+	}
+	result := make([]recordedError, 0, len(recentErrors)+len(errs))
+	result = append(result, recentErrors...)
+	for _, err := range errs {
+		result = append(result, recordedError{time: t, err: err})
+	}
+	if len(result) > maxRecentErrors {
+		result = result[len(result)-maxRecentErrors:]
+	}
+	return result
+}
+
+// The results of the requests to the source API across updates.
+type fetchHealth struct {
+	// When the most recent update in which all requests succeeded started.
+	lastSuccessfulUpdate time.Time
+	// When the most recent update in which at least one request succeeded, so that the feed contains
+	// fresh data, started.
+	lastDataUpdate time.Time
+	// The number of most recent updates in which at least one request failed.
+	consecutiveFailedUpdates int
+	stations                 map[sourceapi.Station]stationFetch
+}
+
+// The results of the requests for the upcoming trains at a station across updates.
+type stationFetch struct {
+	lastSuccess       time.Time
+	lastErr           error
+	consecutiveErrors int
+}
+
+// Returns the health after an update that started at the provided time, in which the requests for
+// the provided stations failed. The receiver is not modified so that earlier snapshots are
+// unaffected.
+func (h fetchHealth) record(t time.Time, stations []sourceapi.Station, failed map[sourceapi.Station]error) fetchHealth {
+	result := fetchHealth{
+		lastSuccessfulUpdate:     h.lastSuccessfulUpdate,
+		lastDataUpdate:           h.lastDataUpdate,
+		consecutiveFailedUpdates: h.consecutiveFailedUpdates + 1,
+		stations:                 make(map[sourceapi.Station]stationFetch, len(stations)),
+	}
+	if len(failed) == 0 {
+		result.lastSuccessfulUpdate = t
+		result.consecutiveFailedUpdates = 0
+	}
+	if len(failed) == 0 || len(failed) < len(stations) {
+		result.lastDataUpdate = t
+	}
+	for _, station := range stations {
+		fetch := h.stations[station]
+		if err, ok := failed[station]; ok {
+			fetch.lastErr = err
+			fetch.consecutiveErrors++
+		} else {
+			fetch.lastSuccess = t
+			fetch.consecutiveErrors = 0
+		}
+		result.stations[station] = fetch
+	}
+	return result
+}
+
+// FeedStatus is a summary of the most recent update of a feed and of the recent requests to the
+// source API, for operators diagnosing problems; see Feed.Status.
+type FeedStatus struct {
+	BuildNumber       string `json:"build_number"`
+	LastUpdated       string `json:"last_updated"`
+	SourceLastUpdated string `json:"source_last_updated,omitempty"`
+	// When the most recent update in which all requests to the source API succeeded started.
+	LastSuccessfulUpdate string `json:"last_successful_update,omitempty"`
+	// The number of most recent updates in which at least one request to the source API failed.
+	ConsecutiveFailedUpdates int             `json:"consecutive_failed_updates"`
+	UpdatePeriod             float64         `json:"update_period_seconds"`
+	Paused                   bool            `json:"paused,omitempty"`
+	Entities                 int             `json:"entities"`
+	Stations                 []StationStatus `json:"stations"`
+	RecentErrors             []ErrorStatus   `json:"recent_errors"`
+}
+
+// StationStatus is the status of a station in FeedStatus.
+type StationStatus struct {
+	Station   string `json:"station"`
+	StopId    string `json:"stop_id"`
+	Name      string `json:"name"`
+	NumTrains int    `json:"num_trains"`
+	// The result of the most recent request for the upcoming trains at the station: ok or error.
+	LastFetch           string `json:"last_fetch,omitempty"`
+	LastSuccessfulFetch string `json:"last_successful_fetch,omitempty"`
+	ConsecutiveErrors   int    `json:"consecutive_errors"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// ErrorStatus is an error from the source API in FeedStatus.
+type ErrorStatus struct {
+	Time  string `json:"time"`
+	Error string `json:"error"`
+}
+
+// Status returns a summary of the most recent update of the feed, or nil if the feed has not been
+// built yet.
+func (f *Feed) Status() *FeedStatus {
+	s := f.get()
+	if s.msg == nil {
+		return nil
+	}
+	result := &FeedStatus{
+		BuildNumber:              BuildNumber,
+		LastUpdated:              s.updated.UTC().Format(time.RFC3339),
+		LastSuccessfulUpdate:     formatStatusTime(s.health.lastSuccessfulUpdate),
+		ConsecutiveFailedUpdates: s.health.consecutiveFailedUpdates,
+		SourceLastUpdated:        formatStatusTime(s.sourceLastUpdated),
+		UpdatePeriod:             f.getUpdatePeriod().Seconds(),
+		Paused:                   f.Paused(),
+		Entities:                 len(s.msg.GetEntity()),
+		Stations:                 []StationStatus{},
+		RecentErrors:             []ErrorStatus{},
+	}
+	for _, station := range f.staticData.stations {
+		status := StationStatus{
+			Station:   station.String(),
+			StopId:    f.staticData.stationToStopId[station],
+			Name:      stationName(station),
+			NumTrains: len(s.trains[station]),
+		}
+		if fetch, ok := s.health.stations[station]; ok {
+			status.LastFetch = "ok"
+			if fetch.consecutiveErrors > 0 {
+				status.LastFetch = "error"
+			}
+			status.LastSuccessfulFetch = formatStatusTime(fetch.lastSuccess)
+			status.ConsecutiveErrors = fetch.consecutiveErrors
+			if fetch.lastErr != nil {
+				status.LastError = fetch.lastErr.Error()
+			}
+		}
+		result.Stations = append(result.Stations, status)
+	}
+	for i := len(s.recentErrors) - 1; i >= 0; i-- {
+		result.RecentErrors = append(result.RecentErrors, ErrorStatus{
+			Time:  s.recentErrors[i].time.UTC().Format(time.RFC3339),
+			Error: s.recentErrors[i].err.Error(),
+		})
+	}
+	return result
+}
+
+// Formats a time in FeedStatus, or returns the empty string for the zero time.
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
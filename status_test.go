@@ -0,0 +1,138 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedStatus(t *testing.T) {
+	c := clock.NewMock()
+	c.Set(makeTime(10))
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 15, 5),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 6),
+		},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+	delete(client.stationToTrains, sourceapi.Station_FOURTEENTH_STREET)
+	c.Add(5 * time.Second)
+	<-updateSignal
+
+	b, err := json.Marshal(f.Status())
+	if err != nil {
+		t.Fatalf("json.Marshal() err got=%v, want=<nil>", err)
+	}
+	var got FeedStatus
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal() err got=%v, want=<nil>", err)
+	}
+	want := FeedStatus{
+		LastUpdated:              "2023-02-26T10:10:05Z",
+		SourceLastUpdated:        "2023-02-26T10:06:00Z",
+		LastSuccessfulUpdate:     "2023-02-26T10:10:00Z",
+		ConsecutiveFailedUpdates: 1,
+		UpdatePeriod:             5,
+		Entities:                 3,
+		Stations: []StationStatus{
+			{
+				Station:             "HOBOKEN",
+				StopId:              stopIDHoboken,
+				Name:                "Hoboken",
+				NumTrains:           2,
+				LastFetch:           "ok",
+				LastSuccessfulFetch: "2023-02-26T10:10:05Z",
+			},
+			// The trains from the previous update are kept when the source API fails.
+			{
+				Station:             "FOURTEENTH_STREET",
+				StopId:              stopID14St,
+				Name:                "14th Street",
+				NumTrains:           1,
+				LastFetch:           "error",
+				LastSuccessfulFetch: "2023-02-26T10:10:00Z",
+				ConsecutiveErrors:   1,
+				LastError:           "failed to get trains at station FOURTEENTH_STREET: error getting trains at station FOURTEENTH_STREET",
+			},
+		},
+		RecentErrors: []ErrorStatus{
+			{Time: "2023-02-26T10:10:05Z", Error: "failed to get trains at station FOURTEENTH_STREET: error getting trains at station FOURTEENTH_STREET"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("status got != want, diff=%s", diff)
+	}
+}
+
+func TestAppendRecentErrors(t *testing.T) {
+	var recentErrors []recordedError
+	for i := 0; i < maxRecentErrors; i++ {
+		recentErrors = appendRecentErrors(recentErrors, makeTime(i), []error{context.Canceled})
+	}
+	previous := recentErrors
+	recentErrors = appendRecentErrors(recentErrors, makeTime(30), []error{context.DeadlineExceeded})
+
+	if len(recentErrors) != maxRecentErrors {
+		t.Fatalf("number of errors got=%d, want=%d", len(recentErrors), maxRecentErrors)
+	}
+	if got := recentErrors[0].time; !got.Equal(makeTime(1)) {
+		t.Errorf("oldest error time got=%s, want=%s", got, makeTime(1))
+	}
+	if got := recentErrors[maxRecentErrors-1].err; got != context.DeadlineExceeded {
+		t.Errorf("newest error got=%v, want=%v", got, context.DeadlineExceeded)
+	}
+	if got := previous[0].time; !got.Equal(makeTime(0)) {
+		t.Errorf("previous oldest error time got=%s, want=%s", got, makeTime(0))
+	}
+}
+
+func TestFetchHealthRecord(t *testing.T) {
+	stations := []sourceapi.Station{sourceapi.Station_HOBOKEN, sourceapi.Station_FOURTEENTH_STREET}
+	failed := map[sourceapi.Station]error{sourceapi.Station_HOBOKEN: context.DeadlineExceeded}
+	var health fetchHealth
+	health = health.record(makeTime(0), stations, nil)
+	health = health.record(makeTime(1), stations, failed)
+	previous := health
+	health = health.record(makeTime(2), stations, failed)
+
+	if !health.lastSuccessfulUpdate.Equal(makeTime(0)) {
+		t.Errorf("last successful update got=%s, want=%s", health.lastSuccessfulUpdate, makeTime(0))
+	}
+	if health.consecutiveFailedUpdates != 2 {
+		t.Errorf("consecutive failed updates got=%d, want=2", health.consecutiveFailedUpdates)
+	}
+	want := map[sourceapi.Station]stationFetch{
+		sourceapi.Station_HOBOKEN:           {lastSuccess: makeTime(0), lastErr: context.DeadlineExceeded, consecutiveErrors: 2},
+		sourceapi.Station_FOURTEENTH_STREET: {lastSuccess: makeTime(2)},
+	}
+	if diff := cmp.Diff(want, health.stations, cmp.AllowUnexported(stationFetch{}), cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("station fetches got != want, diff=%s", diff)
+	}
+	if got := previous.stations[sourceapi.Station_HOBOKEN].consecutiveErrors; got != 1 {
+		t.Errorf("previous consecutive errors got=%d, want=1", got)
+	}
+
+	health = health.record(makeTime(3), stations, nil)
+
+	if health.consecutiveFailedUpdates != 0 || health.stations[sourceapi.Station_HOBOKEN].consecutiveErrors != 0 {
+		t.Errorf("health after a successful update got=%+v, want no consecutive errors", health)
+	}
+}
@@ -0,0 +1,113 @@
+package pathgtfsrt
+
+import (
+	"sort"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+)
+
+// The maximum difference between the observed and expected travel times between two stations for
+// arrivals at the stations to be considered the same train.
+const stitchToleranceSeconds = 2 * 60
+
+// A trip update built from arrivals reported at one or more stations.
+type tripObservation struct {
+	update   *gtfs.TripUpdate
+	entityId string
+	// The stop ID of the last station in the trip update.
+	stationStopId string
+}
+
+// Merge observations of the same train at multiple stations.
+//
+// For each route pattern, observations are processed in the order of the stations in the pattern.
+// Each observation is appended to the trip whose expected arrival at the station, based on
+// its arrival at its last station, is closest to the observed arrival. If there is no such trip
+// within the tolerance, the observation starts a new trip. Each merged trip keeps the trip
+// descriptor and entity ID of its first observation.
+func stitchTripObservations(patterns map[routePatternKey][]PatternStop, observations []tripObservation) []tripObservation {
+	type trip struct {
+		// Position of the first observation in the input, used to keep the output order stable.
+		position    int
+		observation tripObservation
+		lastIndex   int
+		lastArrival int64
+	}
+	type indexedObservation struct {
+		position int
+		index    int
+	}
+	var trips []*trip
+	keyToObservations := map[routePatternKey][]indexedObservation{}
+	for position, o := range observations {
+		key := routePatternKey{routeId: o.update.Trip.GetRouteId(), directionId: o.update.Trip.GetDirectionId()}
+		index := -1
+		for i, stop := range patterns[key] {
+			if stop.StopId == o.stationStopId {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			trips = append(trips, &trip{position: position, observation: o})
+			continue
+		}
+		keyToObservations[key] = append(keyToObservations[key], indexedObservation{position: position, index: index})
+	}
+	for key, indexedObservations := range keyToObservations {
+		stops := patterns[key]
+		sort.SliceStable(indexedObservations, func(i, j int) bool {
+			if indexedObservations[i].index != indexedObservations[j].index {
+				return indexedObservations[i].index < indexedObservations[j].index
+			}
+			return observationArrival(observations[indexedObservations[i].position]) <
+				observationArrival(observations[indexedObservations[j].position])
+		})
+		var keyTrips []*trip
+		for _, indexed := range indexedObservations {
+			o := observations[indexed.position]
+			arrival := observationArrival(o)
+			var best *trip
+			var bestDiff int64
+			for _, t := range keyTrips {
+				if t.lastIndex >= indexed.index {
+					continue
+				}
+				expected := t.lastArrival + stops[indexed.index].OffsetSeconds - stops[t.lastIndex].OffsetSeconds
+				diff := arrival - expected
+				if diff < 0 {
+					diff = -diff
+				}
+				if diff > stitchToleranceSeconds || (best != nil && diff >= bestDiff) {
+					continue
+				}
+				best = t
+				bestDiff = diff
+			}
+			if best == nil {
+				t := &trip{position: indexed.position, observation: o, lastIndex: indexed.index, lastArrival: arrival}
+				keyTrips = append(keyTrips, t)
+				trips = append(trips, t)
+				continue
+			}
+			merged := best.observation.update
+			merged.StopTimeUpdate = append(merged.StopTimeUpdate, o.update.StopTimeUpdate...)
+			if o.update.GetTimestamp() > merged.GetTimestamp() {
+				merged.Timestamp = o.update.Timestamp
+			}
+			best.observation.stationStopId = o.stationStopId
+			best.lastIndex = indexed.index
+			best.lastArrival = arrival
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool { return trips[i].position < trips[j].position })
+	result := make([]tripObservation, len(trips))
+	for i, t := range trips {
+		result[i] = t.observation
+	}
+	return result
+}
+
+func observationArrival(o tripObservation) int64 {
+	return o.update.StopTimeUpdate[len(o.update.StopTimeUpdate)-1].GetArrival().GetTime()
+}
@@ -0,0 +1,76 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestFeedWithTripStitching(t *testing.T) {
+	patterns := []RoutePattern{
+		{
+			RouteId:     routeID1,
+			DirectionId: 1,
+			Stops: []PatternStop{
+				{StopId: stopIDNewport, OffsetSeconds: 0},
+				{StopId: stopIDHoboken, OffsetSeconds: 120},
+				{StopId: stopID14St, OffsetSeconds: 600},
+			},
+		},
+	}
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_NEWPORT: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 10, 5),
+		},
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 13, 6),
+			// There is no route pattern for this direction.
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 13, 6),
+		},
+		sourceapi.Station_FOURTEENTH_STREET: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 30, 7),
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 21, 4),
+		},
+	})
+	var gotMsg *gtfsrt.FeedMessage
+	_, err := NewFeed(context.Background(), clock.NewMock(), 5*time.Second, client,
+		func(result UpdateResult) {
+			gotMsg = result.Msg
+		}, WithRoutePatterns(patterns), WithTripStitching())
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+
+	stitched := wantFeedEntity(routeID1, 1, stopIDNewport, 10, 6)
+	for _, stop := range []struct {
+		stopID  string
+		arrival int
+	}{
+		{stopIDHoboken, 13},
+		{stopID14St, 21},
+	} {
+		stitched.TripUpdate.StopTimeUpdate = append(stitched.TripUpdate.StopTimeUpdate,
+			&gtfsrt.TripUpdate_StopTimeUpdate{
+				StopId: ptr(stop.stopID),
+				Arrival: &gtfsrt.TripUpdate_StopTimeEvent{
+					Time: makeUnix(stop.arrival),
+				},
+			})
+	}
+	wantEntities := []*gtfsrt.FeedEntity{
+		stitched,
+		wantFeedEntity(routeID1, 0, stopIDHoboken, 13, 6),
+		wantFeedEntity(routeID1, 1, stopID14St, 30, 7),
+	}
+	if diff := cmp.Diff(wantEntities, gotMsg.GetEntity(), protocmp.Transform(),
+		protocmp.IgnoreFields(&gtfsrt.FeedEntity{}, "id"),
+		protocmp.IgnoreFields(&gtfsrt.TripDescriptor{}, "trip_id")); diff != "" {
+		t.Errorf("entities got != want, diff=%s", diff)
+	}
+}
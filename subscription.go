@@ -0,0 +1,129 @@
+package pathgtfsrt
+
+import "sync"
+
+// Backpressure determines what a feed does when the subscriber of a channel returned by
+// Feed.Updates does not keep up with the updates.
+type Backpressure int
+
+const (
+	// Updates that the subscriber has not received when the buffer is full are dropped, oldest
+	// first, so the subscriber always receives the latest update.
+	KeepLatest Backpressure = iota
+	// The feed waits until the subscriber has received each update. A slow subscriber delays the
+	// updates of the feed and every other subscriber.
+	Block
+)
+
+// SubscriptionOption configures optional behavior of a channel returned by Feed.Updates.
+type SubscriptionOption func(*subscriptionOptions)
+
+type subscriptionOptions struct {
+	backpressure Backpressure
+	bufferSize   int
+}
+
+// WithBackpressure sets what the feed does when the subscriber does not keep up with the updates.
+// The default is KeepLatest.
+func WithBackpressure(backpressure Backpressure) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.backpressure = backpressure
+	}
+}
+
+// WithSubscriptionBuffer sets the number of updates the channel buffers for the subscriber. The
+// default is 1.
+func WithSubscriptionBuffer(size int) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.bufferSize = size
+	}
+}
+
+// Updates returns a channel that receives the result of each subsequent update of the feed, for
+// consumers that process updates in a pipeline rather than in a callback; see Subscribe.
+//
+// The returned function cancels the subscription and closes the channel. It must be called once
+// the subscriber is done. Closing the feed also cancels the subscription and closes the channel.
+func (f *Feed) Updates(opts ...SubscriptionOption) (<-chan UpdateResult, func()) {
+	options := subscriptionOptions{bufferSize: 1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.bufferSize < 1 && options.backpressure == KeepLatest {
+		options.bufferSize = 1
+	}
+	ch := make(chan UpdateResult, options.bufferSize)
+	done := make(chan struct{})
+	// Held while sending, so that the channel is not closed during a send.
+	var mutex sync.Mutex
+	closed := false
+	unsubscribe := f.Subscribe(func(result UpdateResult) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if closed {
+			return
+		}
+		if options.backpressure == Block {
+			select {
+			case ch <- result:
+			case <-done:
+			case <-f.done:
+			}
+			return
+		}
+		// Only this callback sends on the channel, so the loop ends once an old update is dropped.
+		for {
+			select {
+			case ch <- result:
+				return
+			default:
+			}
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	})
+	var once sync.Once
+	var id int
+	cancel := func() {
+		once.Do(func() {
+			unsubscribe()
+			f.mutex.Lock()
+			delete(f.updatesCancels, id)
+			f.mutex.Unlock()
+			// Unblocks a send of the Block policy, which holds the mutex.
+			close(done)
+			mutex.Lock()
+			defer mutex.Unlock()
+			closed = true
+			close(ch)
+		})
+	}
+	f.mutex.Lock()
+	id = f.nextCallbackId
+	f.nextCallbackId++
+	if f.updatesCancels == nil {
+		f.updatesCancels = map[int]func(){}
+	}
+	f.updatesCancels[id] = cancel
+	f.mutex.Unlock()
+	// The subscriptions are cancelled when the feed is closed, which may have happened already.
+	select {
+	case <-f.done:
+		cancel()
+	default:
+	}
+	return ch, cancel
+}
+
+// Cancel the subscriptions of the channels returned by Updates, and close the channels.
+func (f *Feed) cancelUpdates() {
+	f.mutex.Lock()
+	cancels := f.updatesCancels
+	f.updatesCancels = nil
+	f.mutex.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
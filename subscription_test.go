@@ -0,0 +1,141 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+func TestFeedUpdates(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []SubscriptionOption
+	}{
+		{"keep latest", nil},
+		{"block", []SubscriptionOption{WithBackpressure(Block), WithSubscriptionBuffer(0)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := clock.NewMock()
+			feed, err := NewFeed(context.Background(), c, 5*time.Second, newSubscriptionTestClient(), nil)
+			if err != nil {
+				t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+			}
+			updates, unsubscribe := feed.Updates(tc.opts...)
+
+			c.Add(5 * time.Second)
+			result := <-updates
+			if got, want := result.Msg.GetHeader().GetTimestamp(), uint64(c.Now().Unix()); got != want {
+				t.Errorf("update timestamp got=%d, want=%d", got, want)
+			}
+
+			unsubscribe()
+			if _, ok := <-updates; ok {
+				t.Errorf("channel is open after unsubscribing")
+			}
+			// Unsubscribing again is a no-op.
+			unsubscribe()
+		})
+	}
+}
+
+func TestFeedUpdatesKeepLatest(t *testing.T) {
+	c := clock.NewMock()
+	feed, err := NewFeed(context.Background(), c, 5*time.Second, newSubscriptionTestClient(), nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	updates, unsubscribe := feed.Updates()
+	defer unsubscribe()
+	// Runs after the channel receives each update.
+	updateSignal := make(chan struct{}, 1)
+	feed.Subscribe(func(UpdateResult) {
+		updateSignal <- struct{}{}
+	})
+
+	c.Add(5 * time.Second)
+	<-updateSignal
+	c.Add(5 * time.Second)
+	<-updateSignal
+
+	result := <-updates
+	if got, want := result.Msg.GetHeader().GetTimestamp(), uint64(c.Now().Unix()); got != want {
+		t.Errorf("update timestamp got=%d, want=%d (the latest update)", got, want)
+	}
+	select {
+	case <-updates:
+		t.Errorf("channel received the dropped update")
+	default:
+	}
+}
+
+func TestFeedUpdatesClose(t *testing.T) {
+	c := clock.NewMock()
+	feed, err := NewFeed(context.Background(), c, 5*time.Second, newSubscriptionTestClient(), nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	// The subscriber never reads, so the update blocks sending to the channel.
+	updates, unsubscribe := feed.Updates(WithBackpressure(Block), WithSubscriptionBuffer(0))
+	defer unsubscribe()
+	c.Add(5 * time.Second)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- feed.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() err got=%v, want=<nil>", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Close() blocked on the subscriber")
+	}
+	if _, ok := <-updates; ok {
+		t.Errorf("channel is open after closing the feed")
+	}
+
+	// Channels returned after the feed is closed are closed immediately.
+	updates, unsubscribe = feed.Updates()
+	defer unsubscribe()
+	if _, ok := <-updates; ok {
+		t.Errorf("channel returned after closing the feed is open")
+	}
+}
+
+func TestFeedUpdatesContextCancelled(t *testing.T) {
+	c := clock.NewMock()
+	ctx, cancel := context.WithCancel(context.Background())
+	feed, err := NewFeed(ctx, c, 5*time.Second, newSubscriptionTestClient(), nil)
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	updates, unsubscribe := feed.Updates(WithBackpressure(Block), WithSubscriptionBuffer(0))
+	defer unsubscribe()
+	c.Add(5 * time.Second)
+
+	cancel()
+	timeout := time.After(time.Second)
+	// The blocked update may be received before the channel is closed.
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("channel is open after cancelling the context")
+		}
+	}
+}
+
+func newSubscriptionTestClient() *mockSourceClient {
+	return newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 5),
+		},
+	})
+}
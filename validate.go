@@ -0,0 +1,79 @@
+package pathgtfsrt
+
+import (
+	"fmt"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+)
+
+// ValidateFeedMessage checks a GTFS realtime message for problems that commonly cause consumers to
+// reject a feed, and returns an error describing each problem found. It is not a full validator:
+// the checks are that
+//
+//   - the header has a version and a timestamp,
+//   - entity IDs are non-empty and unique,
+//   - each entity that is not a deletion has a trip update, vehicle position or alert,
+//   - each trip update has a trip descriptor with a trip ID or route ID,
+//   - each stop time update has a stop ID or stop sequence, and an arrival or departure
+//     unless it is skipped or has no data, and
+//   - stop time update times do not decrease within a trip update.
+func ValidateFeedMessage(msg *gtfs.FeedMessage) []error {
+	var errs []error
+	if msg.GetHeader().GetGtfsRealtimeVersion() == "" {
+		errs = append(errs, fmt.Errorf("header: missing gtfs_realtime_version"))
+	}
+	if msg.GetHeader().GetTimestamp() == 0 {
+		errs = append(errs, fmt.Errorf("header: missing timestamp"))
+	}
+	ids := map[string]bool{}
+	for i, entity := range msg.GetEntity() {
+		id := entity.GetId()
+		if id == "" {
+			errs = append(errs, fmt.Errorf("entity %d: missing id", i))
+		} else if ids[id] {
+			errs = append(errs, fmt.Errorf("entity %q: duplicate id", id))
+		}
+		ids[id] = true
+		if entity.GetIsDeleted() {
+			continue
+		}
+		if entity.TripUpdate == nil && entity.Vehicle == nil && entity.Alert == nil {
+			errs = append(errs, fmt.Errorf("entity %q: no trip update, vehicle position or alert", id))
+		}
+		if entity.TripUpdate != nil {
+			errs = append(errs, validateTripUpdate(id, entity.TripUpdate)...)
+		}
+	}
+	return errs
+}
+
+func validateTripUpdate(id string, update *gtfs.TripUpdate) []error {
+	var errs []error
+	if update.GetTrip().GetTripId() == "" && update.GetTrip().GetRouteId() == "" {
+		errs = append(errs, fmt.Errorf("entity %q: trip descriptor has no trip_id or route_id", id))
+	}
+	var lastTime int64
+	for i, stopTimeUpdate := range update.GetStopTimeUpdate() {
+		if stopTimeUpdate.StopId == nil && stopTimeUpdate.StopSequence == nil {
+			errs = append(errs, fmt.Errorf("entity %q: stop time update %d has no stop_id or stop_sequence", id, i))
+		}
+		switch stopTimeUpdate.GetScheduleRelationship() {
+		case gtfs.TripUpdate_StopTimeUpdate_SKIPPED, gtfs.TripUpdate_StopTimeUpdate_NO_DATA:
+			continue
+		}
+		if stopTimeUpdate.Arrival == nil && stopTimeUpdate.Departure == nil {
+			errs = append(errs, fmt.Errorf("entity %q: stop time update %d has no arrival or departure", id, i))
+			continue
+		}
+		for _, event := range []*gtfs.TripUpdate_StopTimeEvent{stopTimeUpdate.Arrival, stopTimeUpdate.Departure} {
+			if event == nil || event.Time == nil {
+				continue
+			}
+			if event.GetTime() < lastTime {
+				errs = append(errs, fmt.Errorf("entity %q: stop time update %d has a time before the previous time", id, i))
+			}
+			lastTime = event.GetTime()
+		}
+	}
+	return errs
+}
@@ -0,0 +1,56 @@
+package pathgtfsrt
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+)
+
+func TestValidateFeedMessage(t *testing.T) {
+	valid := wantFeedEntity(routeID1, 1, stopIDHoboken, 15, 10)
+	valid.Id = ptr("valid")
+	outOfOrder := wantFeedEntity(routeID1, 1, stopIDHoboken, 15, 10)
+	outOfOrder.Id = ptr("outOfOrder")
+	outOfOrder.TripUpdate.StopTimeUpdate = append(outOfOrder.TripUpdate.StopTimeUpdate,
+		&gtfsrt.TripUpdate_StopTimeUpdate{
+			StopId:  ptr(stopID14St),
+			Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: makeUnix(12)},
+		},
+		&gtfsrt.TripUpdate_StopTimeUpdate{
+			StopId:               ptr("skipped"),
+			ScheduleRelationship: gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED.Enum(),
+		},
+		&gtfsrt.TripUpdate_StopTimeUpdate{},
+	)
+	msg := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: ptr("2.0"),
+		},
+		Entity: []*gtfsrt.FeedEntity{
+			valid,
+			outOfOrder,
+			{Id: ptr("valid"), IsDeleted: ptr(true)},
+			{Id: ptr("empty")},
+			{TripUpdate: &gtfsrt.TripUpdate{Trip: &gtfsrt.TripDescriptor{TripId: ptr("trip")}}},
+		},
+	}
+
+	var got []string
+	for _, err := range ValidateFeedMessage(msg) {
+		got = append(got, err.Error())
+	}
+
+	want := []string{
+		"header: missing timestamp",
+		`entity "outOfOrder": stop time update 1 has a time before the previous time`,
+		`entity "outOfOrder": stop time update 3 has no stop_id or stop_sequence`,
+		`entity "outOfOrder": stop time update 3 has no arrival or departure`,
+		`entity "valid": duplicate id`,
+		`entity "empty": no trip update, vehicle position or alert`,
+		"entity 4: missing id",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ValidateFeedMessage() got != want, diff=%s", diff)
+	}
+}
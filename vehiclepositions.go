@@ -0,0 +1,144 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/benbjohnson/clock"
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+)
+
+// Build a GTFS Realtime message containing approximate vehicle positions from a snapshot of the
+// current data.
+//
+// Each trip is reported once, at the stop with its earliest projected arrival. If route patterns
+// are configured, the observations of a train at multiple stations are first merged into one trip;
+// see stitchTripObservations. Otherwise trains cannot be identified across stations, and for each
+// station, route and direction only the train with the earliest projected arrival is reported.
+func buildVehiclePositionFeedMessage(clock clock.Clock, staticData staticData, realtimeData map[sourceapi.Station][]Train, options feedOptions) *gtfs.FeedMessage {
+	observations := buildTripObservations(staticData, realtimeData, options)
+	if options.routePatterns != nil {
+		observations = stitchTripObservations(options.routePatterns, observations)
+	} else {
+		observations = nextTrainObservations(observations)
+	}
+	now := clock.Now().Unix()
+	var entities []*gtfs.FeedEntity
+	for i := range observations {
+		o := &observations[i]
+		next := o.update.StopTimeUpdate[0]
+		for _, stopTimeUpdate := range o.update.StopTimeUpdate[1:] {
+			if stopTimeUpdate.GetArrival().GetTime() < next.GetArrival().GetTime() {
+				next = stopTimeUpdate
+			}
+		}
+		status := gtfs.VehiclePosition_INCOMING_AT
+		if next.GetArrival().GetTime() <= now {
+			status = gtfs.VehiclePosition_STOPPED_AT
+		}
+		entities = append(entities, &gtfs.FeedEntity{
+			Id: &o.entityId,
+			Vehicle: &gtfs.VehiclePosition{
+				Trip:          o.update.Trip,
+				Vehicle:       o.update.Vehicle,
+				StopId:        next.StopId,
+				CurrentStatus: status.Enum(),
+				Timestamp:     o.update.Timestamp,
+			},
+		})
+	}
+	return buildFeedMessage(clock, entities, options)
+}
+
+// Keep, for each station, route and direction, only the observation with the earliest arrival.
+func nextTrainObservations(observations []tripObservation) []tripObservation {
+	type key struct {
+		stationStopId string
+		routeId       string
+		directionId   uint32
+	}
+	stationToIndex := map[string]int{}
+	keyToIndex := map[key]int{}
+	var result []tripObservation
+	for _, o := range observations {
+		if _, ok := stationToIndex[o.stationStopId]; !ok {
+			stationToIndex[o.stationStopId] = len(stationToIndex)
+		}
+		k := key{stationStopId: o.stationStopId, routeId: o.update.Trip.GetRouteId(), directionId: o.update.Trip.GetDirectionId()}
+		i, ok := keyToIndex[k]
+		if !ok {
+			keyToIndex[k] = len(result)
+			result = append(result, o)
+			continue
+		}
+		if observationArrival(o) < observationArrival(result[i]) {
+			result[i] = o
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		ti, tj := result[i].update.Trip, result[j].update.Trip
+		if si, sj := stationToIndex[result[i].stationStopId], stationToIndex[result[j].stationStopId]; si != sj {
+			return si < sj
+		}
+		if ti.GetRouteId() != tj.GetRouteId() {
+			return ti.GetRouteId() < tj.GetRouteId()
+		}
+		return ti.GetDirectionId() < tj.GetDirectionId()
+	})
+	return result
+}
+
+// A source client that returns the data of the most recent update of a trip updates feed, so that
+// a derived feed is built from the same data without requesting the source API again.
+//
+// The request for a station fails if the request of the trip updates feed for the station failed
+// in its most recent update, and every request fails until the trip updates feed has been built
+// from the source API, so that the derived feed is only built from fresh data.
+type derivedSourceClient struct {
+	feed        *Feed
+	mutex       sync.Mutex
+	stationErrs map[sourceapi.Station]error
+}
+
+// Records the result of an update of the trip updates feed.
+func (c *derivedSourceClient) record(result UpdateResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stationErrs = result.StationErrs
+}
+
+func (c *derivedSourceClient) GetStationToStopId(context.Context) (map[sourceapi.Station]string, error) {
+	stationToStopId := map[sourceapi.Station]string{}
+	for station, stopId := range c.feed.staticData.stationToStopId {
+		stationToStopId[station] = stopId
+	}
+	return stationToStopId, nil
+}
+
+func (c *derivedSourceClient) GetRouteToRouteId(context.Context) (map[sourceapi.Route]string, error) {
+	routeToRouteId := map[sourceapi.Route]string{}
+	for route, routeId := range c.feed.staticData.routeToRouteId {
+		routeToRouteId[route] = routeId
+	}
+	return routeToRouteId, nil
+}
+
+func (c *derivedSourceClient) GetTrainsAtStation(_ context.Context, station sourceapi.Station) ([]Train, error) {
+	select {
+	case <-c.feed.Built():
+	default:
+		return nil, errTripUpdatesNotBuilt
+	}
+	c.mutex.Lock()
+	err := c.stationErrs[station]
+	c.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return c.feed.get().trains[station], nil
+}
+
+var errTripUpdatesNotBuilt = errors.New("the trip updates feed has not been built from the source API yet")
@@ -0,0 +1,80 @@
+package pathgtfsrt
+
+import (
+	"io"
+	"net/http"
+
+	gtfs "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// WebSocketHandler returns a handler that streams changes to the GTFS realtime data to clients
+// over a WebSocket.
+//
+// The first message sent on the WebSocket is the current data in FULL_DATASET mode. Each
+// subsequent message is in DIFFERENTIAL mode and contains the entities that changed since the
+// previous message, including deleted entities. Unlike the DifferentialHandler, no changes are
+// missed: if a client falls behind, the next message contains all changes since the last message
+// it was sent. Messages are only sent when there are changes.
+//
+// Messages are binary protobufs or, if requested in the same way as for ServeHTTP, JSON text.
+// Connections from any origin are accepted.
+func (f *Feed) WebSocketHandler() http.Handler {
+	return websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		snapshots, cancel := f.subscribe()
+		defer cancel()
+		json := wantsJson(ws.Request())
+
+		// Messages from the client are ignored; reading is only used to detect when the client goes away.
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, ws)
+			close(closed)
+		}()
+
+		var lastSent *gtfs.FeedMessage
+		send := func(msg *gtfs.FeedMessage) error {
+			var b []byte
+			var err error
+			if json {
+				b, err = protojson.Marshal(msg)
+			} else {
+				b, err = proto.Marshal(msg)
+			}
+			if err != nil {
+				return err
+			}
+			if json {
+				return websocket.Message.Send(ws, string(b))
+			}
+			return websocket.Message.Send(ws, b)
+		}
+		if msg := f.get().msg; msg != nil {
+			if err := send(msg); err != nil {
+				return
+			}
+			lastSent = msg
+		}
+		for {
+			select {
+			case <-closed:
+				return
+			case s := <-snapshots:
+				msg := s.msg
+				if lastSent != nil {
+					msg = buildDifferentialFeedMessage(lastSent, s.msg)
+					if len(msg.GetEntity()) == 0 {
+						continue
+					}
+				}
+				if err := send(msg); err != nil {
+					return
+				}
+				lastSent = s.msg
+			}
+		}
+	}}
+}
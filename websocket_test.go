@@ -0,0 +1,89 @@
+package pathgtfsrt
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	gtfsrt "github.com/jamespfennell/path-train-gtfs-realtime/proto/gtfsrt"
+	sourceapi "github.com/jamespfennell/path-train-gtfs-realtime/proto/sourceapi"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFeedWebSocketHandler(t *testing.T) {
+	c := clock.NewMock()
+	client := newTestSourceClient(map[sourceapi.Station][]Train{
+		sourceapi.Station_HOBOKEN: {
+			sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NY, 15, 10),
+		},
+	})
+	updateSignal := make(chan struct{}, 1)
+	f, err := NewFeed(context.Background(), c, 5*time.Second, client,
+		func(UpdateResult) {
+			updateSignal <- struct{}{}
+		})
+	if err != nil {
+		t.Fatalf("NewFeed() err got=%v, want=<nil>", err)
+	}
+	<-updateSignal
+	server := httptest.NewServer(f.WebSocketHandler())
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatalf("websocket.Dial() err got=%v, want=<nil>", err)
+	}
+	defer ws.Close()
+	receive := func() *gtfsrt.FeedMessage {
+		var b []byte
+		if err := websocket.Message.Receive(ws, &b); err != nil {
+			t.Fatalf("websocket.Message.Receive() err got=%v, want=<nil>", err)
+		}
+		var msg gtfsrt.FeedMessage
+		if err := proto.Unmarshal(b, &msg); err != nil {
+			t.Fatalf("proto.Unmarshal() err got=%v, want=<nil>", err)
+		}
+		return &msg
+	}
+
+	initial := receive()
+	if got := initial.GetHeader().GetIncrementality(); got != gtfsrt.FeedHeader_FULL_DATASET {
+		t.Errorf("initial message incrementality got=%s, want=%s", got, gtfsrt.FeedHeader_FULL_DATASET)
+	}
+	if numEntities := len(initial.GetEntity()); numEntities != 1 {
+		t.Fatalf("initial message number of entities got=%d, want=1", numEntities)
+	}
+	removedID := initial.GetEntity()[0].GetId()
+
+	// An update without changes does not produce a message.
+	c.Add(5 * time.Second)
+	<-updateSignal
+	client.stationToTrains[sourceapi.Station_HOBOKEN] = []Train{
+		sourceTrain(sourceapi.Route_HOB_33, sourceapi.Direction_TO_NJ, 20, 10),
+	}
+	c.Add(5 * time.Second)
+	<-updateSignal
+
+	delta := receive()
+	if got := delta.GetHeader().GetIncrementality(); got != gtfsrt.FeedHeader_DIFFERENTIAL {
+		t.Errorf("delta message incrementality got=%s, want=%s", got, gtfsrt.FeedHeader_DIFFERENTIAL)
+	}
+	var gotNew, gotDeleted []string
+	for _, entity := range delta.GetEntity() {
+		if entity.GetIsDeleted() {
+			gotDeleted = append(gotDeleted, entity.GetId())
+		} else {
+			gotNew = append(gotNew, entity.GetId())
+		}
+	}
+	if len(gotNew) != 1 {
+		t.Errorf("delta message number of new entities got=%d, want=1", len(gotNew))
+	}
+	if len(gotDeleted) != 1 || gotDeleted[0] != removedID {
+		t.Errorf("delta message deleted entities got=%v, want=[%s]", gotDeleted, removedID)
+	}
+}